@@ -3,12 +3,15 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gitea.com/go-chi/cache"
@@ -52,26 +55,82 @@ type Api struct {
 	repo    data.Repo
 	cache   cache.Cache
 	dataSrv *data.Service
-	secret  string
+	opts    Options
+	// ctx is the lifecycle of the server, which population jobs run on
+	ctx context.Context
+	// scheduler is nil unless the database is populated on schedule
+	scheduler *data.Scheduler
+
+	// cachedMu guards cached, which holds the cache keys of the responses built out of every dataset
+	cachedMu sync.Mutex
+	cached   map[string]map[string]bool
+}
+
+// anyDataset stands for responses that have to be flushed whenever any dataset changes
+const anyDataset = "*"
+
+// routeDatasets are the datasets the responses of every cached route are built out of, named like the steps of
+// ingestion runs. Waste is populated by the timeline step. Routes missing here are flushed on any change, while
+// routes with no datasets are never flushed.
+var routeDatasets = map[string][]string{
+	"/regional_units":          {data.DatasetCases},
+	"/municipalities":          {data.DatasetDeathsPerMunicipality},
+	"/hierarchy":               {data.DatasetCases, data.DatasetDeathsPerMunicipality},
+	"/deaths_per_municipality": {data.DatasetDeathsPerMunicipality, data.DatasetCases},
+	"/cases":                   {data.DatasetCases},
+	"/timeline_fields":         {},
+	"/timeline":                {data.DatasetTimeline},
+	"/changes":                 {anyDataset},
+	"/waste_sites":             {data.DatasetTimeline},
+	"/waste":                   {data.DatasetTimeline},
+	"/vaccinations":            {data.DatasetVaccinations},
+	"/datasets":                {},
+	"/{field}":                 {data.DatasetTimeline},
+	"/demographics":            {data.DatasetDemographics},
 }
 
-// NewApi initiates and API struct
+// Options tune the authentication, caching and rate limiting of the API.
+type Options struct {
+	// Secret is the bearer token of the admin endpoints
+	Secret string
+	// CacheTtl is how long responses are cached at most, besides being flushed when their datasets change. Zero keeps
+	// them until then.
+	CacheTtl time.Duration
+	// RateLimit is the number of requests a client may send within RateWindow. Zero turns rate limiting off.
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+// NewApi initiates and API struct. Population jobs started through the API run on ctx, so they stop along with the
+// server.
 func NewApi(
+	ctx context.Context,
 	repo data.Repo,
 	dataSrv *data.Service,
-	secret string,
+	opts Options,
 ) *Api {
 	api := Api{
 		repo:    repo,
 		cache:   cache.NewMemoryCacher(),
 		dataSrv: dataSrv,
-		secret:  secret,
+		opts:    opts,
+		ctx:     ctx,
+		cached:  make(map[string]map[string]bool),
 	}
 	api.initRouter()
+	// responses are kept until the data they were built out of changes
+	dataSrv.OnChange(func(datasets []string) {
+		api.flushDatasets(datasets...)
+	})
 
 	return &api
 }
 
+// SetScheduler makes the schedule of population visible to the admin endpoints.
+func (a *Api) SetScheduler(scheduler *data.Scheduler) {
+	a.scheduler = scheduler
+}
+
 func (a *Api) initRouter() {
 	// initiate API Router
 	r := chi.NewRouter()
@@ -80,8 +139,10 @@ func (a *Api) initRouter() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	// use rate limit of 100 requests per minute
-	r.Use(httprate.LimitByIP(100, 1*time.Minute))
+	// limit the requests of every client
+	if a.opts.RateLimit > 0 {
+		r.Use(httprate.LimitByIP(a.opts.RateLimit, a.opts.RateWindow))
+	}
 
 	// use cache middleware
 	r.Use(a.cacheMw)
@@ -110,6 +171,10 @@ func (a *Api) initRouter() {
 
 		// helper endpoint
 		r.Get("/regional_units", func(w http.ResponseWriter, r *http.Request) {
+			// regional units are never revised, so they are the same as of any day
+			if _, ok := a.asOf(w, r); !ok {
+				return
+			}
 			rus, err := a.repo.GetRegionalUnits(r.Context())
 			if err != nil {
 				log.Println(err)
@@ -121,6 +186,10 @@ func (a *Api) initRouter() {
 
 		// helper endpoint
 		r.Get("/municipalities", func(w http.ResponseWriter, r *http.Request) {
+			// municipalities are never revised, so they are the same as of any day
+			if _, ok := a.asOf(w, r); !ok {
+				return
+			}
 			municipalities, err := a.repo.GetMunicipalities(r.Context())
 			if err != nil {
 				log.Println(err)
@@ -131,9 +200,45 @@ func (a *Api) initRouter() {
 			a.respond200(w, r, municipalities[p.start:p.end], false)
 		})
 
+		// helper endpoint
+		r.Get("/hierarchy", func(w http.ResponseWriter, r *http.Request) {
+			// the hierarchy links regional units and municipalities, so it is the same as of any day as well
+			if _, ok := a.asOf(w, r); !ok {
+				return
+			}
+			departments, err := a.repo.GetHierarchy(r.Context())
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			a.respond200(w, r, departments, false)
+		})
+
 		// COVID-19 deaths per Greek municipality
 		r.Get("/deaths_per_municipality", func(w http.ResponseWriter, r *http.Request) {
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			groupBy, err := data.ParseGroupBy(r.URL.Query().Get("group_by"))
+			if err != nil {
+				a.respondError(w, r, http.StatusBadRequest, ErrorResp{err.Error()})
+				return
+			}
 			f := deathsFilter(r.URL.Query())
+			f.AsOf = asOf
+			if groupBy != data.AreaMunicipality {
+				areas, err := a.repo.GetDeathsPerArea(r.Context(), f, groupBy)
+				if err != nil {
+					log.Println(err)
+					a.respondError(w, r, http.StatusInternalServerError, nil)
+					return
+				}
+				p := getPagination(r.URL.Query(), len(areas))
+				a.respond200(w, r, areas[p.start:p.end], false)
+				return
+			}
 			municipalities, err := a.repo.GetDeathsPerMunicipality(r.Context(), f)
 			if err != nil {
 				log.Println(err)
@@ -146,8 +251,21 @@ func (a *Api) initRouter() {
 
 		// COVID-19 deaths per Greek prefecture
 		r.Get("/cases", func(w http.ResponseWriter, r *http.Request) {
+			fill, ok := a.fill(w, r)
+			if !ok {
+				return
+			}
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			cadence, ok := a.cadence(w, r)
+			if !ok {
+				return
+			}
 			filter := casesFilter(r.URL.Query())
-			cases, err := a.repo.GetCases(r.Context(), filter)
+			filter.AsOf = asOf
+			cases, err := a.cases(r.Context(), filter, fill, cadence)
 			if err != nil {
 				log.Println(err)
 				a.respondError(w, r, http.StatusInternalServerError, nil)
@@ -159,18 +277,31 @@ func (a *Api) initRouter() {
 
 		// helper endpoint
 		r.Get("/timeline_fields", func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := a.asOf(w, r); !ok {
+				return
+			}
 			a.respond200(w, r, tlFields, false)
 		})
 
 		// returns full COVID-19 info for every date of a specific period
 		r.Get("/timeline", func(w http.ResponseWriter, r *http.Request) {
+			fill, ok := a.fill(w, r)
+			if !ok {
+				return
+			}
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
 			tlf := timelineFilter(r.URL.Query())
+			tlf.AsOf = asOf
 			info, err := a.repo.GetFromTimeline(r.Context(), tlf.DatesFilter)
 			if err != nil {
 				log.Println(err)
 				a.respondError(w, r, http.StatusInternalServerError, nil)
 				return
 			}
+			data.FillTimeline(info, fill)
 			p := getPagination(r.URL.Query(), len(info))
 			if len(tlf.Fields) > 0 {
 				a.respond200(w, r, keepFields(tlf.Fields, info)[p.start:p.end], false)
@@ -179,27 +310,168 @@ func (a *Api) initRouter() {
 			a.respond200(w, r, info[p.start:p.end], false)
 		})
 
+		// values of the datasets that loads changed, latest first
+		r.Get("/changes", func(w http.ResponseWriter, r *http.Request) {
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			f, err := revisionFilter(r.URL.Query())
+			if err != nil {
+				a.respondError(w, r, http.StatusBadRequest, ErrorResp{err.Error()})
+				return
+			}
+			f.AsOf = asOf
+			// revisions keep growing, so only the page asked for is read
+			p := getPagination(r.URL.Query(), math.MaxInt)
+			f.Limit, f.Offset = p.perPage, p.start
+			revisions, err := a.repo.GetRevisions(r.Context(), f)
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			a.respond200(w, r, revisions, false)
+		})
+
+		// helper endpoint
+		r.Get("/waste_sites", func(w http.ResponseWriter, r *http.Request) {
+			// waste sites are never revised, so they are the same as of any day
+			if _, ok := a.asOf(w, r); !ok {
+				return
+			}
+			sites, err := a.repo.GetWasteSites(r.Context())
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			a.respond200(w, r, sites, false)
+		})
+
+		// weekly change of the viral load in wastewater per site
+		r.Get("/waste", func(w http.ResponseWriter, r *http.Request) {
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			f, err := wasteFilter(r.URL.Query())
+			if err != nil {
+				a.respondError(w, r, http.StatusBadRequest, ErrorResp{err.Error()})
+				return
+			}
+			f.AsOf = asOf
+			measurements, err := a.repo.GetWaste(r.Context(), f)
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			p := getPagination(r.URL.Query(), len(measurements))
+			a.respond200(w, r, measurements[p.start:p.end], false)
+		})
+
+		// daily vaccination doses per regional unit, or nationally, by dose number
+		r.Get("/vaccinations", func(w http.ResponseWriter, r *http.Request) {
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			f, err := vaccinationsFilter(r.URL.Query())
+			if err != nil {
+				a.respondError(w, r, http.StatusBadRequest, ErrorResp{err.Error()})
+				return
+			}
+			f.AsOf = asOf
+			vaccinations, err := a.repo.GetVaccinations(r.Context(), f)
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			p := getPagination(r.URL.Query(), len(vaccinations))
+			a.respond200(w, r, vaccinations[p.start:p.end], false)
+		})
+
+		// helper endpoint
+		r.Get("/datasets", func(w http.ResponseWriter, r *http.Request) {
+			// the registry is configured, not loaded, so it is the same as of any day
+			if _, ok := a.asOf(w, r); !ok {
+				return
+			}
+			a.respond200(w, r, a.dataSrv.Datasets(), false)
+		})
+
+		// records of a dataset of the registry
+		r.Get("/datasets/{name}", func(w http.ResponseWriter, r *http.Request) {
+			def, ok := a.dataSrv.Dataset(chi.URLParam(r, "name"))
+			if !ok {
+				a.respondError(w, r, http.StatusNotFound, ErrorResp{"dataset not found"})
+				return
+			}
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			f := datesFilter(r.URL.Query())
+			if len(def.DateField) == 0 && (!f.StartDate.IsZero() || !f.EndDate.IsZero()) {
+				a.respondError(w, r, http.StatusBadRequest, ErrorResp{"dataset has no dates to filter by"})
+				return
+			}
+			f.AsOf = asOf
+			records, err := a.repo.GetDatasetRows(r.Context(), def, f)
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			p := getPagination(r.URL.Query(), len(records))
+			a.respond200(w, r, records[p.start:p.end], false)
+		})
+
 		// same as /timeline, but for a specific field (for example, "total_reinfections")
 		r.Get("/{field}", func(w http.ResponseWriter, r *http.Request) {
 			field := chi.URLParam(r, "field")
-			info, err := a.repo.GetFromTimeline(r.Context(), datesFilter(r.URL.Query()))
+			fill, ok := a.fill(w, r)
+			if !ok {
+				return
+			}
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			f := datesFilter(r.URL.Query())
+			f.AsOf = asOf
+			info, err := a.repo.GetFromTimeline(r.Context(), f)
 			if err != nil {
 				log.Println(err)
 				a.respondError(w, r, http.StatusInternalServerError, nil)
 				return
 			}
+			data.FillTimeline(info, fill)
 			p := getPagination(r.URL.Query(), len(info))
 			a.respond200(w, r, keepFields([]string{field}, info)[p.start:p.end], false)
 		})
 
 		// returns COVID19 demographics info by date
 		r.Get("/demographics", func(w http.ResponseWriter, r *http.Request) {
-			info, err := a.repo.GetDemographicInfo(r.Context(), demographicsFilter(r.URL.Query()))
+			fill, ok := a.fill(w, r)
+			if !ok {
+				return
+			}
+			asOf, ok := a.asOf(w, r)
+			if !ok {
+				return
+			}
+			f := demographicsFilter(r.URL.Query())
+			f.AsOf = asOf
+			info, err := a.repo.GetDemographicInfo(r.Context(), f)
 			if err != nil {
 				log.Println(err)
 				a.respondError(w, r, http.StatusInternalServerError, nil)
 				return
 			}
+			data.FillDemographics(info, fill)
 			p := getPagination(r.URL.Query(), len(info))
 			a.respond200(w, r, info[p.start:p.end], false)
 		})
@@ -216,23 +488,218 @@ func (a *Api) initRouter() {
 			w.WriteHeader(http.StatusOK)
 		})
 
-		// same as health, but only for authenticated users
+		// Deprecated: use POST /admin/refresh, which tells the job to poll for its progress
 		r.Get("/refresh", func(w http.ResponseWriter, r *http.Request) {
-			go func() {
-				if err := a.dataSrv.PopulateEverything(context.Background()); err != nil {
-					log.Printf("data refresh failed: %v", err)
+			a.requestRefresh(w, r, nil)
+		})
+
+		// starts a population job of the requested datasets, or of all of them, unless one is already running in this
+		// or another replica. The response tells whether the job started, or the request was coalesced into or queued
+		// behind the running one. Responses of the datasets that change are flushed once the job is over.
+		r.Post("/admin/refresh", func(w http.ResponseWriter, r *http.Request) {
+			var req RefreshReq
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					a.respondError(w, r, http.StatusBadRequest, ErrorResp{fmt.Sprintf("invalid request body: %s", err)})
+					return
 				}
-			}()
-			if err := a.cache.Flush(); err != nil {
-				log.Printf("cache could not be flushed: %v", err)
 			}
-			w.WriteHeader(http.StatusOK)
+			known := a.dataSrv.DatasetNames()
+			for _, name := range req.Datasets {
+				if !containsString(known, name) {
+					a.respondError(w, r, http.StatusBadRequest, ErrorResp{
+						fmt.Sprintf("unknown dataset %s, use one of %s", name, strings.Join(known, ", ")),
+					})
+					return
+				}
+			}
+			a.requestRefresh(w, r, req.Datasets)
+		})
+
+		// a population job, together with the progress of each of its datasets
+		r.Get("/admin/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+			job, err := a.dataSrv.Job(vartypes.StringToInt(chi.URLParam(r, "id")))
+			if errors.Is(err, data.ErrNotFound) {
+				a.respondError(w, r, http.StatusNotFound, ErrorResp{"job not found"})
+				return
+			}
+			a.respondUncached(w, r, job)
+		})
+
+		// cancels a queued or running population job
+		r.Post("/admin/jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+			job, err := a.dataSrv.CancelJob(vartypes.StringToInt(chi.URLParam(r, "id")))
+			if errors.Is(err, data.ErrNotFound) {
+				a.respondError(w, r, http.StatusNotFound, ErrorResp{"job not found"})
+				return
+			}
+			if errors.Is(err, data.ErrJobFinished) {
+				a.respondError(w, r, http.StatusConflict, ErrorResp{fmt.Sprintf("job is already %s", job.Status)})
+				return
+			}
+			a.respondUncached(w, r, job)
+		})
+
+		// history of ingestion runs, latest first
+		r.Get("/admin/ingestions", func(w http.ResponseWriter, r *http.Request) {
+			runs, err := a.repo.GetIngestionRuns(r.Context())
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			p := getPagination(r.URL.Query(), len(runs))
+			a.respondUncached(w, r, runs[p.start:p.end])
+		})
+
+		// next scheduled population of every dataset, soonest first
+		r.Get("/admin/schedule", func(w http.ResponseWriter, r *http.Request) {
+			if a.scheduler == nil {
+				a.respondError(w, r, http.StatusNotFound, ErrorResp{"database population is not scheduled"})
+				return
+			}
+			a.respondUncached(w, r, a.scheduler.Next())
+		})
+
+		// a single ingestion run, together with the outcome of each dataset step
+		r.Get("/admin/ingestions/{id}", func(w http.ResponseWriter, r *http.Request) {
+			id := vartypes.StringToInt(chi.URLParam(r, "id"))
+			run, err := a.repo.GetIngestionRun(r.Context(), id)
+			if errors.Is(err, data.ErrNotFound) {
+				a.respondError(w, r, http.StatusNotFound, ErrorResp{"ingestion run not found"})
+				return
+			}
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			a.respondUncached(w, r, run)
+		})
+
+		// values withheld during ingestion as suspicious, latest first
+		r.Get("/admin/quarantine", func(w http.ResponseWriter, r *http.Request) {
+			values, err := a.repo.GetQuarantinedValues(r.Context(), quarantineFilter(r.URL.Query()))
+			if err != nil {
+				log.Println(err)
+				a.respondError(w, r, http.StatusInternalServerError, nil)
+				return
+			}
+			p := getPagination(r.URL.Query(), len(values))
+			a.respondUncached(w, r, values[p.start:p.end])
+		})
+
+		// publishes a quarantined value
+		r.Post("/admin/quarantine/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+			a.resolveQuarantined(w, r, true)
+		})
+
+		// keeps a quarantined value withheld
+		r.Post("/admin/quarantine/{id}/reject", func(w http.ResponseWriter, r *http.Request) {
+			a.resolveQuarantined(w, r, false)
 		})
 	})
 
 	a.Router = r
 }
 
+// requestRefresh requests a population job of datasets, all of them if none is given, on the lifecycle of the server
+func (a *Api) requestRefresh(w http.ResponseWriter, r *http.Request, datasets []string) {
+	job, outcome, err := a.dataSrv.RequestRun(a.ctx, data.TriggerRefresh, datasets...)
+	if err != nil {
+		log.Printf("data refresh failed: %v", err)
+		a.respondError(w, r, http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/admin/jobs/%d", job.Id))
+	a.respondStatus(w, r, http.StatusAccepted, RefreshResp{JobId: job.Id, Outcome: outcome})
+}
+
+// resolveQuarantined approves or rejects the quarantined value of the request
+func (a *Api) resolveQuarantined(w http.ResponseWriter, r *http.Request, approve bool) {
+	id := vartypes.StringToInt(chi.URLParam(r, "id"))
+	q, err := a.dataSrv.ResolveQuarantined(r.Context(), id, approve)
+	if errors.Is(err, data.ErrNotFound) {
+		a.respondError(w, r, http.StatusNotFound, ErrorResp{"quarantined value not found"})
+		return
+	}
+	if errors.Is(err, data.ErrAlreadyResolved) {
+		a.respondError(w, r, http.StatusConflict, ErrorResp{fmt.Sprintf("quarantined value is already %s", q.Status)})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		a.respondError(w, r, http.StatusInternalServerError, nil)
+		return
+	}
+	if approve || q.PublishedValue == nil {
+		// the approved value is now published, or the rejected one cleared
+		a.flushDatasets(data.DatasetTimeline)
+	}
+	a.respondUncached(w, r, q)
+}
+
+// quarantineFilter initializes filter for quarantined values
+func quarantineFilter(values url.Values) data.QuarantineFilter {
+	return data.QuarantineFilter{
+		Dataset: values.Get("dataset"),
+		Status:  values.Get("status"),
+	}
+}
+
+// revisionFilter initializes filter for revisions. since is either a date or an RFC 3339 time.
+func revisionFilter(values url.Values) (data.RevisionFilter, error) {
+	f := data.RevisionFilter{
+		Dataset: values.Get("dataset"),
+		Field:   values.Get("field"),
+	}
+	if since := values.Get("since"); len(since) > 0 {
+		var err error
+		if f.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			if f.Since, err = time.Parse("2006-01-02", since); err != nil {
+				return f, fmt.Errorf("invalid since %q, use YYYY-MM-DD or an RFC 3339 time", since)
+			}
+		}
+	}
+	return f, nil
+}
+
+// wasteFilter initializes filter for waste measurements. Weeks are given as YYYY-W.
+func wasteFilter(values url.Values) (data.WasteFilter, error) {
+	f := data.WasteFilter{
+		DatesFilter: datesFilter(values),
+		SiteId:      vartypes.StringToInt(values.Get("site_id")),
+		Site:        values.Get("site"),
+	}
+	for k, yw := range map[string]*data.YearWeek{"start_week": &f.StartWeek, "end_week": &f.EndWeek} {
+		v := values.Get(k)
+		if len(v) == 0 {
+			continue
+		}
+		var err error
+		if *yw, err = data.ParseYearWeek(v); err != nil {
+			return f, fmt.Errorf("invalid %s %q, use YYYY-W", k, v)
+		}
+	}
+	return f, nil
+}
+
+// vaccinationsFilter initializes filter for vaccinations, with the same dates and regional unit as cases
+func vaccinationsFilter(values url.Values) (data.VaccinationsFilter, error) {
+	cf := casesFilter(values)
+	f := data.VaccinationsFilter{DatesFilter: cf.DatesFilter, RegionalUnitId: cf.RegionalUnitId}
+	if v := values.Get("national"); len(v) > 0 {
+		var err error
+		if f.National, err = strconv.ParseBool(v); err != nil {
+			return f, fmt.Errorf("invalid national %q, use true or false", v)
+		}
+	}
+	if f.National && f.RegionalUnitId > 0 {
+		return f, errors.New("national and regional_unit_id cannot be combined")
+	}
+	return f, nil
+}
+
 // demographicsFilter initializes filter for demographics query
 func demographicsFilter(values url.Values) data.DemographicFilter {
 	f := data.DemographicFilter{}
@@ -364,6 +831,76 @@ func keepFields(fields []string, fullInfos []data.FullInfo) []map[string]interfa
 	return res
 }
 
+// cases returns the filled cases in their native cadence, or resampled to a daily or weekly one.
+func (a *Api) cases(ctx context.Context, f data.CasesFilter, fill data.Fill, cadence data.Cadence) ([]data.Case, error) {
+	if cadence == data.CadenceNative {
+		cases, err := a.repo.GetCases(ctx, f)
+		data.FillCases(cases, fill)
+		return cases, err
+	}
+
+	// the periods of observations reach up to a week before their dates, and resampled periods up to a week away
+	query := f
+	if !query.StartDate.IsZero() {
+		query.StartDate = query.StartDate.AddDate(0, 0, -6)
+	}
+	if !query.EndDate.IsZero() {
+		query.EndDate = query.EndDate.AddDate(0, 0, 6)
+	}
+	cases, err := a.repo.GetCases(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := a.repo.GetCadencePeriods(ctx, data.DatasetCases)
+	if err != nil {
+		return nil, err
+	}
+	data.FillCases(cases, fill)
+
+	var res []data.Case
+	for _, c := range data.ResampleCases(cases, cadence, data.WeekEnd(periods)) {
+		if f.Contains(c.Date) {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// cadence parses the cadence of the requested observations. If it is invalid, it responds with 400 and returns false.
+func (a *Api) cadence(w http.ResponseWriter, r *http.Request) (data.Cadence, bool) {
+	cadence, err := data.ParseCadence(r.URL.Query().Get("cadence"))
+	if err != nil {
+		a.respondError(w, r, http.StatusBadRequest, ErrorResp{err.Error()})
+		return cadence, false
+	}
+	return cadence, true
+}
+
+// fill parses the fill strategy of missing values. If it is invalid, it responds with 400 and returns false.
+func (a *Api) fill(w http.ResponseWriter, r *http.Request) (data.Fill, bool) {
+	fill, err := data.ParseFill(r.URL.Query().Get("fill"))
+	if err != nil {
+		a.respondError(w, r, http.StatusBadRequest, ErrorResp{err.Error()})
+		return fill, false
+	}
+	return fill, true
+}
+
+// asOf parses the day whose knowledge of the data is requested. It is zero for the current data. If it is invalid,
+// it responds with 400 and returns false.
+func (a *Api) asOf(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	v := r.URL.Query().Get("as_of")
+	if len(v) == 0 {
+		return time.Time{}, true
+	}
+	asOf, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		a.respondError(w, r, http.StatusBadRequest, ErrorResp{fmt.Sprintf("invalid as_of %q, use YYYY-MM-DD", v)})
+		return asOf, false
+	}
+	return asOf, true
+}
+
 // authMw is the authentication middleware function. Currently a bit useless as we don't have authentication
 func (a *Api) authMw(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -387,7 +924,7 @@ func ExtractTokenFromRequest(r *http.Request) string {
 
 // Authenticate authenticates requests
 func (a *Api) Authenticate(token string) error {
-	if token == a.secret {
+	if token == a.opts.Secret {
 		return nil
 	}
 	return fmt.Errorf("authentication failed")
@@ -408,6 +945,49 @@ func (a *Api) cacheMw(next http.Handler) http.Handler {
 	})
 }
 
+// cachePut caches the response to r, keeping its key under the datasets of its route
+func (a *Api) cachePut(r *http.Request, content interface{}) {
+	key := r.URL.RequestURI()
+	if err := a.cache.Put(key, content, int64(a.opts.CacheTtl/time.Second)); err != nil {
+		log.Printf("response could not be cached: %v", err)
+		return
+	}
+	pattern := chi.RouteContext(r.Context()).RoutePattern()
+	datasets, ok := routeDatasets[pattern]
+	switch {
+	case pattern == "/datasets/{name}":
+		// datasets of the registry are populated by steps of their own name
+		datasets = []string{chi.URLParam(r, "name")}
+	case !ok:
+		datasets = []string{anyDataset}
+	}
+
+	a.cachedMu.Lock()
+	defer a.cachedMu.Unlock()
+	for _, d := range datasets {
+		if a.cached[d] == nil {
+			a.cached[d] = make(map[string]bool)
+		}
+		a.cached[d][key] = true
+	}
+}
+
+// flushDatasets removes the cached responses built out of the given datasets, along with those depending on any
+// dataset.
+func (a *Api) flushDatasets(datasets ...string) {
+	a.cachedMu.Lock()
+	defer a.cachedMu.Unlock()
+	for _, d := range append(datasets, anyDataset) {
+		for key := range a.cached[d] {
+			if err := a.cache.Delete(key); err != nil {
+				log.Printf("cache could not be flushed: %v", err)
+			}
+		}
+		delete(a.cached, d)
+	}
+	log.Printf("flushed cached responses of %v", datasets)
+}
+
 // respondError helper function for erroneous API responses
 func (a *Api) respondError(w http.ResponseWriter, r *http.Request, statusCode int, content interface{}) {
 	w.WriteHeader(statusCode)
@@ -424,7 +1004,7 @@ func (a *Api) respondError(w http.ResponseWriter, r *http.Request, statusCode in
 // respondError helper function for successful API responses
 func (a *Api) respond200(w http.ResponseWriter, r *http.Request, content interface{}, fromCache bool) {
 	if !fromCache {
-		a.cache.Put(r.URL.RequestURI(), content, 60*60*24)
+		a.cachePut(r, content)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -438,10 +1018,42 @@ func (a *Api) respond200(w http.ResponseWriter, r *http.Request, content interfa
 	w.Write(bytes)
 }
 
+// respondUncached is like respond200, but the response is never cached. Used for authenticated endpoints.
+func (a *Api) respondUncached(w http.ResponseWriter, r *http.Request, content interface{}) {
+	a.respond200(w, r, content, true)
+}
+
+// respondStatus is like respondUncached, but with a status other than 200
+func (a *Api) respondStatus(w http.ResponseWriter, r *http.Request, statusCode int, content interface{}) {
+	bytes, err := json.Marshal(content)
+	if err != nil {
+		log.Println("failed to marshal response:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(bytes)))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(statusCode)
+	w.Write(bytes)
+}
+
 type ErrorResp struct {
 	Msg string `json:"message"`
 }
 
+// RefreshReq names the datasets to populate, all of them if none is named
+type RefreshReq struct {
+	Datasets []string `json:"datasets"`
+}
+
+// RefreshResp tells the job serving a refresh request, and what happened to the request, one of data.RunStarted,
+// data.RunCoalesced or data.RunQueued
+type RefreshResp struct {
+	JobId   int    `json:"job_id"`
+	Outcome string `json:"outcome"`
+}
+
 type pagination struct {
 	page    int
 	perPage int
@@ -489,3 +1101,13 @@ func getPagination(values url.Values, count int) pagination {
 		end:     end,
 	}
 }
+
+// containsString tells whether value is one of values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +17,8 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"covid19-greece-api/internal/data"
+	"covid19-greece-api/pkg/file"
+	"covid19-greece-api/pkg/vartypes"
 )
 
 type ApiSuite struct {
@@ -27,19 +33,21 @@ func (s *ApiSuite) SetupSuite() {
 	s.ctrl = mockCtrl
 	repo := data.NewRepoMock(s.ctrl)
 	s.repo = repo
-	srv, _ := data.NewService(
-		repo,
-		"../data/test_csv/testing_cases.csv",
-		"../data/test_csv/testing_timeline.csv",
-		"../data/test_csv/testing_deaths.csv",
-		"../data/test_csv/testing_demographics.csv",
-		"../data/test_csv/testing_waste.csv",
-		true,
-	)
+	srv, _ := data.NewService(repo, data.Sources{
+		Cases:                 file.NewLocalSource("../data/test_csv/testing_cases.csv"),
+		Timeline:              file.NewLocalSource("../data/test_csv/testing_timeline.csv"),
+		DeathsPerMunicipality: file.NewLocalSource("../data/test_csv/testing_deaths.csv"),
+		Demographics:          file.NewLocalSource("../data/test_csv/testing_demographics.csv"),
+		Waste:                 file.NewLocalSource("../data/test_csv/testing_waste.csv"),
+	})
+	defs, err := data.LoadRegistry("../data/test_csv/testing_registry.yaml")
+	assert.Nil(s.T(), err)
+	srv.RegisterDatasets(defs)
 	s.api = NewApi(
+		context.Background(),
 		repo,
 		srv,
-		"abcd",
+		Options{Secret: "abcd"},
 	)
 }
 
@@ -121,7 +129,7 @@ func (s *ApiSuite) TestGetMunicipalities() {
 func (s *ApiSuite) TestGetDeathsPerMunicipality() {
 	expected := []data.YearlyDeaths{{
 		MunId:  1,
-		Deaths: 123,
+		Deaths: vartypes.IntPtr(123),
 		Year:   2021,
 	}}
 	s.repo.EXPECT().GetDeathsPerMunicipality(gomock.Any(), data.DeathsFilter{
@@ -143,15 +151,69 @@ func (s *ApiSuite) TestGetDeathsPerMunicipality() {
 	assert.EqualValues(s.T(), expected, deaths)
 }
 
+func (s *ApiSuite) TestGetDeathsGroupedByArea() {
+	expected := []data.AreaDeaths{{
+		Level:          data.AreaPrefecture,
+		Id:             3,
+		Name:           "Περιφέρεια Ηπείρου",
+		Slug:           "periphereia-epeirou",
+		Year:           2021,
+		Deaths:         321,
+		Municipalities: 18,
+	}}
+	s.repo.EXPECT().GetDeathsPerArea(gomock.Any(), data.DeathsFilter{Year: 2021}, data.AreaPrefecture).
+		Times(1).Return(expected, nil)
+	req, _ := http.NewRequest(http.MethodGet, "/deaths_per_municipality?year=2021&group_by=prefecture", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var deaths []data.AreaDeaths
+	err := json.Unmarshal(w.Body.Bytes(), &deaths)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), expected, deaths)
+
+	req, _ = http.NewRequest(http.MethodGet, "/deaths_per_municipality?group_by=village", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 400, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "unknown group_by")
+}
+
+func (s *ApiSuite) TestGetHierarchy() {
+	expected := []data.HierarchyNode{{
+		Level: data.AreaDepartment, Id: 1, Name: "Ήπειρος", Slug: "epeiros",
+		Children: []data.HierarchyNode{{
+			Level: data.AreaPrefecture, Id: 3, Name: "Περιφέρεια Ηπείρου", Slug: "periphereia-epeirou",
+			Children: []data.HierarchyNode{{
+				Level: data.AreaRegionalUnit, Id: 7, Name: "Π.Ε. Άρτας", Slug: "artas",
+				Children: []data.HierarchyNode{
+					{Level: data.AreaMunicipality, Id: 12, Name: "Αρταίων", Slug: "artaion"},
+				},
+			}},
+		}},
+	}}
+	s.repo.EXPECT().GetHierarchy(gomock.Any()).Times(1).Return(expected, nil)
+	req, _ := http.NewRequest(http.MethodGet, "/hierarchy", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var hierarchy []data.HierarchyNode
+	err := json.Unmarshal(w.Body.Bytes(), &hierarchy)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), expected, hierarchy)
+}
+
 func (s *ApiSuite) TestGetCases() {
 	expected := []data.Case{{
 		RegionalUnitId: 1,
 		Date:           time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-		Cases:          234,
+		Cases:          vartypes.IntPtr(234),
 	}, {
 		RegionalUnitId: 3,
 		Date:           time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-		Cases:          45454,
+		Cases:          vartypes.IntPtr(45454),
 	}}
 	s.repo.EXPECT().GetCases(gomock.Any(), data.CasesFilter{
 		RegionalUnitId: 1,
@@ -175,6 +237,131 @@ func (s *ApiSuite) TestGetCases() {
 	assert.EqualValues(s.T(), expected, cases)
 }
 
+func (s *ApiSuite) TestGetCasesKeepsMissingAsNull() {
+	cases := []data.Case{{
+		RegionalUnitId: 2,
+		Date:           time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Cases:          vartypes.IntPtr(7),
+		PeriodStart:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:      time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Cadence:        data.CadenceDaily,
+	}, {
+		RegionalUnitId: 2,
+		Date:           time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+		PeriodStart:    time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:      time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+		Cadence:        data.CadenceDaily,
+	}}
+	period := func(date string) string {
+		return fmt.Sprintf(`"period_start":"%[1]sT00:00:00Z","period_end":"%[1]sT00:00:00Z","cadence":"daily"`, date)
+	}
+	for _, tt := range []struct {
+		fill     string
+		expected string
+	}{
+		{"", `[{"regional_unit_id":2,"date":"2021-01-01T00:00:00Z","cases":7,` + period("2021-01-01") + `},` +
+			`{"regional_unit_id":2,"date":"2021-01-02T00:00:00Z","cases":null,` + period("2021-01-02") + `}]`},
+		{"zero", `[{"regional_unit_id":2,"date":"2021-01-01T00:00:00Z","cases":7,` + period("2021-01-01") + `},` +
+			`{"regional_unit_id":2,"date":"2021-01-02T00:00:00Z","cases":0,` + period("2021-01-02") + `}]`},
+		{"previous", `[{"regional_unit_id":2,"date":"2021-01-01T00:00:00Z","cases":7,` + period("2021-01-01") + `},` +
+			`{"regional_unit_id":2,"date":"2021-01-02T00:00:00Z","cases":7,` + period("2021-01-02") + `}]`},
+	} {
+		// the repository returns a fresh copy every time, as filling changes the slice
+		s.repo.EXPECT().GetCases(gomock.Any(), data.CasesFilter{RegionalUnitId: 2}).Times(1).
+			Return(append([]data.Case(nil), cases...), nil)
+		req, _ := http.NewRequest(http.MethodGet, "/cases?regional_unit_id=2&fill="+tt.fill, nil)
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		assert.Equal(s.T(), 200, w.Code)
+		assert.JSONEq(s.T(), tt.expected, w.Body.String(), "fill=%s", tt.fill)
+	}
+}
+
+func (s *ApiSuite) TestGetCasesResampled() {
+	day := func(d int) time.Time { return time.Date(2022, 7, d, 0, 0, 0, 0, time.UTC) }
+	var cases []data.Case
+	for d := 6; d <= 11; d++ {
+		cases = append(cases, data.Case{RegionalUnitId: 2, Date: day(d), Cases: vartypes.IntPtr(1), PeriodStart: day(d),
+			PeriodEnd: day(d), Cadence: data.CadenceDaily})
+	}
+	cases = append(cases, data.Case{RegionalUnitId: 2, Date: day(19), Cases: vartypes.IntPtr(14), PeriodStart: day(13),
+		PeriodEnd: day(19), Cadence: data.CadenceWeekly})
+
+	// dates are widened by a week, as the periods of the observations reach beyond them
+	s.repo.EXPECT().GetCases(gomock.Any(), data.CasesFilter{
+		RegionalUnitId: 2,
+		DatesFilter:    data.DatesFilter{StartDate: day(6), EndDate: day(26)},
+	}).Times(1).Return(cases, nil)
+	s.repo.EXPECT().GetCadencePeriods(gomock.Any(), data.DatasetCases).Times(1).Return([]data.CadencePeriod{
+		{Dataset: data.DatasetCases, Since: day(12), Cadence: data.CadenceWeekly},
+	}, nil)
+	req, _ := http.NewRequest(http.MethodGet,
+		"/cases?regional_unit_id=2&start_date=2022-07-12&end_date=2022-07-20&cadence=daily", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var res []data.Case
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Nil(s.T(), err)
+	// 12/7 was not reported, while the week until 19/7 is spread over its days
+	assert.Len(s.T(), res, 7)
+	for _, c := range res {
+		assert.Equal(s.T(), data.CadenceDaily, c.Cadence)
+		assert.Equal(s.T(), 2, *c.Cases)
+	}
+	assert.Equal(s.T(), day(13), res[0].Date)
+
+	req, _ = http.NewRequest(http.MethodGet, "/cases?cadence=monthly", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 400, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "unknown cadence")
+}
+
+func (s *ApiSuite) TestGetTimelineWithInvalidFill() {
+	req, _ := http.NewRequest(http.MethodGet, "/timeline?fill=average", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 400, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "unknown fill")
+}
+
+func (s *ApiSuite) TestGetAsOf() {
+	asOf := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	s.repo.EXPECT().GetFromTimeline(gomock.Any(), data.DatesFilter{AsOf: asOf}).Times(1).Return(nil, nil)
+	s.repo.EXPECT().GetCases(gomock.Any(), data.CasesFilter{RegionalUnitId: 4, DatesFilter: data.DatesFilter{AsOf: asOf}}).
+		Times(1).Return(nil, nil)
+	s.repo.EXPECT().GetDeathsPerMunicipality(gomock.Any(), data.DeathsFilter{Year: 2021, AsOf: asOf}).Times(1).
+		Return(nil, nil)
+	s.repo.EXPECT().GetDemographicInfo(gomock.Any(), data.DemographicFilter{DatesFilter: data.DatesFilter{AsOf: asOf}}).
+		Times(1).Return(nil, nil)
+	s.repo.EXPECT().GetRevisions(gomock.Any(), data.RevisionFilter{AsOf: asOf, Limit: perPageDefault}).Times(1).
+		Return(nil, nil)
+	// datasets that are not versioned are the same as of any day
+	s.repo.EXPECT().GetHierarchy(gomock.Any()).Times(1).Return(nil, nil)
+	s.repo.EXPECT().GetWasteSites(gomock.Any()).Times(1).Return(nil, nil)
+	for _, u := range []string{"/timeline?as_of=2022-03-01", "/cases?regional_unit_id=4&as_of=2022-03-01",
+		"/deaths_per_municipality?year=2021&as_of=2022-03-01", "/demographics?as_of=2022-03-01",
+		"/changes?as_of=2022-03-01", "/hierarchy?as_of=2022-03-01", "/waste_sites?as_of=2022-03-01"} {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		assert.Equal(s.T(), 200, w.Code, u)
+	}
+
+	// every read endpoint validates as_of
+	for _, u := range []string{"/deaths", "/timeline", "/cases", "/deaths_per_municipality", "/demographics", "/waste",
+		"/vaccinations", "/changes", "/regional_units", "/municipalities", "/hierarchy", "/waste_sites",
+		"/timeline_fields", "/datasets"} {
+		req, _ := http.NewRequest(http.MethodGet, u+"?as_of=last-month", nil)
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		assert.Equal(s.T(), 400, w.Code, u)
+		assert.Contains(s.T(), w.Body.String(), "invalid as_of", u)
+	}
+}
+
 func (s *ApiSuite) TestGetTimelineFields() {
 	req, _ := http.NewRequest(http.MethodGet, "/timeline_fields", nil)
 	w := httptest.NewRecorder()
@@ -193,38 +380,38 @@ func (s *ApiSuite) TestGetTimelineFields() {
 func (s *ApiSuite) TestGetTimeline() {
 	expected := []data.FullInfo{{
 		Date:                   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-		Cases:                  1,
-		TotalReinfections:      2,
-		Deaths:                 3,
-		DeathsCum:              4,
-		Recovered:              5,
-		HospitalAdmissions:     6,
-		HospitalDischarges:     7,
-		Intubated:              8,
-		IntubatedVac:           9,
-		IntubatedUnvac:         10,
-		IcuOccupancy:           11,
-		BedsOccupancy:          12,
-		EstimatedNewRtpcrTests: 13,
-		EstimatedNewRapidTests: 14,
-		EstimatedNewTotalTests: 15,
+		Cases:                  vartypes.IntPtr(1),
+		TotalReinfections:      vartypes.IntPtr(2),
+		Deaths:                 vartypes.IntPtr(3),
+		DeathsCum:              vartypes.IntPtr(4),
+		Recovered:              vartypes.IntPtr(5),
+		HospitalAdmissions:     vartypes.IntPtr(6),
+		HospitalDischarges:     vartypes.IntPtr(7),
+		Intubated:              vartypes.IntPtr(8),
+		IntubatedVac:           vartypes.IntPtr(9),
+		IntubatedUnvac:         vartypes.IntPtr(10),
+		IcuOccupancy:           vartypes.FloatPtr(11),
+		BedsOccupancy:          vartypes.FloatPtr(12),
+		EstimatedNewRtpcrTests: vartypes.IntPtr(13),
+		EstimatedNewRapidTests: vartypes.IntPtr(14),
+		EstimatedNewTotalTests: vartypes.IntPtr(15),
 	}, {
 		Date:                   time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
-		Cases:                  100,
-		TotalReinfections:      200,
-		Deaths:                 300,
-		DeathsCum:              400,
-		Recovered:              500,
-		HospitalAdmissions:     600,
-		HospitalDischarges:     700,
-		Intubated:              800,
-		IntubatedVac:           900,
-		IntubatedUnvac:         1000,
-		IcuOccupancy:           1100,
-		BedsOccupancy:          1200,
-		EstimatedNewRtpcrTests: 1300,
-		EstimatedNewRapidTests: 1400,
-		EstimatedNewTotalTests: 1500,
+		Cases:                  vartypes.IntPtr(100),
+		TotalReinfections:      vartypes.IntPtr(200),
+		Deaths:                 vartypes.IntPtr(300),
+		DeathsCum:              vartypes.IntPtr(400),
+		Recovered:              vartypes.IntPtr(500),
+		HospitalAdmissions:     vartypes.IntPtr(600),
+		HospitalDischarges:     vartypes.IntPtr(700),
+		Intubated:              vartypes.IntPtr(800),
+		IntubatedVac:           vartypes.IntPtr(900),
+		IntubatedUnvac:         vartypes.IntPtr(1000),
+		IcuOccupancy:           vartypes.FloatPtr(1100),
+		BedsOccupancy:          vartypes.FloatPtr(1200),
+		EstimatedNewRtpcrTests: vartypes.IntPtr(1300),
+		EstimatedNewRapidTests: vartypes.IntPtr(1400),
+		EstimatedNewTotalTests: vartypes.IntPtr(1500),
 	}}
 	s.repo.EXPECT().GetFromTimeline(gomock.Any(), data.DatesFilter{
 		StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -248,38 +435,38 @@ func (s *ApiSuite) TestGetTimeline() {
 func (s *ApiSuite) TestGetTimelineWithSpecificFields() {
 	expected := []data.FullInfo{{
 		Date:                   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-		Cases:                  1,
-		TotalReinfections:      2,
-		Deaths:                 3,
-		DeathsCum:              4,
-		Recovered:              5,
-		HospitalAdmissions:     6,
-		HospitalDischarges:     7,
-		Intubated:              8,
-		IntubatedVac:           9,
-		IntubatedUnvac:         10,
-		IcuOccupancy:           11,
-		BedsOccupancy:          12,
-		EstimatedNewRtpcrTests: 13,
-		EstimatedNewRapidTests: 14,
-		EstimatedNewTotalTests: 15,
+		Cases:                  vartypes.IntPtr(1),
+		TotalReinfections:      vartypes.IntPtr(2),
+		Deaths:                 vartypes.IntPtr(3),
+		DeathsCum:              vartypes.IntPtr(4),
+		Recovered:              vartypes.IntPtr(5),
+		HospitalAdmissions:     vartypes.IntPtr(6),
+		HospitalDischarges:     vartypes.IntPtr(7),
+		Intubated:              vartypes.IntPtr(8),
+		IntubatedVac:           vartypes.IntPtr(9),
+		IntubatedUnvac:         vartypes.IntPtr(10),
+		IcuOccupancy:           vartypes.FloatPtr(11),
+		BedsOccupancy:          vartypes.FloatPtr(12),
+		EstimatedNewRtpcrTests: vartypes.IntPtr(13),
+		EstimatedNewRapidTests: vartypes.IntPtr(14),
+		EstimatedNewTotalTests: vartypes.IntPtr(15),
 	}, {
 		Date:                   time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
-		Cases:                  100,
-		TotalReinfections:      200,
-		Deaths:                 300,
-		DeathsCum:              400,
-		Recovered:              500,
-		HospitalAdmissions:     600,
-		HospitalDischarges:     700,
-		Intubated:              800,
-		IntubatedVac:           900,
-		IntubatedUnvac:         1000,
-		IcuOccupancy:           1100,
-		BedsOccupancy:          1200,
-		EstimatedNewRtpcrTests: 1300,
-		EstimatedNewRapidTests: 1400,
-		EstimatedNewTotalTests: 1500,
+		Cases:                  vartypes.IntPtr(100),
+		TotalReinfections:      vartypes.IntPtr(200),
+		Deaths:                 vartypes.IntPtr(300),
+		DeathsCum:              vartypes.IntPtr(400),
+		Recovered:              vartypes.IntPtr(500),
+		HospitalAdmissions:     vartypes.IntPtr(600),
+		HospitalDischarges:     vartypes.IntPtr(700),
+		Intubated:              vartypes.IntPtr(800),
+		IntubatedVac:           vartypes.IntPtr(900),
+		IntubatedUnvac:         vartypes.IntPtr(1000),
+		IcuOccupancy:           vartypes.FloatPtr(1100),
+		BedsOccupancy:          vartypes.FloatPtr(1200),
+		EstimatedNewRtpcrTests: vartypes.IntPtr(1300),
+		EstimatedNewRapidTests: vartypes.IntPtr(1400),
+		EstimatedNewTotalTests: vartypes.IntPtr(1500),
 	}}
 	s.repo.EXPECT().GetFromTimeline(gomock.Any(), data.DatesFilter{
 		StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -310,38 +497,38 @@ func (s *ApiSuite) TestGetTimelineWithSpecificFields() {
 func (s *ApiSuite) TestGetTimelineOneField() {
 	expected := []data.FullInfo{{
 		Date:                   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-		Cases:                  1,
-		TotalReinfections:      2,
-		Deaths:                 3,
-		DeathsCum:              4,
-		Recovered:              5,
-		HospitalAdmissions:     6,
-		HospitalDischarges:     7,
-		Intubated:              8,
-		IntubatedVac:           9,
-		IntubatedUnvac:         10,
-		IcuOccupancy:           11,
-		BedsOccupancy:          12,
-		EstimatedNewRtpcrTests: 13,
-		EstimatedNewRapidTests: 14,
-		EstimatedNewTotalTests: 15,
+		Cases:                  vartypes.IntPtr(1),
+		TotalReinfections:      vartypes.IntPtr(2),
+		Deaths:                 vartypes.IntPtr(3),
+		DeathsCum:              vartypes.IntPtr(4),
+		Recovered:              vartypes.IntPtr(5),
+		HospitalAdmissions:     vartypes.IntPtr(6),
+		HospitalDischarges:     vartypes.IntPtr(7),
+		Intubated:              vartypes.IntPtr(8),
+		IntubatedVac:           vartypes.IntPtr(9),
+		IntubatedUnvac:         vartypes.IntPtr(10),
+		IcuOccupancy:           vartypes.FloatPtr(11),
+		BedsOccupancy:          vartypes.FloatPtr(12),
+		EstimatedNewRtpcrTests: vartypes.IntPtr(13),
+		EstimatedNewRapidTests: vartypes.IntPtr(14),
+		EstimatedNewTotalTests: vartypes.IntPtr(15),
 	}, {
 		Date:                   time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
-		Cases:                  100,
-		TotalReinfections:      200,
-		Deaths:                 300,
-		DeathsCum:              400,
-		Recovered:              500,
-		HospitalAdmissions:     600,
-		HospitalDischarges:     700,
-		Intubated:              800,
-		IntubatedVac:           900,
-		IntubatedUnvac:         1000,
-		IcuOccupancy:           1100,
-		BedsOccupancy:          1200,
-		EstimatedNewRtpcrTests: 1300,
-		EstimatedNewRapidTests: 1400,
-		EstimatedNewTotalTests: 1500,
+		Cases:                  vartypes.IntPtr(100),
+		TotalReinfections:      vartypes.IntPtr(200),
+		Deaths:                 vartypes.IntPtr(300),
+		DeathsCum:              vartypes.IntPtr(400),
+		Recovered:              vartypes.IntPtr(500),
+		HospitalAdmissions:     vartypes.IntPtr(600),
+		HospitalDischarges:     vartypes.IntPtr(700),
+		Intubated:              vartypes.IntPtr(800),
+		IntubatedVac:           vartypes.IntPtr(900),
+		IntubatedUnvac:         vartypes.IntPtr(1000),
+		IcuOccupancy:           vartypes.FloatPtr(1100),
+		BedsOccupancy:          vartypes.FloatPtr(1200),
+		EstimatedNewRtpcrTests: vartypes.IntPtr(1300),
+		EstimatedNewRapidTests: vartypes.IntPtr(1400),
+		EstimatedNewTotalTests: vartypes.IntPtr(1500),
 	}}
 	s.repo.EXPECT().GetFromTimeline(gomock.Any(), data.DatesFilter{
 		StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -369,27 +556,27 @@ func (s *ApiSuite) TestGetDemographics() {
 	expected := []data.DemographicInfo{{
 		Date:              time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 		Category:          "0-17",
-		Cases:             1,
-		Deaths:            2,
-		Intensive:         3,
-		Discharged:        4,
-		Hospitalized:      5,
-		HospitalizedInIcu: 6,
-		PassedAway:        7,
-		Recovered:         8,
-		TreatedAtHome:     9,
+		Cases:             vartypes.IntPtr(1),
+		Deaths:            vartypes.IntPtr(2),
+		Intensive:         vartypes.IntPtr(3),
+		Discharged:        vartypes.IntPtr(4),
+		Hospitalized:      vartypes.IntPtr(5),
+		HospitalizedInIcu: vartypes.IntPtr(6),
+		PassedAway:        vartypes.IntPtr(7),
+		Recovered:         vartypes.IntPtr(8),
+		TreatedAtHome:     vartypes.IntPtr(9),
 	}, {
 		Date:              time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
 		Category:          "18-39",
-		Cases:             10,
-		Deaths:            11,
-		Intensive:         12,
-		Discharged:        13,
-		Hospitalized:      14,
-		HospitalizedInIcu: 15,
-		PassedAway:        16,
-		Recovered:         17,
-		TreatedAtHome:     18,
+		Cases:             vartypes.IntPtr(10),
+		Deaths:            vartypes.IntPtr(11),
+		Intensive:         vartypes.IntPtr(12),
+		Discharged:        vartypes.IntPtr(13),
+		Hospitalized:      vartypes.IntPtr(14),
+		HospitalizedInIcu: vartypes.IntPtr(15),
+		PassedAway:        vartypes.IntPtr(16),
+		Recovered:         vartypes.IntPtr(17),
+		TreatedAtHome:     vartypes.IntPtr(18),
 	}}
 	s.repo.EXPECT().GetDemographicInfo(gomock.Any(), data.DemographicFilter{
 		DatesFilter: data.DatesFilter{
@@ -412,3 +599,475 @@ func (s *ApiSuite) TestGetDemographics() {
 	assert.Nil(s.T(), err)
 	assert.Equal(s.T(), expected, info)
 }
+
+func (s *ApiSuite) TestGetIngestionsUnauthorized() {
+	req, _ := http.NewRequest(http.MethodGet, "/admin/ingestions", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 401, w.Code)
+}
+
+func (s *ApiSuite) TestGetIngestions() {
+	finished := time.Date(2022, 1, 1, 10, 5, 0, 0, time.UTC)
+	expected := []data.IngestionRun{{
+		Id:         2,
+		Trigger:    data.TriggerRefresh,
+		StartedAt:  time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		FinishedAt: &finished,
+		Status:     data.StatusSucceeded,
+	}, {
+		Id:        1,
+		Trigger:   data.TriggerSchedule,
+		StartedAt: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		Status:    data.StatusRunning,
+	}}
+	s.repo.EXPECT().GetIngestionRuns(gomock.Any()).Times(1).Return(expected, nil)
+	req, _ := http.NewRequest(http.MethodGet, "/admin/ingestions", nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(s.T(), 200, w.Code)
+	bodyBytes, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	assert.Nil(s.T(), err)
+
+	var runs []data.IngestionRun
+	err = json.Unmarshal(bodyBytes, &runs)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), expected, runs)
+}
+
+func (s *ApiSuite) TestGetIngestion() {
+	expected := data.IngestionRun{
+		Id:        3,
+		Trigger:   data.TriggerSchedule,
+		StartedAt: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		Status:    data.StatusFailed,
+		Error:     "error populating timeline: boom",
+		Steps: []data.IngestionStep{{
+			Id:         1,
+			RunId:      3,
+			Dataset:    data.DatasetTimeline,
+			StartedAt:  time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+			FinishedAt: time.Date(2022, 1, 1, 9, 1, 0, 0, time.UTC),
+			Status:     data.StatusFailed,
+			StepStats:  data.StepStats{RowsRead: 10},
+			SourceUrl:  "https://example.com/timeline.csv",
+			Error:      "boom",
+		}},
+	}
+	s.repo.EXPECT().GetIngestionRun(gomock.Any(), 3).Times(1).Return(expected, nil)
+	req, _ := http.NewRequest(http.MethodGet, "/admin/ingestions/3", nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(s.T(), 200, w.Code)
+	bodyBytes, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	assert.Nil(s.T(), err)
+
+	var run data.IngestionRun
+	err = json.Unmarshal(bodyBytes, &run)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), expected, run)
+}
+
+func (s *ApiSuite) TestGetIngestionNotFound() {
+	s.repo.EXPECT().GetIngestionRun(gomock.Any(), 404).Times(1).Return(data.IngestionRun{}, data.ErrNotFound)
+	req, _ := http.NewRequest(http.MethodGet, "/admin/ingestions/404", nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 404, w.Code)
+}
+
+func (s *ApiSuite) TestGetChanges() {
+	revisions := []data.Revision{{
+		Id:             3,
+		Dataset:        data.DatasetCases,
+		Key:            map[string]interface{}{"regional_unit_id": float64(3), "date": "2022-01-01"},
+		Field:          "cases",
+		OldValue:       vartypes.StringPtr("10"),
+		NewValue:       vartypes.StringPtr("12"),
+		IngestionRunId: vartypes.IntPtr(7),
+		RecordedAt:     time.Date(2022, 2, 1, 9, 0, 0, 0, time.UTC),
+	}, {
+		Id:         2,
+		Dataset:    data.DatasetCases,
+		Key:        map[string]interface{}{"regional_unit_id": float64(4), "date": "2022-01-01"},
+		Field:      "cases",
+		OldValue:   nil,
+		NewValue:   vartypes.StringPtr("5"),
+		RecordedAt: time.Date(2022, 2, 1, 9, 0, 0, 0, time.UTC),
+	}}
+	// only the page asked for is read
+	s.repo.EXPECT().GetRevisions(gomock.Any(), data.RevisionFilter{
+		Dataset: data.DatasetCases,
+		Since:   time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		Limit:   1,
+		Offset:  1,
+	}).Times(1).Return(revisions[1:], nil)
+	req, _ := http.NewRequest(http.MethodGet, "/changes?dataset=cases&since=2022-02-01&per_page=1&page=2", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var changes []data.Revision
+	err := json.Unmarshal(w.Body.Bytes(), &changes)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), revisions[1:], changes)
+
+	req, _ = http.NewRequest(http.MethodGet, "/changes?since=yesterday", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 400, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "invalid since")
+}
+
+func (s *ApiSuite) TestGetWaste() {
+	measurements := []data.WasteMeasurement{{
+		SiteId:     1,
+		Site:       "Αθήνα",
+		SiteEn:     "Athens",
+		Year:       2022,
+		Week:       3,
+		WeekStart:  time.Date(2022, 1, 17, 0, 0, 0, 0, time.UTC),
+		WeekEnd:    time.Date(2022, 1, 23, 0, 0, 0, 0, time.UTC),
+		Percentage: 12.5,
+	}}
+	s.repo.EXPECT().GetWaste(gomock.Any(), data.WasteFilter{
+		DatesFilter: data.DatesFilter{StartDate: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Site:        "athena",
+		StartWeek:   data.YearWeek{Year: 2022, Week: 1},
+		EndWeek:     data.YearWeek{Year: 2022, Week: 10},
+	}).Times(1).Return(measurements, nil)
+	req, _ := http.NewRequest(http.MethodGet,
+		"/waste?site=athena&start_week=2022-1&end_week=2022-10&start_date=2022-01-01", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var res []data.WasteMeasurement
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), measurements, res)
+
+	req, _ = http.NewRequest(http.MethodGet, "/waste?start_week=2022-60", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 400, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "invalid start_week")
+}
+
+func (s *ApiSuite) TestGetVaccinations() {
+	vaccinations := []data.Vaccination{{
+		RegionalUnitId: vartypes.IntPtr(2),
+		Date:           time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Dose:           1,
+		Doses:          vartypes.IntPtr(20),
+	}, {
+		RegionalUnitId: vartypes.IntPtr(2),
+		Date:           time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Dose:           2,
+	}}
+	s.repo.EXPECT().GetVaccinations(gomock.Any(), data.VaccinationsFilter{
+		DatesFilter: data.DatesFilter{
+			StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC),
+		},
+		RegionalUnitId: 2,
+	}).Times(1).Return(vaccinations, nil)
+	req, _ := http.NewRequest(http.MethodGet,
+		"/vaccinations?regional_unit_id=2&start_date=2021-01-01&end_date=2021-01-31", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var res []data.Vaccination
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), vaccinations, res)
+
+	national := []data.Vaccination{{
+		Date:  time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Dose:  1,
+		Doses: vartypes.IntPtr(30),
+	}}
+	s.repo.EXPECT().GetVaccinations(gomock.Any(), data.VaccinationsFilter{National: true}).Times(1).
+		Return(national, nil)
+	req, _ = http.NewRequest(http.MethodGet, "/vaccinations?national=true", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+	assert.Contains(s.T(), w.Body.String(), `"regional_unit_id":null`)
+
+	req, _ = http.NewRequest(http.MethodGet, "/vaccinations?national=true&regional_unit_id=2", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 400, w.Code)
+}
+
+func (s *ApiSuite) TestGetDatasetRows() {
+	def, ok := s.api.dataSrv.Dataset("cases_per_county")
+	assert.True(s.T(), ok)
+	records := []map[string]interface{}{
+		{"county": "County_1", "population": 10000, "date": "2020-02-26T00:00:00Z", "cases": 1},
+	}
+	s.repo.EXPECT().GetDatasetRows(gomock.Any(), def, data.DatesFilter{
+		StartDate: time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC),
+	}).Times(1).Return(records, nil)
+	req, _ := http.NewRequest(http.MethodGet, "/datasets/cases_per_county?start_date=2020-02-26", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+	assert.JSONEq(s.T(), `[{"county":"County_1","population":10000,"date":"2020-02-26T00:00:00Z","cases":1}]`,
+		w.Body.String())
+
+	// the long dataset has no date field
+	req, _ = http.NewRequest(http.MethodGet, "/datasets/first_doses?start_date=2021-01-01", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 400, w.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/datasets/unknown", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 404, w.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/datasets", nil)
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+	assert.Contains(s.T(), w.Body.String(), `"name":"first_doses"`)
+}
+
+func (s *ApiSuite) TestGetQuarantine() {
+	expected := []data.QuarantinedValue{{
+		Id:             1,
+		Dataset:        data.DatasetTimeline,
+		Date:           time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Field:          "deaths_cum",
+		Value:          100,
+		PublishedValue: vartypes.FloatPtr(30000),
+		Reason:         "cumulative value decreased from 30000",
+		Status:         data.QuarantinePending,
+		DetectedAt:     time.Date(2022, 1, 2, 9, 0, 0, 0, time.UTC),
+	}}
+	s.repo.EXPECT().GetQuarantinedValues(gomock.Any(), data.QuarantineFilter{Status: data.QuarantinePending}).
+		Times(1).Return(expected, nil)
+	req, _ := http.NewRequest(http.MethodGet, "/admin/quarantine?status=pending", nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var values []data.QuarantinedValue
+	err := json.Unmarshal(w.Body.Bytes(), &values)
+	assert.Nil(s.T(), err)
+	assert.EqualValues(s.T(), expected, values)
+}
+
+func (s *ApiSuite) TestApproveQuarantined() {
+	date := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.repo.ExpectTx().Times(1)
+	s.repo.EXPECT().GetQuarantinedValue(gomock.Any(), 1).Times(1).Return(data.QuarantinedValue{
+		Id: 1, Dataset: data.DatasetTimeline, Date: date, Field: "cases", Value: 40000, Status: data.QuarantinePending,
+	}, nil)
+	s.repo.EXPECT().SetTimelineValue(gomock.Any(), date, "cases", vartypes.FloatPtr(40000)).Times(1)
+	s.repo.EXPECT().ResolveQuarantinedValue(gomock.Any(), 1, data.QuarantineApproved, gomock.Any()).Times(1)
+	req, _ := http.NewRequest(http.MethodPost, "/admin/quarantine/1/approve", nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 200, w.Code)
+
+	var q data.QuarantinedValue
+	err := json.Unmarshal(w.Body.Bytes(), &q)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), data.QuarantineApproved, q.Status)
+}
+
+func (s *ApiSuite) TestRejectQuarantinedWithoutPublishedValue() {
+	get := func() {
+		req, _ := http.NewRequest(http.MethodGet, "/timeline", nil)
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		assert.Equal(s.T(), 200, w.Code)
+	}
+	reject := func(id int) {
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/admin/quarantine/%d/reject", id), nil)
+		req.Header.Set("Authorization", "Bearer abcd")
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		assert.Equal(s.T(), 200, w.Code)
+	}
+	date := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.repo.ExpectTx().Times(2)
+	s.repo.EXPECT().GetQuarantinedValue(gomock.Any(), 1).Times(1).Return(data.QuarantinedValue{
+		Id: 1, Dataset: data.DatasetTimeline, Date: date, Field: "cases", Value: 40000,
+		PublishedValue: vartypes.FloatPtr(400), Status: data.QuarantinePending,
+	}, nil)
+	s.repo.EXPECT().GetQuarantinedValue(gomock.Any(), 2).Times(1).Return(data.QuarantinedValue{
+		Id: 2, Dataset: data.DatasetTimeline, Date: date, Field: "deaths", Value: 900, Status: data.QuarantinePending,
+	}, nil)
+	s.repo.EXPECT().SetTimelineValue(gomock.Any(), date, "deaths", nil).Times(1)
+	s.repo.EXPECT().ResolveQuarantinedValue(gomock.Any(), gomock.Any(), data.QuarantineRejected, gomock.Any()).
+		Times(2)
+	s.repo.EXPECT().GetFromTimeline(gomock.Any(), data.DatesFilter{}).Times(2).Return(nil, nil)
+
+	// rejecting a value in favour of the published one leaves the timeline as it was
+	get()
+	reject(1)
+	get()
+	// while clearing a value builds it again
+	reject(2)
+	get()
+}
+
+func (s *ApiSuite) TestRejectQuarantinedErrors() {
+	s.repo.ExpectTx().Times(2)
+	s.repo.EXPECT().GetQuarantinedValue(gomock.Any(), 2).Times(1).Return(data.QuarantinedValue{}, data.ErrNotFound)
+	s.repo.EXPECT().GetQuarantinedValue(gomock.Any(), 3).Times(1).Return(
+		data.QuarantinedValue{Id: 3, Status: data.QuarantineApproved}, nil)
+	for id, code := range map[string]int{"2": 404, "3": 409} {
+		req, _ := http.NewRequest(http.MethodPost, "/admin/quarantine/"+id+"/reject", nil)
+		req.Header.Set("Authorization", "Bearer abcd")
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		assert.Equal(s.T(), code, w.Code, id)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/admin/quarantine/1/reject", nil)
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), 401, w.Code)
+}
+
+func (s *ApiSuite) TestFlushDatasetsKeepsUnchangedResponses() {
+	filter := func(regionalUnitId int) data.VaccinationsFilter {
+		return data.VaccinationsFilter{RegionalUnitId: regionalUnitId}
+	}
+	get := func(url string) {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		assert.Equal(s.T(), 200, w.Code)
+	}
+
+	// the first requests are cached
+	s.repo.EXPECT().GetVaccinations(gomock.Any(), filter(91)).Times(2).Return(nil, nil)
+	s.repo.EXPECT().GetCases(gomock.Any(), data.CasesFilter{RegionalUnitId: 91}).Times(1).Return(nil, nil)
+	get("/vaccinations?regional_unit_id=91")
+	get("/cases?regional_unit_id=91")
+	get("/vaccinations?regional_unit_id=91")
+	get("/cases?regional_unit_id=91")
+
+	// only responses of vaccinations are built again after they change
+	s.api.flushDatasets(data.DatasetVaccinations)
+	get("/vaccinations?regional_unit_id=91")
+	get("/cases?regional_unit_id=91")
+}
+
+func (s *ApiSuite) TestGetSchedule() {
+	get := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/admin/schedule", nil)
+		req.Header.Set("Authorization", "Bearer abcd")
+		w := httptest.NewRecorder()
+		s.api.Router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(s.T(), 404, get().Code)
+
+	scheduler, err := data.NewScheduler(s.api.dataSrv, map[string]string{
+		data.DatasetTimeline: "@hourly",
+		"first_doses":        "0 4 * * *",
+	}, time.UTC)
+	assert.Nil(s.T(), err)
+	s.api.SetScheduler(scheduler)
+	defer s.api.SetScheduler(nil)
+
+	w := get()
+	assert.Equal(s.T(), 200, w.Code)
+	var res []data.ScheduledRun
+	assert.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(s.T(), res, 2)
+	assert.False(s.T(), res[1].Next.Before(res[0].Next))
+	for _, run := range res {
+		assert.Contains(s.T(), []string{data.DatasetTimeline, "first_doses"}, run.Dataset)
+		assert.True(s.T(), run.Next.After(time.Now()))
+	}
+}
+
+func (s *ApiSuite) TestRefresh() {
+	s.repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, _ bool, fn func() error) (bool, error) {
+			return true, fn()
+		})
+	// the run stops right away, as nothing else is expected to be written
+	s.repo.EXPECT().CreateIngestionRun(gomock.Any(), gomock.Any()).Times(1).Return(errors.New("database is down"))
+	req, _ := http.NewRequest(http.MethodGet, "/refresh", nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusAccepted, w.Code)
+	s.api.dataSrv.WaitRuns()
+
+	var res RefreshResp
+	assert.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(s.T(), data.RunStarted, res.Outcome)
+}
+
+func (s *ApiSuite) TestAdminRefresh() {
+	s.repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, _ bool, fn func() error) (bool, error) {
+			return true, fn()
+		})
+	// the run stops right away, as nothing else is expected to be written
+	s.repo.EXPECT().CreateIngestionRun(gomock.Any(), gomock.Any()).Times(1).Return(errors.New("database is down"))
+	req, _ := http.NewRequest(http.MethodPost, "/admin/refresh", strings.NewReader(`{"datasets": ["cases"]}`))
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusAccepted, w.Code)
+	s.api.dataSrv.WaitRuns()
+
+	var res RefreshResp
+	assert.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(s.T(), data.RunStarted, res.Outcome)
+	assert.Equal(s.T(), fmt.Sprintf("/admin/jobs/%d", res.JobId), w.Header().Get("Location"))
+
+	// the failure shows in the job
+	req, _ = http.NewRequest(http.MethodGet, w.Header().Get("Location"), nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	var job data.Job
+	assert.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(s.T(), res.JobId, job.Id)
+	assert.Equal(s.T(), data.StatusFailed, job.Status)
+	assert.Equal(s.T(), []data.DatasetProgress{{Dataset: data.DatasetCases, Status: data.StatusFailed}}, job.Datasets)
+
+	// finished jobs cannot be cancelled
+	req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/admin/jobs/%d/cancel", res.JobId), nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusConflict, w.Code)
+}
+
+func (s *ApiSuite) TestRefreshRejectsUnknownDatasets() {
+	req, _ := http.NewRequest(http.MethodPost, "/admin/refresh", strings.NewReader(`{"datasets": ["measles"]}`))
+	req.Header.Set("Authorization", "Bearer abcd")
+	w := httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/jobs/1000", nil)
+	req.Header.Set("Authorization", "Bearer abcd")
+	w = httptest.NewRecorder()
+	s.api.Router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"covid19-greece-api/internal/config"
+	"covid19-greece-api/internal/data"
+	"covid19-greece-api/pkg/db"
+)
+
+// export writes the contents of the database to a bundle file
+func export(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flagSet("export", "file", "Exports the database contents to a bundle file, a zip of a CSV file per table "+
+		"and a manifest")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	path := fs.Arg(0)
+
+	repo, srv, version, err := bundleService(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	// the bundle is written next to its file, so that a failed export leaves no partial bundle behind
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot create bundle: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var manifest data.BundleManifest
+	// populations change the database while it is exported, so this waits for any of them to finish
+	_, err = repo.WithIngestionLock(ctx, true, func() error {
+		manifest, err = srv.ExportBundle(ctx, tmp, version)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write bundle: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot write bundle: %s", err)
+	}
+
+	for _, t := range manifest.Tables {
+		log.Printf("%s: %d rows exported", t.Name, t.Rows)
+	}
+	log.Printf("database exported to %s (schema version %d)", path, manifest.SchemaVersion)
+	return nil
+}
+
+// importBundle restores a bundle file into an empty database
+func importBundle(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flagSet("import", "file", "Imports a bundle file exported before into an empty database")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	path := fs.Arg(0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open bundle: %s", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot open bundle: %s", err)
+	}
+
+	repo, srv, version, err := bundleService(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	var manifest data.BundleManifest
+	_, err = repo.WithIngestionLock(ctx, true, func() error {
+		manifest, err = srv.ImportBundle(ctx, f, info.Size(), version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot import %s: %s", path, err)
+	}
+
+	for _, t := range manifest.Tables {
+		log.Printf("%s: %d rows imported", t.Name, t.Rows)
+	}
+	log.Printf("database imported from %s, exported at %s", path, manifest.CreatedAt.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// bundleService connects to the database, migrated up, and returns its repository, its data service and its schema
+// version
+func bundleService(ctx context.Context, cfg *config.Config) (*data.PgRepo, *data.Service, uint, error) {
+	repo, err := newRepo(ctx, cfg)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	srv, err := newService(cfg, repo)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	m, err := db.NewMigrator(cfg.Database.Dsn, cfg.Database.MigrationsDir)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer m.Close()
+	version, dirty, err := m.Status()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if dirty {
+		return nil, nil, 0, fmt.Errorf("schema version %d is dirty, fix it with the migrate command first", version)
+	}
+	return repo, srv, version, nil
+}
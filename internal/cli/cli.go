@@ -0,0 +1,231 @@
+// Package cli implements the commands of the API binary: serving the API, populating, validating, migrating,
+// exporting and importing the database. All of them share the configuration of the config package.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"covid19-greece-api/internal/config"
+	"covid19-greece-api/internal/data"
+	"covid19-greece-api/pkg/db"
+	"covid19-greece-api/pkg/file"
+)
+
+// command is a subcommand of the binary
+type command struct {
+	name string
+	// args describes the arguments of the command, for the usage
+	args  string
+	short string
+	run   func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+var commands = []command{
+	{"serve", "", "serves the API, populating the database on schedule (the default command)", serve},
+	{"populate", "[-only datasets] [-skip datasets] [-dry-run [-max-changed percent]]",
+		"populates the database once", populate},
+	{"validate", "", "validates the data sources against their contracts, without loading them", validate},
+	{"migrate", "up | down [steps] | status | goto version", "migrates the database schema", migrate},
+	{"config", "print", "prints the effective configuration, without its secrets", printConfig},
+	{"export", "file", "exports the database contents to a bundle", export},
+	{"import", "file", "imports a bundle into an empty database", importBundle},
+}
+
+// errUsage reports invalid arguments, after the usage has been printed
+var errUsage = errors.New("invalid arguments")
+
+// Run runs the command named by the first of args after the global flags, serve if none is given, and returns the exit
+// code of the binary. Commands are cancelled on interrupt.
+func Run(args []string) int {
+	global := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configFile := global.String("config", os.Getenv("CONFIG_FILE"),
+		"YAML configuration `file`, overridden by environment variables (default $CONFIG_FILE)")
+	global.Usage = func() {
+		usage(global.Output())
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	args = global.Args()
+
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		global.SetOutput(os.Stdout)
+		global.Usage()
+		return 0
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP,
+		syscall.SIGQUIT)
+	defer stop()
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Printf("ERROR: %s", err)
+		return 1
+	}
+	err = cmd.run(ctx, cfg, args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case err != nil:
+		log.Printf("ERROR: %s", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [-config file] <command> [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.short)
+		if cmd.args != "" {
+			fmt.Fprintf(w, "  %-9s   %s %s\n", "", cmd.name, cmd.args)
+		}
+	}
+	fmt.Fprintf(w, "\nRun %s <command> -h for the flags of a command.\n\nFlags:\n", os.Args[0])
+}
+
+// flagSet returns the flags of a command, printing the usage of the command on errors
+func flagSet(name, args, short string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s.\n\n", os.Args[0], name, args, short)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the flags of a command, turning parsing errors into errUsage, since they are already printed
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// sources parses the sources of the built-in datasets
+func sources(cfg *config.Config) (data.Sources, error) {
+	var res data.Sources
+	for _, src := range []struct {
+		name   string
+		uri    string
+		source *file.Source
+	}{
+		{data.DatasetCases, cfg.Sources.Cases, &res.Cases},
+		{data.DatasetTimeline, cfg.Sources.Timeline, &res.Timeline},
+		{data.DatasetDeathsPerMunicipality, cfg.Sources.DeathsPerMunicipality, &res.DeathsPerMunicipality},
+		{data.DatasetDemographics, cfg.Sources.Demographics, &res.Demographics},
+		{data.DatasetWaste, cfg.Sources.Waste, &res.Waste},
+		{data.DatasetVaccinations, cfg.Sources.Vaccinations, &res.Vaccinations},
+	} {
+		// vaccinations are the only optional source
+		if src.uri == "" && src.name == data.DatasetVaccinations {
+			continue
+		}
+		s, err := file.ParseSource(src.uri)
+		if err != nil {
+			return res, fmt.Errorf("invalid source of %s: %s", src.name, err)
+		}
+		*src.source = s
+	}
+	return res, nil
+}
+
+// registry loads the datasets of the registry file, if any
+func registry(cfg *config.Config) ([]data.DatasetDefinition, error) {
+	if cfg.Sources.RegistryFile == "" {
+		return nil, nil
+	}
+	return data.LoadRegistry(cfg.Sources.RegistryFile)
+}
+
+// newRepo connects to the database, migrating it up first
+func newRepo(ctx context.Context, cfg *config.Config) (*data.PgRepo, error) {
+	dbConn, err := db.InitPostgresDb(ctx, cfg.Database.Dsn, cfg.Database.MigrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start pg connection: %s", err)
+	}
+	repo, err := data.NewPgRepo(dbConn, cfg.Database.MunicipalitiesFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize data repository: %s", err)
+	}
+	return repo, nil
+}
+
+// newService initializes the data service of repo, along with the datasets of the registry
+func newService(cfg *config.Config, repo data.Repo) (*data.Service, error) {
+	srcs, err := sources(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := registry(cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv, err := data.NewService(repo, srcs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot init data manager: %s", err)
+	}
+	srv.SetAnomalyConfig(data.AnomalyConfig{StdDevs: cfg.Anomalies.StdDevs, Window: cfg.Anomalies.Window,
+		MinBaseline: cfg.Anomalies.MinBaseline})
+	srv.RegisterDatasets(defs)
+	srv.SetTimeouts(data.Timeouts{Default: cfg.Population.StepTimeout, Datasets: cfg.Population.StepTimeouts})
+	return srv, nil
+}
+
+// splitList splits a comma separated list, ignoring blanks
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// printConfig prints the effective configuration, in the format of the configuration file
+func printConfig(_ context.Context, cfg *config.Config, args []string) error {
+	fs := flagSet("config", "print", "Prints the effective configuration, with its secrets redacted")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.Arg(0) != "print" || fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+	fmt.Print(cfg.Redacted())
+	return nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"covid19-greece-api/internal/config"
+	"covid19-greece-api/pkg/db"
+)
+
+// migrate moves the schema of the database up, down or to a version, or prints its version
+func migrate(_ context.Context, cfg *config.Config, args []string) error {
+	fs := flagSet("migrate", "up | down [steps] | status | goto version", "Migrates the database schema "+
+		"with the migrations of database.migrations_dir (MIGRATIONS_DIR). down reverts the last migration, unless given more steps")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	// number parses the argument of down or goto, which defaults to def
+	number := func(def int) (int, error) {
+		if len(args) < 2 {
+			if def < 0 {
+				return 0, fmt.Errorf("%s needs a number", args[0])
+			}
+			return def, nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid argument %q of %s", args[1], args[0])
+		}
+		return n, nil
+	}
+
+	m, err := db.NewMigrator(cfg.Database.Dsn, cfg.Database.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	switch args[0] {
+	case "up":
+		err = m.Up()
+	case "down":
+		var steps int
+		if steps, err = number(1); err == nil {
+			err = m.Down(steps)
+		}
+	case "goto":
+		var version int
+		if version, err = number(-1); err == nil {
+			err = m.Goto(uint(version))
+		}
+	case "status":
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := m.Status()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		fmt.Printf("version %d, dirty: the last migration failed and has to be fixed by hand\n", version)
+	} else {
+		fmt.Printf("version %d\n", version)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"covid19-greece-api/internal/config"
+	"covid19-greece-api/internal/data"
+)
+
+// populateStep populates a dataset on its own
+type populateStep struct {
+	dataset  string
+	populate func(ctx context.Context) error
+}
+
+// populateSteps returns the datasets the populate command can load, in the order they are loaded in. Unlike ingestion
+// runs, waste is a dataset of its own, so that it can be loaded or skipped apart from the timeline.
+func populateSteps(srv *data.Service) []populateStep {
+	steps := []populateStep{
+		{data.DatasetCases, func(ctx context.Context) error {
+			if err := srv.PopulateRegionalUnits(ctx); err != nil {
+				return err
+			}
+			return srv.PopulateCases(ctx)
+		}},
+		{data.DatasetWaste, srv.PopulateWaste},
+		{data.DatasetTimeline, srv.PopulateTimeline},
+		{data.DatasetDeathsPerMunicipality, srv.PopulateDeathsPerMunicipality},
+		{data.DatasetDemographics, srv.PopulateDemographic},
+	}
+	for _, name := range srv.DatasetNames() {
+		switch name {
+		case data.DatasetCases, data.DatasetTimeline, data.DatasetDeathsPerMunicipality, data.DatasetDemographics:
+		case data.DatasetVaccinations:
+			// vaccinations are stored per regional unit, so they are populated after the cases
+			steps = append(steps, populateStep{name, srv.PopulateVaccinations})
+		default:
+			name := name
+			steps = append(steps, populateStep{name, func(ctx context.Context) error {
+				return srv.PopulateDataset(ctx, name)
+			}})
+		}
+	}
+	return steps
+}
+
+// selectDatasets returns the datasets of names to populate: those of only, or all of them if only is empty, except
+// those of skip.
+func selectDatasets(names, only, skip []string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = len(only) == 0
+	}
+	for _, list := range []struct {
+		names []string
+		value bool
+	}{{only, true}, {skip, false}} {
+		for _, name := range list.names {
+			if _, ok := selected[name]; !ok {
+				return nil, fmt.Errorf("unknown dataset %s, use one of %s", name, strings.Join(names, ", "))
+			}
+			selected[name] = list.value
+		}
+	}
+	return selected, nil
+}
+
+// populate populates the selected datasets once, or compares them with the database on a dry run
+func populate(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flagSet("populate", "[flags]", "Populates the database once, with the datasets of all sources")
+	only := fs.String("only", "", "comma separated datasets to populate, instead of all of them")
+	skip := fs.String("skip", "", "comma separated datasets not to populate")
+	dryRun := fs.Bool("dry-run", false, "compares the sources with the database without writing anything")
+	maxChanged := fs.Float64("max-changed", 10,
+		"with dry-run, fails if any table would change more than this percentage of its existing rows")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	repo, err := newRepo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	dataManager, err := newService(cfg, repo)
+	if err != nil {
+		return err
+	}
+	steps := populateSteps(dataManager)
+	var names []string
+	for _, st := range steps {
+		names = append(names, st.dataset)
+	}
+	selected, err := selectDatasets(names, splitList(*only), splitList(*skip))
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		var registry []string
+		for _, name := range names {
+			if _, ok := dataManager.Dataset(name); ok && selected[name] {
+				registry = append(registry, name)
+			}
+		}
+		return diff(ctx, dataManager, data.Steps{
+			RegionalUnits:         selected[data.DatasetCases],
+			Cases:                 selected[data.DatasetCases],
+			Waste:                 selected[data.DatasetWaste],
+			Timeline:              selected[data.DatasetTimeline],
+			DeathsPerMunicipality: selected[data.DatasetDeathsPerMunicipality],
+			Demographics:          selected[data.DatasetDemographics],
+			Vaccinations:          selected[data.DatasetVaccinations],
+			Registry:              registry,
+		}, *maxChanged)
+	}
+
+	// the API of a running replica may be populating the database as well, so this waits for it to finish
+	_, err = repo.WithIngestionLock(ctx, true, func() error {
+		for _, st := range steps {
+			if !selected[st.dataset] {
+				continue
+			}
+			if err := st.populate(ctx); err != nil {
+				return fmt.Errorf("cannot populate %s: %s", st.dataset, err)
+			}
+			log.Printf("%s populated", st.dataset)
+		}
+		// regional units and municipalities are added by different datasets, so they are linked once both are done
+		if selected[data.DatasetCases] || selected[data.DatasetDeathsPerMunicipality] {
+			return dataManager.SyncHierarchy(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Finished after %v", time.Since(start))
+	return nil
+}
+
+// diff prints what populating the database would change, without writing anything. It fails if the dry run fails or
+// any table would change more than maxChanged percent of its rows.
+func diff(ctx context.Context, dataManager *data.Service, steps data.Steps, maxChanged float64) error {
+	report, err := dataManager.DryRun(ctx, steps)
+	fmt.Print(report)
+	if err != nil {
+		return err
+	}
+	if tables := report.Exceeds(maxChanged); len(tables) > 0 {
+		return fmt.Errorf("tables %v would change more than %v%% of their rows", tables, maxChanged)
+	}
+	return nil
+}
+
+// validate prints the validation reports of all sources, without touching the database. It fails if any source
+// breaks its contract.
+func validate(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flagSet("validate", "", "Validates the data sources against their contracts, without loading them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	srcs, err := sources(cfg)
+	if err != nil {
+		return err
+	}
+	defs, err := registry(cfg)
+	if err != nil {
+		return err
+	}
+	reports, err := data.ValidateSources(ctx, srcs, defs)
+	for _, r := range reports {
+		fmt.Print(r)
+	}
+	if err != nil {
+		return err
+	}
+	var invalid []string
+	for _, r := range reports {
+		if !r.Valid() {
+			invalid = append(invalid, r.Dataset)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("sources of %v break their contracts", invalid)
+	}
+	return nil
+}
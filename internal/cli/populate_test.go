@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"covid19-greece-api/internal/config"
+	"covid19-greece-api/internal/data"
+)
+
+func TestPopulateStepsLoadWasteOnItsOwn(t *testing.T) {
+	cfg := config.Default()
+	cfg.Sources.Vaccinations = "vaccinations.csv"
+	srv, err := newService(cfg, nil)
+	assert.Nil(t, err)
+
+	var names []string
+	for _, st := range populateSteps(srv) {
+		names = append(names, st.dataset)
+	}
+	assert.Equal(t, []string{data.DatasetCases, data.DatasetWaste, data.DatasetTimeline,
+		data.DatasetDeathsPerMunicipality, data.DatasetDemographics, data.DatasetVaccinations}, names)
+}
+
+func TestSelectDatasets(t *testing.T) {
+	names := []string{data.DatasetCases, data.DatasetWaste, data.DatasetTimeline}
+	for _, tc := range []struct {
+		only, skip string
+		expected   map[string]bool
+		err        bool
+	}{
+		{"", "", map[string]bool{"cases": true, "waste": true, "timeline": true}, false},
+		{"waste", "", map[string]bool{"cases": false, "waste": true, "timeline": false}, false},
+		{"", "waste", map[string]bool{"cases": true, "waste": false, "timeline": true}, false},
+		{"cases, timeline", "timeline", map[string]bool{"cases": true, "waste": false, "timeline": false}, false},
+		{"measles", "", nil, true},
+		{"", "measles", nil, true},
+	} {
+		selected, err := selectDatasets(names, splitList(tc.only), splitList(tc.skip))
+		assert.Equal(t, tc.err, err != nil, tc.only, tc.skip)
+		assert.Equal(t, tc.expected, selected, tc.only, tc.skip)
+	}
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"covid19-greece-api/internal/api"
+	"covid19-greece-api/internal/config"
+	"covid19-greece-api/internal/data"
+	"covid19-greece-api/pkg/db"
+)
+
+// dbStartTimeout is how long serve waits for the database to accept connections
+const dbStartTimeout = 30 * time.Second
+
+// serve serves the API until ctx is done, and then shuts it down gracefully
+func serve(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flagSet("serve", "", "Serves the API, populating the database on schedule")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if cfg.Auth.SecretToken == "" {
+		return fmt.Errorf("auth.secret_token (SECRET_TOKEN) is not set. Please give a safe secret token of at least "+
+			"%d characters", config.MinSecretTokenLength)
+	}
+
+	// the database may still be starting, e.g. when both are started by docker compose
+	if err := db.Wait(ctx, cfg.Database.Dsn, dbStartTimeout); err != nil {
+		return err
+	}
+
+	repo, err := newRepo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	// initialize data manager for database population
+	dataManager, err := newService(cfg, repo)
+	if err != nil {
+		return err
+	}
+
+	// population jobs outlive ctx, so that they are only cancelled once the server stopped accepting requests
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	// populate database with new data on schedule
+	var scheduler *data.Scheduler
+	schedulerDone := make(chan struct{})
+	if cfg.Population.Enabled {
+		scheduler, err = newScheduler(cfg, dataManager)
+		if err != nil {
+			return fmt.Errorf("cannot schedule database population: %s", err)
+		}
+		if cfg.Population.OnStart {
+			if _, _, err := dataManager.RequestRun(jobsCtx, data.TriggerSchedule); err != nil {
+				log.Printf("ERROR: database population failed: %s", err)
+			}
+		}
+		go func() {
+			defer close(schedulerDone)
+			scheduler.Run(jobsCtx)
+		}()
+	} else {
+		close(schedulerDone)
+	}
+
+	app := api.NewApi(jobsCtx, repo, dataManager, api.Options{
+		Secret:     cfg.Auth.SecretToken,
+		CacheTtl:   cfg.Cache.Ttl,
+		RateLimit:  cfg.RateLimit.Requests,
+		RateWindow: cfg.RateLimit.Window,
+	})
+	if scheduler != nil {
+		app.SetScheduler(scheduler)
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", cfg.Server.Port),
+		Handler: app.Router,
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+
+		log.Printf("received termination signal")
+
+		// if graceful shutdown lasts longer than 30sec, kill it
+		shutdownCtx, sdCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer sdCancel()
+
+		go func() {
+			<-shutdownCtx.Done()
+			if shutdownCtx.Err() == context.DeadlineExceeded {
+				log.Fatal("graceful shutdown timed out.. forcing exit.")
+			}
+		}()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			stopped <- fmt.Errorf("error while shutting down: %s", err)
+			return
+		}
+		// a population in progress is cancelled, and its transactions rolled back
+		cancelJobs()
+		<-schedulerDone
+		dataManager.WaitRuns()
+		stopped <- nil
+	}()
+
+	// Run the server
+	log.Printf("Starting COVID-19 API (port %d)...\n", cfg.Server.Port)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("error serving: %s", err)
+	}
+
+	// Wait for the server to be stopped
+	if err := <-stopped; err != nil {
+		return err
+	}
+
+	log.Printf("server was gracefully stopped. Bye!")
+	return nil
+}
+
+// newScheduler schedules every dataset by its own cron expression, or the one of all datasets. Datasets scheduled
+// "off" are not populated on schedule.
+func newScheduler(cfg *config.Config, srv *data.Service) (*data.Scheduler, error) {
+	names := srv.DatasetNames()
+	for dataset := range cfg.Population.Schedules {
+		if !contains(names, dataset) {
+			return nil, fmt.Errorf("cannot schedule unknown dataset %s", dataset)
+		}
+	}
+	schedules := make(map[string]string)
+	for _, name := range names {
+		expr, ok := cfg.Population.Schedules[name]
+		if !ok {
+			expr = cfg.Population.Schedule
+		}
+		if expr != config.ScheduleOff {
+			schedules[name] = expr
+		}
+	}
+	loc, err := time.LoadLocation(cfg.Population.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %s: %s", cfg.Population.Timezone, err)
+	}
+	return data.NewScheduler(srv, schedules, loc)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Values of the timeline are checked before they are published. Suspicious values are quarantined: they are not
+// written, and the published ones are kept, until an operator approves them.
+
+// AnomalyConfig tunes the checks of daily values against their baseline.
+type AnomalyConfig struct {
+	// StdDevs is how many standard deviations a daily value may be away from the mean of its baseline
+	StdDevs float64
+	// Window is the number of previous values forming the baseline
+	Window int
+	// MinBaseline is the number of previous values needed before daily values are checked
+	MinBaseline int
+}
+
+// DefaultAnomalyConfig is loose enough to let through a series doubling every two days.
+var DefaultAnomalyConfig = AnomalyConfig{StdDevs: 6, Window: 28, MinBaseline: 14}
+
+type seriesKind int
+
+const (
+	seriesDaily      seriesKind = iota // checked against a rolling baseline
+	seriesCumulative                   // never decreases
+	seriesPercentage                   // within 0-100
+)
+
+// timelineSeries is a field of the timeline that is checked for anomalies.
+type timelineSeries struct {
+	field string // column of greece_timeline
+	kind  seriesKind
+	get   func(fi *FullInfo) *float64
+	set   func(fi *FullInfo, v *float64)
+}
+
+func intSeries(field string, kind seriesKind, ptr func(fi *FullInfo) **int) timelineSeries {
+	return timelineSeries{
+		field: field,
+		kind:  kind,
+		get: func(fi *FullInfo) *float64 {
+			if v := *ptr(fi); v != nil {
+				f := float64(*v)
+				return &f
+			}
+			return nil
+		},
+		set: func(fi *FullInfo, v *float64) {
+			if v == nil {
+				*ptr(fi) = nil
+				return
+			}
+			i := int(*v)
+			*ptr(fi) = &i
+		},
+	}
+}
+
+func floatSeries(field string, kind seriesKind, ptr func(fi *FullInfo) **float64) timelineSeries {
+	return timelineSeries{
+		field: field,
+		kind:  kind,
+		get:   func(fi *FullInfo) *float64 { return *ptr(fi) },
+		set:   func(fi *FullInfo, v *float64) { *ptr(fi) = v },
+	}
+}
+
+var checkedSeries = []timelineSeries{
+	intSeries("cases", seriesDaily, func(fi *FullInfo) **int { return &fi.Cases }),
+	intSeries("deaths", seriesDaily, func(fi *FullInfo) **int { return &fi.Deaths }),
+	intSeries("recovered", seriesDaily, func(fi *FullInfo) **int { return &fi.Recovered }),
+	intSeries("hospital_admissions", seriesDaily, func(fi *FullInfo) **int { return &fi.HospitalAdmissions }),
+	intSeries("hospital_discharges", seriesDaily, func(fi *FullInfo) **int { return &fi.HospitalDischarges }),
+	intSeries("estimated_new_rtpcr_tests", seriesDaily, func(fi *FullInfo) **int { return &fi.EstimatedNewRtpcrTests }),
+	intSeries("estimated_new_rapid_tests", seriesDaily, func(fi *FullInfo) **int { return &fi.EstimatedNewRapidTests }),
+	intSeries("estimated_new_total_tests", seriesDaily, func(fi *FullInfo) **int { return &fi.EstimatedNewTotalTests }),
+	intSeries("deaths_cum", seriesCumulative, func(fi *FullInfo) **int { return &fi.DeathsCum }),
+	intSeries("cases_cum", seriesCumulative, func(fi *FullInfo) **int { return &fi.CasesCum }),
+	floatSeries("icu_occupancy", seriesPercentage, func(fi *FullInfo) **float64 { return &fi.IcuOccupancy }),
+	floatSeries("beds_occupancy", seriesPercentage, func(fi *FullInfo) **float64 { return &fi.BedsOccupancy }),
+}
+
+// checkedSeriesByField indexes checkedSeries by field
+func checkedSeriesByField() map[string]timelineSeries {
+	res := make(map[string]timelineSeries)
+	for _, s := range checkedSeries {
+		res[s.field] = s
+	}
+	return res
+}
+
+// Anomaly is a suspicious value of the timeline.
+type Anomaly struct {
+	Date   time.Time
+	Field  string
+	Value  float64
+	Reason string
+}
+
+// quarantineKey identifies a value of the timeline
+type quarantineKey struct {
+	date  string
+	field string
+}
+
+// detectAnomalies checks a timeline sorted by date. Values already known to the quarantine are not checked again:
+// approved ones are accepted, while pending and rejected ones are reported as long as the value is the same.
+// Anomalies do not become part of the baseline of the values that follow them.
+func detectAnomalies(infos []FullInfo, cfg AnomalyConfig, known map[quarantineKey]QuarantinedValue) []Anomaly {
+	var res []Anomaly
+	for _, s := range checkedSeries {
+		var accepted []float64
+		for i := range infos {
+			v := s.get(&infos[i])
+			if v == nil {
+				continue
+			}
+			date := infos[i].Date
+			reason := ""
+			if q, ok := known[quarantineKey{date.Format(simpleDateLayout), s.field}]; ok && q.Value == *v {
+				if q.Status != QuarantineApproved {
+					reason = q.Reason
+				}
+			} else {
+				reason = s.check(*v, accepted, cfg)
+			}
+			if len(reason) > 0 {
+				res = append(res, Anomaly{Date: date, Field: s.field, Value: *v, Reason: reason})
+				continue
+			}
+			accepted = append(accepted, *v)
+		}
+	}
+	return res
+}
+
+// check returns why v is suspicious, or an empty string if it is not. previous are the accepted values before it.
+func (s timelineSeries) check(v float64, previous []float64, cfg AnomalyConfig) string {
+	switch s.kind {
+	case seriesCumulative:
+		if len(previous) > 0 && v < previous[len(previous)-1] {
+			return fmt.Sprintf("cumulative value decreased from %v", previous[len(previous)-1])
+		}
+	case seriesPercentage:
+		if v < 0 || v > 100 {
+			return "percentage is outside 0-100"
+		}
+	case seriesDaily:
+		if len(previous) > cfg.Window {
+			previous = previous[len(previous)-cfg.Window:]
+		}
+		if len(previous) < cfg.MinBaseline || len(previous) == 0 {
+			return ""
+		}
+		mean, sd := meanStdDev(previous)
+		// a flat baseline would turn every change into an anomaly
+		if dev := math.Abs(v-mean) / math.Max(sd, 1); dev > cfg.StdDevs {
+			return fmt.Sprintf("%.1f standard deviations away from the mean %.1f of the previous %d values",
+				dev, mean, len(previous))
+		}
+	}
+	return ""
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"covid19-greece-api/pkg/vartypes"
+)
+
+// dailyTimeline returns a timeline starting at 2020-02-26, with the given daily cases
+func dailyTimeline(cases ...int) []FullInfo {
+	var infos []FullInfo
+	for i, c := range cases {
+		infos = append(infos, FullInfo{
+			Date:  time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i),
+			Cases: vartypes.IntPtr(c),
+		})
+	}
+	return infos
+}
+
+func TestDetectAnomaliesInCumulativeSeries(t *testing.T) {
+	infos := dailyTimeline(0, 0, 0, 0)
+	for i, v := range []int{10, 12, 11, 13} {
+		infos[i].DeathsCum = vartypes.IntPtr(v)
+	}
+	infos[2].DeathsCum = nil
+	infos[3].DeathsCum = vartypes.IntPtr(9)
+
+	anomalies := detectAnomalies(infos, DefaultAnomalyConfig, nil)
+	assert.Equal(t, []Anomaly{{Date: infos[3].Date, Field: "deaths_cum", Value: 9,
+		Reason: "cumulative value decreased from 12"}}, anomalies)
+}
+
+func TestDetectAnomaliesInPercentages(t *testing.T) {
+	infos := dailyTimeline(0, 0)
+	infos[0].IcuOccupancy = vartypes.FloatPtr(100)
+	infos[1].BedsOccupancy = vartypes.FloatPtr(180)
+
+	anomalies := detectAnomalies(infos, DefaultAnomalyConfig, nil)
+	assert.Len(t, anomalies, 1)
+	assert.Equal(t, "beds_occupancy", anomalies[0].Field)
+	assert.Equal(t, "percentage is outside 0-100", anomalies[0].Reason)
+}
+
+func TestDetectAnomaliesInDailySeries(t *testing.T) {
+	cfg := AnomalyConfig{StdDevs: 3, Window: 5, MinBaseline: 3}
+
+	// no baseline yet, then a typo and a value which would have been suspicious if the typo was part of the baseline
+	infos := dailyTimeline(1000, 9000, 100, 110, 90, 100, 100000, 104)
+	anomalies := detectAnomalies(infos, cfg, nil)
+	assert.Len(t, anomalies, 1)
+	assert.Equal(t, infos[6].Date, anomalies[0].Date)
+	assert.Equal(t, float64(100000), anomalies[0].Value)
+
+	// a flat baseline still allows small changes
+	assert.Empty(t, detectAnomalies(dailyTimeline(0, 0, 0, 0, 2), cfg, nil))
+}
+
+func TestDetectAnomaliesUsesDecisions(t *testing.T) {
+	cfg := AnomalyConfig{StdDevs: 3, Window: 5, MinBaseline: 3}
+	infos := dailyTimeline(100, 110, 90, 5000, 100)
+	known := map[quarantineKey]QuarantinedValue{
+		{"2020-02-29", "cases"}: {Value: 5000, Status: QuarantineApproved},
+		{"2020-02-26", "cases"}: {Value: 100, Status: QuarantineRejected, Reason: "rejected"},
+		// decided on a different value, the new one is checked again
+		{"2020-02-27", "cases"}: {Value: 111, Status: QuarantineRejected},
+	}
+
+	anomalies := detectAnomalies(infos, cfg, known)
+	assert.Equal(t, []Anomaly{{Date: infos[0].Date, Field: "cases", Value: 100, Reason: "rejected"}}, anomalies)
+}
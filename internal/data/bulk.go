@@ -0,0 +1,215 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Bulk loading: rows are copied into unlogged staging tables with COPY and then merged into the published tables
+// as their new current versions, with one statement recording the revised values, one closing the versions that
+// change and one inserting. Staged rows are visible only to the transaction that copied
+// them and are deleted after the merge, so concurrent loads of the same dataset do not see each other's rows.
+
+// StageBatchSize is the number of rows the service buffers before copying them into a staging table.
+const StageBatchSize = 5000
+
+// CaseRecord is a row of cases as read from the source, before regional units are resolved to their ids.
+type CaseRecord struct {
+	RegionalUnitSlug string
+	Date             time.Time
+	Cases            *int
+	PeriodStart      time.Time
+	PeriodEnd        time.Time
+	Cadence          Cadence
+}
+
+// MergeResult counts the rows written by a merge: new rows, and existing rows that got a new version.
+// Rows whose values did not change are not counted.
+type MergeResult struct {
+	Inserted int
+	Updated  int
+	// Revised counts the values of updated rows that changed
+	Revised int
+}
+
+var (
+	caseValueColumns     = []string{"cases", "period_start", "period_end", "cadence"}
+	timelineValueColumns = []string{"cases", "total_reinfections", "deaths", "deaths_cum", "recovered",
+		"beds_occupancy", "icu_occupancy", "intubated", "intubated_vac", "intubated_unvac", "hospital_admissions",
+		"hospital_discharges", "estimated_new_rtpcr_tests", "estimated_new_rapid_tests", "estimated_new_total_tests",
+		"cases_cum", "waste_highest_place", "waste_highest_percentage", "waste_highest_place_en"}
+	demographicValueColumns = []string{"cases", "deaths", "intensive", "discharged", "hospitalized",
+		"hospitalized_in_icu", "passed_away", "recovered", "treated_at_home"}
+)
+
+func (r *PgRepo) StageCases(ctx context.Context, cases []CaseRecord) error {
+	return r.stage(ctx, "staging_cases_per_regional_unit", append([]string{"regional_unit_slug", "date"},
+		caseValueColumns...), len(cases), func(i int) []interface{} {
+		c := cases[i]
+		return append([]interface{}{c.RegionalUnitSlug, c.Date}, caseValues(c.Cases, c.PeriodStart, c.PeriodEnd,
+			c.Cadence)...)
+	})
+}
+
+// MergeCases merges the staged cases. Cases of unknown regional units are dropped.
+func (r *PgRepo) MergeCases(ctx context.Context) (MergeResult, error) {
+	selectSql := `SELECT DISTINCT ON (ru.id, s.date) ru.id AS regional_unit_id, s.date, s.cases, s.period_start,
+	              s.period_end, s.cadence
+	              FROM staging_cases_per_regional_unit s JOIN regional_units ru ON ru.slug = s.regional_unit_slug
+	              ORDER BY ru.id, s.date, s.id DESC`
+	return r.merge(ctx, "staging_cases_per_regional_unit", mergeSql(DatasetCases, "cases_per_regional_unit",
+		[]string{"regional_unit_id", "date"}, caseValueColumns, selectSql))
+}
+
+func (r *PgRepo) StageTimeline(ctx context.Context, infos []FullInfo) error {
+	return r.stage(ctx, "staging_greece_timeline", append([]string{"date"}, timelineValueColumns...),
+		len(infos), func(i int) []interface{} {
+			return append([]interface{}{infos[i].Date}, timelineValues(infos[i])...)
+		})
+}
+
+// caseValues returns the values of cases in the order of caseValueColumns
+func caseValues(cases *int, periodStart, periodEnd time.Time, cadence Cadence) []interface{} {
+	return []interface{}{cases, periodStart, periodEnd, string(cadence)}
+}
+
+// timelineValues returns the values of fi in the order of timelineValueColumns
+func timelineValues(fi FullInfo) []interface{} {
+	return []interface{}{fi.Cases, fi.TotalReinfections, fi.Deaths, fi.DeathsCum, fi.Recovered,
+		fi.BedsOccupancy, fi.IcuOccupancy, fi.Intubated, fi.IntubatedVac, fi.IntubatedUnvac,
+		fi.HospitalAdmissions, fi.HospitalDischarges, fi.EstimatedNewRtpcrTests, fi.EstimatedNewRapidTests,
+		fi.EstimatedNewTotalTests, fi.CasesCum, fi.WasteHighestPlace, fi.WasteHighestPercent,
+		fi.WasteHighestPlaceEn}
+}
+
+func (r *PgRepo) MergeTimeline(ctx context.Context) (MergeResult, error) {
+	return r.merge(ctx, "staging_greece_timeline", mergeSql(DatasetTimeline, "greece_timeline", []string{"date"},
+		timelineValueColumns, stagedSql("staging_greece_timeline", []string{"date"}, timelineValueColumns)))
+}
+
+func (r *PgRepo) StageYearlyDeaths(ctx context.Context, deaths []YearlyDeaths) error {
+	return r.stage(ctx, "staging_deaths_per_municipality_cum", []string{"year", "municipality_id", "deaths_cum"},
+		len(deaths), func(i int) []interface{} {
+			d := deaths[i]
+			return []interface{}{d.Year, d.MunId, d.Deaths}
+		})
+}
+
+func (r *PgRepo) MergeYearlyDeaths(ctx context.Context) (MergeResult, error) {
+	keys := []string{"year", "municipality_id"}
+	return r.merge(ctx, "staging_deaths_per_municipality_cum", mergeSql(DatasetDeathsPerMunicipality,
+		"deaths_per_municipality_cum", keys, []string{"deaths_cum"},
+		stagedSql("staging_deaths_per_municipality_cum", keys, []string{"deaths_cum"})))
+}
+
+func (r *PgRepo) StageDemographicInfo(ctx context.Context, infos []DemographicInfo) error {
+	return r.stage(ctx, "staging_demography_per_age", append([]string{"date", "category"}, demographicValueColumns...),
+		len(infos), func(i int) []interface{} {
+			return append([]interface{}{infos[i].Date, infos[i].Category}, demographicValues(infos[i])...)
+		})
+}
+
+// demographicValues returns the values of info in the order of demographicValueColumns
+func demographicValues(info DemographicInfo) []interface{} {
+	return []interface{}{info.Cases, info.Deaths, info.Intensive, info.Discharged, info.Hospitalized,
+		info.HospitalizedInIcu, info.PassedAway, info.Recovered, info.TreatedAtHome}
+}
+
+func (r *PgRepo) MergeDemographicInfo(ctx context.Context) (MergeResult, error) {
+	keys := []string{"date", "category"}
+	return r.merge(ctx, "staging_demography_per_age", mergeSql(DatasetDemographics, "demography_per_age", keys,
+		demographicValueColumns, stagedSql("staging_demography_per_age", keys, demographicValueColumns)))
+}
+
+// stage copies n rows into a staging table
+func (r *PgRepo) stage(ctx context.Context, table string, columns []string, n int, row func(i int) []interface{}) error {
+	if n == 0 {
+		return nil
+	}
+	_, err := r.conn.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromSlice(n, func(i int) ([]interface{}, error) {
+		return row(i), nil
+	}))
+	if err != nil {
+		return fmt.Errorf("cannot copy into %s: %s", table, err)
+	}
+	return nil
+}
+
+// merge runs the statements built by mergeSql and empties the staging table they read from
+func (r *PgRepo) merge(ctx context.Context, staging string, m mergeStatements) (MergeResult, error) {
+	var res MergeResult
+	now, run := time.Now(), ingestionRun(ctx)
+	// revisions are compared with the current versions, so they are recorded before closing them
+	revised, err := r.conn.Exec(ctx, m.revisions, now, run)
+	if err != nil {
+		return res, fmt.Errorf("cannot record revisions of %s: %s", staging, err)
+	}
+	res.Revised = int(revised.RowsAffected())
+	closed, err := r.conn.Exec(ctx, m.close, now)
+	if err != nil {
+		return res, fmt.Errorf("cannot merge %s: %s", staging, err)
+	}
+	added, err := r.conn.Exec(ctx, m.insert, now, run)
+	if err != nil {
+		return res, fmt.Errorf("cannot merge %s: %s", staging, err)
+	}
+	// every closed version is replaced by a new one
+	res.Updated = int(closed.RowsAffected())
+	res.Inserted = int(added.RowsAffected()) - res.Updated
+	if _, err := r.conn.Exec(ctx, "DELETE FROM "+staging); err != nil {
+		return res, fmt.Errorf("cannot empty %s: %s", staging, err)
+	}
+	return res, nil
+}
+
+// stagedSql selects the rows of a staging table, keeping only the last one copied for every key,
+// as row-by-row upserts would do.
+func stagedSql(staging string, keys, values []string) string {
+	return fmt.Sprintf(`SELECT DISTINCT ON (%[2]s) %[2]s, %[3]s FROM %[1]s ORDER BY %[2]s, id DESC`,
+		staging, strings.Join(keys, ","), strings.Join(values, ","))
+}
+
+// mergeStatements merge staged rows into a dataset. All of them take the time of the merge as $1, and revisions and
+// insert take the ingestion run as $2.
+type mergeStatements struct {
+	// revisions records every value of the current versions that changes
+	revisions string
+	// close closes the current versions whose values change
+	close string
+	// insert inserts the rows left without a current version
+	insert string
+}
+
+// mergeSql builds the statements that merge the rows of selectSql into the table of a dataset as their current
+// versions. selectSql has to select keys and values in this order.
+func mergeSql(dataset, table string, keys, values []string, selectSql string) mergeStatements {
+	var match, key, current, staged, changes []string
+	for _, k := range keys {
+		match = append(match, table+"."+k+"=s."+k)
+		key = append(key, fmt.Sprintf("'%[1]s', s.%[1]s", k))
+	}
+	for _, v := range values {
+		current = append(current, table+"."+v)
+		staged = append(staged, "s."+v)
+		changes = append(changes, fmt.Sprintf("('%[2]s', %[1]s.%[2]s::text, s.%[2]s::text)", table, v))
+	}
+	return mergeStatements{
+		revisions: fmt.Sprintf(`INSERT INTO revisions (dataset,key,field,old_value,new_value,ingestion_run_id,recorded_at)
+			SELECT '%[1]s', json_build_object(%[4]s), v.field, v.old_value, v.new_value, $2::integer, $1::timestamp
+			FROM %[2]s JOIN (%[3]s) s ON %[5]s
+			CROSS JOIN LATERAL (VALUES %[6]s) v(field, old_value, new_value)
+			WHERE %[2]s.valid_to IS NULL AND v.old_value IS DISTINCT FROM v.new_value`,
+			dataset, table, selectSql, strings.Join(key, ", "), strings.Join(match, " AND "), strings.Join(changes, ", ")),
+		close: fmt.Sprintf(`UPDATE %[1]s SET valid_to=$1 FROM (%[2]s) s
+			WHERE %[1]s.valid_to IS NULL AND %[3]s AND (%[4]s) IS DISTINCT FROM (%[5]s)`,
+			table, selectSql, strings.Join(match, " AND "), strings.Join(current, ","), strings.Join(staged, ",")),
+		insert: fmt.Sprintf(`INSERT INTO %[1]s (%[2]s,%[3]s,valid_from,ingestion_run_id)
+			SELECT s.*, $1::timestamp, $2::integer FROM (%[4]s) s
+			ON CONFLICT (%[2]s) WHERE valid_to IS NULL DO NOTHING`,
+			table, strings.Join(keys, ","), strings.Join(values, ","), selectSql),
+	}
+}
@@ -0,0 +1,626 @@
+package data
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// Bundles hold the full contents of the database, so that environments without access to the sources can be seeded,
+// and releases of the data can be reproduced. A bundle is a zip of a CSV file per table, along with a manifest
+// listing the checksums and row counts of the files and the provenance of the sources. Values are written in the
+// text format of Postgres, so that they are restored exactly as they were.
+
+const (
+	// BundleFormat is the version of the bundle layout, raised on incompatible changes
+	BundleFormat   = 1
+	bundleManifest = "manifest.json"
+	// bundleNull stands for NULL values, which CSV files cannot tell apart from empty strings otherwise
+	bundleNull = `\N`
+)
+
+// bundleTables are the tables of the built-in datasets and of their history, in the order they are restored in, so
+// that every table comes after the tables it references. Staging tables are empty between merges, so they are left
+// out.
+var bundleTables = []string{
+	"departments", "prefectures", "regional_units", "municipalities", "ingestion_runs", "ingestion_steps",
+	"source_states", "reporting_cadences", "cases_per_regional_unit", "greece_timeline",
+	"deaths_per_municipality_cum", "demography_per_age", "quarantined_values", "revisions", "waste_sites",
+	"waste_measurements", "vaccinations",
+}
+
+// seededTables are filled by migrations, so their rows are replaced by those of a bundle, instead of having to be
+// empty.
+var seededTables = map[string]bool{"reporting_cadences": true}
+
+// BundleManifest describes the contents of a bundle.
+type BundleManifest struct {
+	Format int `json:"format"`
+	// SchemaVersion is the migration the database was at, which the database a bundle is imported into has to be at
+	SchemaVersion uint      `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Null is how NULL values are written in the CSV files
+	Null    string         `json:"null"`
+	Tables  []BundleTable  `json:"tables"`
+	Sources []BundleSource `json:"sources"`
+}
+
+// BundleTable is the CSV file of a table. Its first record holds the columns.
+type BundleTable struct {
+	Name string `json:"name"`
+	// Dataset is the registry dataset of the table, if any
+	Dataset string   `json:"dataset,omitempty"`
+	File    string   `json:"file"`
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+	Sha256  string   `json:"sha256"`
+}
+
+// BundleSource is where a dataset was loaded from, and which version of the source was last loaded.
+type BundleSource struct {
+	Dataset      string     `json:"dataset"`
+	Source       string     `json:"source"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"`
+	Sha256       string     `json:"sha256,omitempty"`
+	LoadedAt     *time.Time `json:"loaded_at,omitempty"`
+}
+
+// bundleTables returns the tables a bundle of the service holds: those of the built-in datasets, followed by those
+// of the registry.
+func (s *Service) bundleTables() []BundleTable {
+	var res []BundleTable
+	for _, name := range bundleTables {
+		res = append(res, BundleTable{Name: name})
+	}
+	for _, def := range s.registry {
+		res = append(res, BundleTable{Name: def.Table, Dataset: def.Name})
+	}
+	return res
+}
+
+// ExportBundle writes the contents of the database to w as a bundle. schemaVersion is the migration the database
+// is at. Tables of registry datasets that were never loaded are left out.
+func (s *Service) ExportBundle(ctx context.Context, w io.Writer, schemaVersion uint) (BundleManifest, error) {
+	manifest := BundleManifest{
+		Format:        BundleFormat,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+		Null:          bundleNull,
+	}
+	zw := zip.NewWriter(w)
+	// all tables are read from the same snapshot, so that rows referencing each other are exported together
+	err := s.repo.WithSnapshot(ctx, func(repo Repo) error {
+		for _, t := range s.bundleTables() {
+			columns, err := repo.GetTableColumns(ctx, t.Name)
+			if err != nil {
+				return err
+			}
+			if len(columns) == 0 {
+				continue
+			}
+			t.Columns = columns
+			t.File = "tables/" + t.Name + ".csv"
+			f, err := zw.CreateHeader(&zip.FileHeader{Name: t.File, Method: zip.Deflate, Modified: manifest.CreatedAt})
+			if err != nil {
+				return fmt.Errorf("cannot add %s to bundle: %s", t.File, err)
+			}
+			if err := exportTable(ctx, repo, &t, f); err != nil {
+				return err
+			}
+			manifest.Tables = append(manifest.Tables, t)
+		}
+
+		sources, err := s.bundleSources(ctx, repo)
+		if err != nil {
+			return err
+		}
+		manifest.Sources = sources
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("cannot encode bundle manifest: %s", err)
+	}
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: bundleManifest, Method: zip.Deflate, Modified: manifest.CreatedAt})
+	if err != nil {
+		return manifest, fmt.Errorf("cannot add manifest to bundle: %s", err)
+	}
+	if _, err := f.Write(b); err != nil {
+		return manifest, fmt.Errorf("cannot write bundle manifest: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		return manifest, fmt.Errorf("cannot write bundle: %s", err)
+	}
+	return manifest, nil
+}
+
+// exportTable writes the rows of table t of repo to w as CSV, counting them and summing them up in t
+func exportTable(ctx context.Context, repo Repo, t *BundleTable, w io.Writer) error {
+	h := sha256.New()
+	cw := csv.NewWriter(io.MultiWriter(w, h))
+	if err := cw.Write(t.Columns); err != nil {
+		return fmt.Errorf("cannot write %s: %s", t.File, err)
+	}
+	err := repo.ExportTableRows(ctx, t.Name, t.Columns, func(values []*string) error {
+		record := make([]string, len(values))
+		for i, v := range values {
+			switch {
+			case v == nil:
+				record[i] = bundleNull
+			case *v == bundleNull:
+				return fmt.Errorf("value %s of column %s of table %s cannot be told apart from NULL", bundleNull,
+					t.Columns[i], t.Name)
+			default:
+				record[i] = *v
+			}
+		}
+		t.Rows++
+		return cw.Write(record)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot export table %s: %s", t.Name, err)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("cannot write %s: %s", t.File, err)
+	}
+	t.Sha256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// bundleSources returns the provenance of every dataset, as recorded in repo
+func (s *Service) bundleSources(ctx context.Context, repo Repo) ([]BundleSource, error) {
+	var res []BundleSource
+	for _, name := range append(s.DatasetNames(), DatasetWaste) {
+		state, err := repo.GetSourceState(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		src := BundleSource{
+			Dataset:      name,
+			Source:       s.source(name).String(),
+			ETag:         state.Fingerprint.ETag,
+			LastModified: state.Fingerprint.LastModified,
+			Sha256:       state.Fingerprint.Sha256,
+		}
+		if !state.LoadedAt.IsZero() {
+			loadedAt := state.LoadedAt
+			src.LoadedAt = &loadedAt
+		}
+		res = append(res, src)
+	}
+	return res, nil
+}
+
+// ImportBundle restores the bundle of r, of the given size, into an empty database at migration schemaVersion.
+// The files of the bundle are checked against its manifest before anything is written, and the bundle is imported
+// in a single transaction, so that a failed import leaves the database empty.
+func (s *Service) ImportBundle(ctx context.Context, r io.ReaderAt, size int64, schemaVersion uint) (BundleManifest,
+	error) {
+	var manifest BundleManifest
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return manifest, fmt.Errorf("cannot read bundle: %s", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if err := readBundleManifest(files[bundleManifest], &manifest); err != nil {
+		return manifest, err
+	}
+	if manifest.Format != BundleFormat {
+		return manifest, fmt.Errorf("bundle format %d is not supported, only %d is", manifest.Format, BundleFormat)
+	}
+	if manifest.SchemaVersion != schemaVersion {
+		return manifest, fmt.Errorf("bundle was exported at schema version %d, but the database is at %d",
+			manifest.SchemaVersion, schemaVersion)
+	}
+
+	known := make(map[string]BundleTable)
+	for _, t := range s.bundleTables() {
+		known[t.Name] = t
+	}
+	for _, t := range manifest.Tables {
+		k, ok := known[t.Name]
+		if !ok || k.Dataset != t.Dataset {
+			if t.Dataset != "" {
+				return manifest, fmt.Errorf("table %s of dataset %s is not in the registry", t.Name, t.Dataset)
+			}
+			return manifest, fmt.Errorf("unknown table %s", t.Name)
+		}
+		if err := checkBundleTable(files[t.File], t); err != nil {
+			return manifest, err
+		}
+	}
+
+	err = s.repo.WithTx(ctx, func(tx Repo) error {
+		if err := s.checkEmpty(ctx, tx); err != nil {
+			return err
+		}
+		for _, t := range manifest.Tables {
+			if t.Dataset != "" {
+				def, _ := s.Dataset(t.Dataset)
+				if err := tx.EnsureDatasetTable(ctx, def); err != nil {
+					return err
+				}
+			}
+			if seededTables[t.Name] {
+				if err := tx.DeleteTableRows(ctx, t.Name); err != nil {
+					return err
+				}
+			}
+			if err := importBundleTable(ctx, tx, files[t.File], t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return manifest, err
+}
+
+// checkEmpty fails unless all tables of the database, besides those seeded by migrations, are empty
+func (s *Service) checkEmpty(ctx context.Context, repo Repo) error {
+	for _, t := range s.bundleTables() {
+		if seededTables[t.Name] {
+			continue
+		}
+		columns, err := repo.GetTableColumns(ctx, t.Name)
+		if err != nil {
+			return err
+		}
+		// tables of registry datasets are created once they are loaded
+		if len(columns) == 0 {
+			continue
+		}
+		n, err := repo.CountTableRows(ctx, t.Name)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("bundles can only be imported into an empty database, but table %s has %d rows",
+				t.Name, n)
+		}
+	}
+	return nil
+}
+
+// readBundleManifest decodes the manifest file f into manifest
+func readBundleManifest(f *zip.File, manifest *BundleManifest) error {
+	if f == nil {
+		return fmt.Errorf("bundle has no %s", bundleManifest)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("cannot read bundle manifest: %s", err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(manifest); err != nil {
+		return fmt.Errorf("cannot decode bundle manifest: %s", err)
+	}
+	return nil
+}
+
+// bundleTableReader reads the rows of the CSV file of a table one by one, checking the file against the manifest
+// once it is read whole
+type bundleTableReader struct {
+	t    BundleTable
+	rc   io.ReadCloser
+	h    hash.Hash
+	r    io.Reader
+	cr   *csv.Reader
+	rows int
+}
+
+// openBundleTable opens the CSV file f of table t, and reads its columns
+func openBundleTable(f *zip.File, t BundleTable) (*bundleTableReader, error) {
+	if f == nil {
+		return nil, fmt.Errorf("bundle has no %s", t.File)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %s", t.File, err)
+	}
+	h := sha256.New()
+	r := io.TeeReader(rc, h)
+	tr := &bundleTableReader{t: t, rc: rc, h: h, r: r, cr: csv.NewReader(r)}
+
+	header, err := tr.cr.Read()
+	if err == nil && strings.Join(header, ",") != strings.Join(t.Columns, ",") {
+		err = fmt.Errorf("columns of %s do not match the manifest", t.File)
+	} else if err != nil {
+		err = fmt.Errorf("cannot read columns of %s: %s", t.File, err)
+	}
+	if err != nil {
+		// a tampered file is reported as such, rather than by what it broke
+		if sumErr := tr.checksum(); sumErr != nil {
+			err = sumErr
+		}
+		rc.Close()
+		return nil, err
+	}
+	return tr, nil
+}
+
+// Next returns the next row of the file, with nil for NULL values, or nil once all rows were read and the file
+// matches the manifest.
+func (tr *bundleTableReader) Next() ([]*string, error) {
+	record, err := tr.cr.Read()
+	if errors.Is(err, io.EOF) {
+		if err := tr.checksum(); err != nil {
+			return nil, err
+		}
+		if tr.rows != tr.t.Rows {
+			return nil, fmt.Errorf("%s has %d rows, but the manifest lists %d", tr.t.File, tr.rows, tr.t.Rows)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		if sumErr := tr.checksum(); sumErr != nil {
+			return nil, sumErr
+		}
+		return nil, fmt.Errorf("cannot read %s: %s", tr.t.File, err)
+	}
+	tr.rows++
+	values := make([]*string, len(record))
+	for i := range record {
+		if record[i] != bundleNull {
+			values[i] = &record[i]
+		}
+	}
+	return values, nil
+}
+
+// checksum reads what is left of the file, and checks the checksum of all of it
+func (tr *bundleTableReader) checksum() error {
+	if _, err := io.Copy(io.Discard, tr.r); err != nil {
+		return fmt.Errorf("cannot read %s: %s", tr.t.File, err)
+	}
+	if hex.EncodeToString(tr.h.Sum(nil)) != tr.t.Sha256 {
+		return fmt.Errorf("checksum of %s does not match the manifest", tr.t.File)
+	}
+	return nil
+}
+
+func (tr *bundleTableReader) Close() error {
+	return tr.rc.Close()
+}
+
+// checkBundleTable checks the CSV file f of table t against the manifest, without keeping its rows
+func checkBundleTable(f *zip.File, t BundleTable) error {
+	tr, err := openBundleTable(f, t)
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+	for {
+		row, err := tr.Next()
+		if err != nil || row == nil {
+			return err
+		}
+	}
+}
+
+// importBundleTable streams the rows of the CSV file f of table t into repo
+func importBundleTable(ctx context.Context, repo Repo, f *zip.File, t BundleTable) error {
+	tr, err := openBundleTable(f, t)
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+	return repo.ImportTableRows(ctx, t.Name, t.Columns, tr.Next)
+}
+
+// GetTableColumns returns the columns of a table in their order, or none if there is no such table.
+func (r *PgRepo) GetTableColumns(ctx context.Context, table string) ([]string, error) {
+	rows, err := r.conn.Query(ctx, `SELECT column_name FROM information_schema.columns
+                                    WHERE table_schema = current_schema() AND table_name = $1
+                                    ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get columns of table %s: %s", table, err)
+	}
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("cannot scan column of table %s: %s", table, err)
+		}
+		res = append(res, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot get columns of table %s: %s", table, err)
+	}
+	return res, nil
+}
+
+// ExportTableRows calls fn with the values of the given columns of every row of a table, in the text format of
+// Postgres and nil for NULL. Rows are sorted by all of their columns, so that exports of the same contents are equal.
+func (r *PgRepo) ExportTableRows(ctx context.Context, table string, columns []string,
+	fn func(values []*string) error) error {
+	selected := make([]string, len(columns))
+	for i, c := range columns {
+		selected[i] = pgx.Identifier{c}.Sanitize() + "::text"
+	}
+	sql := fmt.Sprintf(`SELECT %s FROM %s ORDER BY %s`, strings.Join(selected, ","), pgx.Identifier{table}.Sanitize(),
+		sanitizedList(columns))
+	rows, err := r.conn.Query(ctx, sql)
+	if err != nil {
+		return fmt.Errorf("cannot get rows of table %s: %s", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]*string, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("cannot scan row of table %s: %s", table, err)
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("cannot get rows of table %s: %s", table, err)
+	}
+	return nil
+}
+
+// CountTableRows returns the number of rows of a table.
+func (r *PgRepo) CountTableRows(ctx context.Context, table string) (int, error) {
+	var n int
+	sql := fmt.Sprintf(`SELECT count(*) FROM %s`, pgx.Identifier{table}.Sanitize())
+	if err := r.conn.QueryRow(ctx, sql).Scan(&n); err != nil {
+		return 0, fmt.Errorf("cannot count rows of table %s: %s", table, err)
+	}
+	return n, nil
+}
+
+// DeleteTableRows deletes all rows of a table.
+func (r *PgRepo) DeleteTableRows(ctx context.Context, table string) error {
+	if _, err := r.conn.Exec(ctx, fmt.Sprintf(`DELETE FROM %s`, pgx.Identifier{table}.Sanitize())); err != nil {
+		return fmt.Errorf("cannot delete rows of table %s: %s", table, err)
+	}
+	return nil
+}
+
+// ImportTableRows copies the rows next returns into a table, with the values of the given columns in the text format
+// of Postgres and nil for NULL. Generated ids are copied as they are, so the sequences generating them are moved past
+// them.
+func (r *PgRepo) ImportTableRows(ctx context.Context, table string, columns []string,
+	next func() ([]*string, error)) error {
+	types, err := r.columnTypes(ctx, table, columns)
+	if err != nil {
+		return err
+	}
+	src := &textCopySource{next: next, columns: columns, types: types}
+	if _, err := r.conn.CopyFrom(ctx, pgx.Identifier{table}, columns, src); err != nil {
+		return fmt.Errorf("cannot copy into %s: %s", table, err)
+	}
+	return r.resetSequences(ctx, table)
+}
+
+// textCopySource is a pgx.CopyFromSource of rows in the text format of Postgres. Values are encoded by the types of
+// their columns, since COPY would take strings for text values.
+type textCopySource struct {
+	next    func() ([]*string, error)
+	columns []string
+	types   []pgtype.Value
+	values  []interface{}
+	err     error
+}
+
+func (s *textCopySource) Next() bool {
+	row, err := s.next()
+	if err != nil || row == nil {
+		s.err = err
+		return false
+	}
+	s.values = make([]interface{}, len(s.columns))
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		value := pgtype.NewValue(s.types[i])
+		if err := value.Set(*v); err != nil {
+			s.err = fmt.Errorf("invalid value %q of column %s: %s", *v, s.columns[i], err)
+			return false
+		}
+		s.values[i] = value
+	}
+	return true
+}
+
+func (s *textCopySource) Values() ([]interface{}, error) {
+	return s.values, nil
+}
+
+func (s *textCopySource) Err() error {
+	return s.err
+}
+
+// columnTypes returns the types of the given columns of a table
+func (r *PgRepo) columnTypes(ctx context.Context, table string, columns []string) ([]pgtype.Value, error) {
+	rows, err := r.conn.Query(ctx, fmt.Sprintf(`SELECT %s FROM %s LIMIT 0`, sanitizedList(columns),
+		pgx.Identifier{table}.Sanitize()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get columns of table %s: %s", table, err)
+	}
+	fields := rows.FieldDescriptions()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot get columns of table %s: %s", table, err)
+	}
+	ci := pgtype.NewConnInfo()
+	res := make([]pgtype.Value, len(fields))
+	for i, f := range fields {
+		dt, ok := ci.DataTypeForOID(f.DataTypeOID)
+		if !ok {
+			return nil, fmt.Errorf("column %s of table %s has an unsupported type", columns[i], table)
+		}
+		res[i] = dt.Value
+	}
+	return res, nil
+}
+
+// resetSequences moves the sequences generating the columns of a table past the values of the columns
+func (r *PgRepo) resetSequences(ctx context.Context, table string) error {
+	rows, err := r.conn.Query(ctx, `SELECT column_name, pg_get_serial_sequence($1::text, column_name)
+                                    FROM information_schema.columns
+                                    WHERE table_schema = current_schema() AND table_name = $1::text
+                                      AND pg_get_serial_sequence($1::text, column_name) IS NOT NULL`, table)
+	if err != nil {
+		return fmt.Errorf("cannot get sequences of table %s: %s", table, err)
+	}
+	sequences := make(map[string]string)
+	for rows.Next() {
+		var column, sequence string
+		if err := rows.Scan(&column, &sequence); err != nil {
+			rows.Close()
+			return fmt.Errorf("cannot scan sequence of table %s: %s", table, err)
+		}
+		sequences[column] = sequence
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("cannot get sequences of table %s: %s", table, err)
+	}
+
+	for column, sequence := range sequences {
+		c := pgx.Identifier{column}.Sanitize()
+		sql := fmt.Sprintf(`SELECT setval($1, COALESCE(max(%s), 1), max(%s) IS NOT NULL) FROM %s`, c, c,
+			pgx.Identifier{table}.Sanitize())
+		if _, err := r.conn.Exec(ctx, sql, sequence); err != nil {
+			return fmt.Errorf("cannot reset sequence %s: %s", sequence, err)
+		}
+	}
+	return nil
+}
+
+// sanitizedList joins columns into a list of quoted identifiers
+func sanitizedList(columns []string) string {
+	res := make([]string, len(columns))
+	for i, c := range columns {
+		res[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return strings.Join(res, ",")
+}
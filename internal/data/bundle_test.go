@@ -0,0 +1,225 @@
+package data
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"covid19-greece-api/pkg/file"
+	"covid19-greece-api/pkg/vartypes"
+)
+
+// bundleTestTable is a table of the database the bundle tests export and import
+type bundleTestTable struct {
+	columns []string
+	rows    [][]*string
+}
+
+func bundleTestService(t *testing.T, repo Repo) *Service {
+	srv, err := NewService(repo, Sources{
+		Cases:                 file.NewMemorySource("cases.csv", nil),
+		Timeline:              file.NewMemorySource("timeline.csv", nil),
+		DeathsPerMunicipality: file.NewMemorySource("deaths.csv", nil),
+		Demographics:          file.NewMemorySource("demographics.csv", nil),
+		Waste:                 file.NewMemorySource("waste.csv", nil),
+	})
+	require.Nil(t, err)
+	return srv
+}
+
+// exportTestBundle exports tables through a mocked repository
+func exportTestBundle(t *testing.T, tables map[string]bundleTestTable) ([]byte, BundleManifest) {
+	ctrl := gomock.NewController(t)
+	repo := NewRepoMock(ctrl)
+	// every table is read from the same snapshot
+	repo.ExpectSnapshot()
+	repo.EXPECT().GetTableColumns(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, table string) ([]string, error) {
+			return tables[table].columns, nil
+		}).AnyTimes()
+	repo.EXPECT().ExportTableRows(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, table string, _ []string, fn func([]*string) error) error {
+			for _, row := range tables[table].rows {
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).AnyTimes()
+	repo.EXPECT().GetSourceState(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, name string) (SourceState, error) {
+			if name != DatasetTimeline {
+				return SourceState{Name: name}, nil
+			}
+			return SourceState{Name: name, Fingerprint: file.Fingerprint{ETag: `"abc"`, Sha256: "0123"},
+				LoadedAt: time.Date(2022, 10, 1, 4, 0, 0, 0, time.UTC)}, nil
+		}).AnyTimes()
+
+	var buf bytes.Buffer
+	manifest, err := bundleTestService(t, repo).ExportBundle(context.Background(), &buf, 21)
+	require.Nil(t, err)
+	return buf.Bytes(), manifest
+}
+
+var bundleTestTables = map[string]bundleTestTable{
+	"regional_units": {
+		columns: []string{"id", "slug", "regional_unit"},
+		rows: [][]*string{
+			{vartypes.StringPtr("1"), vartypes.StringPtr("achaia"), vartypes.StringPtr("ΑΧΑΪΑΣ, \"Πάτρα\"")},
+			{vartypes.StringPtr("2"), vartypes.StringPtr("attiki"), nil},
+		},
+	},
+	"greece_timeline": {
+		columns: []string{"date", "cases", "valid_from", "valid_to"},
+		rows: [][]*string{
+			{vartypes.StringPtr("2022-07-12"), vartypes.StringPtr(""), vartypes.StringPtr("-infinity"), nil},
+		},
+	},
+	"reporting_cadences": {
+		columns: []string{"dataset", "since", "cadence"},
+		rows: [][]*string{
+			{vartypes.StringPtr("cases"), vartypes.StringPtr("2022-07-12"), vartypes.StringPtr("weekly")},
+		},
+	},
+}
+
+func TestExportBundle(t *testing.T) {
+	b, manifest := exportTestBundle(t, bundleTestTables)
+
+	assert.Equal(t, BundleFormat, manifest.Format)
+	assert.Equal(t, uint(21), manifest.SchemaVersion)
+	var names []string
+	for _, table := range manifest.Tables {
+		names = append(names, table.Name)
+	}
+	// tables are exported in the order they are restored in, and missing ones are left out
+	assert.Equal(t, []string{"regional_units", "reporting_cadences", "greece_timeline"}, names)
+	assert.Equal(t, 2, manifest.Tables[0].Rows)
+	assert.Equal(t, "tables/regional_units.csv", manifest.Tables[0].File)
+	loadedAt := time.Date(2022, 10, 1, 4, 0, 0, 0, time.UTC)
+	assert.Equal(t, BundleSource{Dataset: DatasetTimeline, Source: "memory://timeline.csv", ETag: `"abc"`,
+		Sha256: "0123", LoadedAt: &loadedAt}, manifest.Sources[1])
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.Nil(t, err)
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.Nil(t, err)
+		content, err := io.ReadAll(rc)
+		require.Nil(t, err)
+		files[f.Name] = string(content)
+	}
+	assert.Contains(t, files, bundleManifest)
+	assert.Equal(t, "date,cases,valid_from,valid_to\n2022-07-12,,-infinity,\\N\n",
+		files["tables/greece_timeline.csv"])
+}
+
+func TestExportBundleRejectsNullLookalikes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := NewRepoMock(ctrl)
+	repo.ExpectSnapshot()
+	repo.EXPECT().GetTableColumns(gomock.Any(), "departments").Return([]string{"name"}, nil)
+	repo.EXPECT().ExportTableRows(gomock.Any(), "departments", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, _ []string, fn func([]*string) error) error {
+			return fn([]*string{vartypes.StringPtr(bundleNull)})
+		})
+
+	_, err := bundleTestService(t, repo).ExportBundle(context.Background(), io.Discard, 21)
+	assert.ErrorContains(t, err, "cannot be told apart from NULL")
+}
+
+// importMock returns a repository whose tables are empty and of which the tables of bundleTestTables exist, and the
+// rows imported into it by table
+func importMock(t *testing.T, rowsPerTable int) (*RepoMock, map[string][][]*string) {
+	ctrl := gomock.NewController(t)
+	repo := NewRepoMock(ctrl)
+	repo.ExpectTx().AnyTimes()
+	repo.EXPECT().GetTableColumns(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, table string) ([]string, error) {
+			return bundleTestTables[table].columns, nil
+		}).AnyTimes()
+	repo.EXPECT().CountTableRows(gomock.Any(), gomock.Any()).Return(rowsPerTable, nil).AnyTimes()
+	imported := make(map[string][][]*string)
+	repo.EXPECT().ImportTableRows(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, table string, columns []string, next func() ([]*string, error)) error {
+			assert.Equal(t, bundleTestTables[table].columns, columns)
+			for {
+				row, err := next()
+				if err != nil || row == nil {
+					return err
+				}
+				imported[table] = append(imported[table], row)
+			}
+		}).AnyTimes()
+	return repo, imported
+}
+
+func TestImportBundle(t *testing.T) {
+	b, _ := exportTestBundle(t, bundleTestTables)
+	repo, imported := importMock(t, 0)
+	// cadences seeded by the migrations are replaced
+	repo.EXPECT().DeleteTableRows(gomock.Any(), "reporting_cadences")
+
+	manifest, err := bundleTestService(t, repo).ImportBundle(context.Background(), bytes.NewReader(b),
+		int64(len(b)), 21)
+	require.Nil(t, err)
+	assert.Len(t, manifest.Tables, 3)
+	for name, table := range bundleTestTables {
+		assert.Equal(t, table.rows, imported[name], name)
+	}
+}
+
+func TestImportBundleIntoNonEmptyDatabase(t *testing.T) {
+	b, _ := exportTestBundle(t, bundleTestTables)
+	repo, imported := importMock(t, 3)
+
+	_, err := bundleTestService(t, repo).ImportBundle(context.Background(), bytes.NewReader(b), int64(len(b)), 21)
+	assert.ErrorContains(t, err, "empty database, but table regional_units has 3 rows")
+	assert.Empty(t, imported)
+}
+
+func TestImportBundleOfOtherSchemaVersion(t *testing.T) {
+	b, _ := exportTestBundle(t, bundleTestTables)
+	repo, imported := importMock(t, 0)
+
+	_, err := bundleTestService(t, repo).ImportBundle(context.Background(), bytes.NewReader(b), int64(len(b)), 22)
+	assert.ErrorContains(t, err, "exported at schema version 21, but the database is at 22")
+	assert.Empty(t, imported)
+}
+
+func TestImportTamperedBundle(t *testing.T) {
+	b, _ := exportTestBundle(t, bundleTestTables)
+	// rewrite the bundle, changing a value of the timeline
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.Nil(t, err)
+		content, err := io.ReadAll(rc)
+		require.Nil(t, err)
+		if f.Name == "tables/greece_timeline.csv" {
+			content = bytes.Replace(content, []byte("2022-07-12"), []byte("2022-07-13"), 1)
+		}
+		w, err := zw.Create(f.Name)
+		require.Nil(t, err)
+		_, err = w.Write(content)
+		require.Nil(t, err)
+	}
+	require.Nil(t, zw.Close())
+	repo, imported := importMock(t, 0)
+
+	_, err = bundleTestService(t, repo).ImportBundle(context.Background(), bytes.NewReader(buf.Bytes()),
+		int64(buf.Len()), 21)
+	assert.ErrorContains(t, err, "checksum of tables/greece_timeline.csv does not match the manifest")
+	assert.Empty(t, imported)
+}
@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Sources do not always report a dataset at the same cadence: EODY, for example, reported cases daily until
+// 12/7/2022 and weekly after that. The cadences of every dataset are kept as data, in reporting_cadences, and every
+// observation carries the period it covers.
+
+// Cadence is how often the values of a dataset are reported.
+type Cadence string
+
+const (
+	// CadenceNative returns observations in the cadence they were reported. It is only valid when reading.
+	CadenceNative Cadence = "native"
+	// CadenceDaily observations cover a single day.
+	CadenceDaily Cadence = "daily"
+	// CadenceWeekly observations cover the 7 days ending at their date.
+	CadenceWeekly Cadence = "weekly"
+)
+
+// ParseCadence parses the cadence observations are read in. An empty string is CadenceNative.
+func ParseCadence(s string) (Cadence, error) {
+	switch Cadence(s) {
+	case "", CadenceNative:
+		return CadenceNative, nil
+	case CadenceDaily, CadenceWeekly:
+		return Cadence(s), nil
+	}
+	return CadenceNative, fmt.Errorf("unknown cadence %q, use one of native, daily or weekly", s)
+}
+
+// CadencePeriod is the cadence a dataset is reported at, from Since until the next period of the dataset.
+// Weekly values are reported every 7 days from Since.
+type CadencePeriod struct {
+	Dataset string    `json:"dataset"`
+	Since   time.Time `json:"since"`
+	Cadence Cadence   `json:"cadence"`
+}
+
+// observationPeriod returns the period covered by the value reported at date, given the cadence periods of its
+// dataset sorted by Since. It returns false for dates of a weekly period that are not report dates.
+func observationPeriod(periods []CadencePeriod, date time.Time) (start, end time.Time, cadence Cadence, ok bool) {
+	current := CadencePeriod{Cadence: CadenceDaily}
+	for _, p := range periods {
+		if p.Since.After(date) {
+			break
+		}
+		current = p
+	}
+	if current.Cadence != CadenceWeekly {
+		return date, date, CadenceDaily, true
+	}
+	if daysBetween(current.Since, date)%7 != 0 {
+		return time.Time{}, time.Time{}, "", false
+	}
+	return date.AddDate(0, 0, -6), date, CadenceWeekly, true
+}
+
+// daysBetween counts the calendar days from a to b, regardless of their locations
+func daysBetween(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// WeekEnd is the weekday resampled weeks end on: the weekday of the latest weekly period, so that the weeks match
+// the reported ones, or Sunday if the dataset was never reported weekly.
+func WeekEnd(periods []CadencePeriod) time.Weekday {
+	end := time.Sunday
+	for _, p := range periods {
+		if p.Cadence == CadenceWeekly {
+			end = p.Since.Weekday()
+		}
+	}
+	return end
+}
+
+// ResampleCases resamples cases to a daily or weekly cadence. Weekly values are spread evenly over the days of
+// their period, so that the days add up to the weekly value, while weekly periods end on weekEnd and add up their
+// days. A period is nil if any of its days is nil, and weeks missing days are dropped. The result is sorted by date
+// and regional unit.
+func ResampleCases(cases []Case, to Cadence, weekEnd time.Weekday) []Case {
+	if to != CadenceDaily && to != CadenceWeekly {
+		return cases
+	}
+
+	type day struct {
+		regionalUnitId int
+		date           string
+	}
+	days := make(map[day]Case)
+	for _, c := range cases {
+		n := daysBetween(c.PeriodStart, c.PeriodEnd) + 1
+		for i := 0; i < n; i++ {
+			d := c.PeriodStart.AddDate(0, 0, i)
+			daily := Case{RegionalUnitId: c.RegionalUnitId, Date: d, PeriodStart: d, PeriodEnd: d, Cadence: CadenceDaily}
+			if c.Cases != nil {
+				// the remainder goes to the first days
+				amount := *c.Cases / n
+				if i < *c.Cases%n {
+					amount++
+				}
+				daily.Cases = &amount
+			}
+			days[day{c.RegionalUnitId, d.Format(simpleDateLayout)}] = daily
+		}
+	}
+
+	var res []Case
+	if to == CadenceDaily {
+		for _, c := range days {
+			res = append(res, c)
+		}
+	} else {
+		weeks := make(map[day]*Case)
+		counts := make(map[day]int)
+		for _, c := range days {
+			end := c.Date.AddDate(0, 0, (int(weekEnd)-int(c.Date.Weekday())+7)%7)
+			k := day{c.RegionalUnitId, end.Format(simpleDateLayout)}
+			w, ok := weeks[k]
+			if !ok {
+				w = &Case{
+					RegionalUnitId: c.RegionalUnitId,
+					Date:           end,
+					PeriodStart:    end.AddDate(0, 0, -6),
+					PeriodEnd:      end,
+					Cadence:        CadenceWeekly,
+					Cases:          new(int),
+				}
+				weeks[k] = w
+			}
+			counts[k]++
+			if w.Cases != nil && c.Cases != nil {
+				*w.Cases += *c.Cases
+			} else {
+				w.Cases = nil
+			}
+		}
+		for k, w := range weeks {
+			if counts[k] == 7 {
+				res = append(res, *w)
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Date.Equal(res[j].Date) {
+			return res[i].Date.Before(res[j].Date)
+		}
+		return res[i].RegionalUnitId < res[j].RegionalUnitId
+	})
+	return res
+}
+
+// GetCadencePeriods returns the cadence periods of a dataset, sorted by Since.
+func (r *PgRepo) GetCadencePeriods(ctx context.Context, dataset string) ([]CadencePeriod, error) {
+	rows, err := r.conn.Query(ctx, `SELECT dataset,since,cadence FROM reporting_cadences WHERE dataset=$1 ORDER BY since`,
+		dataset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get reporting cadences: %s", err)
+	}
+	defer rows.Close()
+
+	var res []CadencePeriod
+	for rows.Next() {
+		var p CadencePeriod
+		if err := rows.Scan(&p.Dataset, &p.Since, &p.Cadence); err != nil {
+			return nil, fmt.Errorf("cannot scan reporting cadence: %s", err)
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"covid19-greece-api/pkg/vartypes"
+)
+
+func TestParseCadence(t *testing.T) {
+	for s, expected := range map[string]Cadence{
+		"":       CadenceNative,
+		"native": CadenceNative,
+		"daily":  CadenceDaily,
+		"weekly": CadenceWeekly,
+	} {
+		cadence, err := ParseCadence(s)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, cadence)
+	}
+	_, err := ParseCadence("monthly")
+	assert.NotNil(t, err)
+}
+
+func TestObservationPeriod(t *testing.T) {
+	periods := []CadencePeriod{
+		{Dataset: DatasetCases, Since: time.Date(2022, 7, 12, 0, 0, 0, 0, time.UTC), Cadence: CadenceWeekly},
+	}
+	day := func(m time.Month, d int) time.Time { return time.Date(2022, m, d, 0, 0, 0, 0, time.UTC) }
+
+	start, end, cadence, ok := observationPeriod(periods, day(7, 11))
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{day(7, 11), day(7, 11), CadenceDaily}, []interface{}{start, end, cadence})
+
+	start, end, cadence, ok = observationPeriod(periods, day(7, 19))
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{day(7, 13), day(7, 19), CadenceWeekly}, []interface{}{start, end, cadence})
+
+	_, _, _, ok = observationPeriod(periods, day(7, 20))
+	assert.False(t, ok)
+
+	assert.Equal(t, time.Tuesday, WeekEnd(periods))
+	assert.Equal(t, time.Sunday, WeekEnd(nil))
+}
+
+func TestResampleCases(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2022, m, d, 0, 0, 0, 0, time.UTC) }
+	var cases []Case
+	// daily from Tuesday 28/6 until Tuesday 5/7, then a week until Tuesday 12/7
+	for d := day(6, 28); !d.After(day(7, 5)); d = d.AddDate(0, 0, 1) {
+		cases = append(cases, Case{RegionalUnitId: 1, Date: d, Cases: vartypes.IntPtr(1), PeriodStart: d, PeriodEnd: d,
+			Cadence: CadenceDaily})
+	}
+	cases = append(cases, Case{RegionalUnitId: 1, Date: day(7, 12), Cases: vartypes.IntPtr(10),
+		PeriodStart: day(7, 6), PeriodEnd: day(7, 12), Cadence: CadenceWeekly})
+
+	daily := ResampleCases(cases, CadenceDaily, time.Tuesday)
+	assert.Len(t, daily, 15)
+	var spread []int
+	for _, c := range daily[8:] {
+		assert.Equal(t, CadenceDaily, c.Cadence)
+		assert.Equal(t, c.Date, c.PeriodStart)
+		spread = append(spread, *c.Cases)
+	}
+	assert.Equal(t, []int{2, 2, 2, 1, 1, 1, 1}, spread)
+
+	// the week ending at 28/6 misses days, so it is dropped
+	assert.Equal(t, []Case{{
+		RegionalUnitId: 1,
+		Date:           day(7, 5),
+		Cases:          vartypes.IntPtr(7),
+		PeriodStart:    day(6, 29),
+		PeriodEnd:      day(7, 5),
+		Cadence:        CadenceWeekly,
+	}, {
+		RegionalUnitId: 1,
+		Date:           day(7, 12),
+		Cases:          vartypes.IntPtr(10),
+		PeriodStart:    day(7, 6),
+		PeriodEnd:      day(7, 12),
+		Cadence:        CadenceWeekly,
+	}}, ResampleCases(cases, CadenceWeekly, time.Tuesday))
+
+	// a week is unknown if any of its days is
+	cases[3].Cases = nil
+	weekly := ResampleCases(cases, CadenceWeekly, time.Tuesday)
+	assert.Nil(t, weekly[0].Cases)
+
+	assert.Equal(t, cases, ResampleCases(cases, CadenceNative, time.Tuesday))
+}
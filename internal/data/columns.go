@@ -0,0 +1,321 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"covid19-greece-api/pkg/vartypes"
+)
+
+// Columns of the CSV sources are located by their headers, and rows of the timeline by their Status label, so that
+// upstream changes in the order of columns or rows cannot silently put numbers in the wrong fields.
+// Together with the rules of their values, the layouts below are the contracts of the source files.
+
+// column declares a column of a CSV file.
+type column struct {
+	name     string   // how the column is referred to in code
+	headers  []string // accepted headers, matched case-insensitively
+	required bool
+	rule     cellRule
+}
+
+// csvLayout declares the columns of a CSV file. When series is set, every column whose header it recognizes holds
+// the values of the date (or year) it returns, and these values follow seriesRule.
+type csvLayout struct {
+	name       string
+	columns    []column
+	series     func(header string) (time.Time, bool)
+	seriesRule cellRule
+	// byStatus is set when every row holds a single field, named by its status column (see timelineRows)
+	byStatus bool
+}
+
+// dateColumn is a series column, holding the values of a single date or year
+type dateColumn struct {
+	index  int
+	header string
+	date   time.Time
+}
+
+// csvColumns are the positions of the columns of a specific CSV file.
+type csvColumns struct {
+	index      map[string]int
+	dates      []dateColumn
+	unknown    []string
+	missing    []string
+	duplicates []string
+}
+
+var casesLayout = csvLayout{
+	name: DatasetCases,
+	columns: []column{
+		{name: "department", headers: []string{"Γεωγραφικό Διαμέρισμα", "department"}, required: true},
+		{name: "prefecture", headers: []string{"Περιφέρεια", "prefecture"}, required: true},
+		{name: "regional_unit_normalized", headers: []string{"county_normalized", "regional_unit_normalized"}, required: true},
+		{name: "regional_unit", headers: []string{"county", "regional_unit"}, required: true},
+		{name: "pop_11", headers: []string{"pop_11"}, required: true, rule: cellRule{kind: kindInt, min: bound(0)}},
+	},
+	series:     dateHeader,
+	seriesRule: cellRule{kind: kindInt, optional: true, min: bound(0)},
+}
+
+var timelineLayout = csvLayout{
+	name: DatasetTimeline,
+	columns: []column{
+		{name: "status", headers: []string{"Status"}, required: true},
+		{name: "province", headers: []string{"Province/State"}, rule: cellRule{optional: true}},
+		{name: "country", headers: []string{"Country/Region"}, rule: cellRule{optional: true}},
+	},
+	series:     dateHeader,
+	seriesRule: cellRule{kind: kindFloat, optional: true},
+	byStatus:   true,
+}
+
+var deathsLayout = csvLayout{
+	name: DatasetDeathsPerMunicipality,
+	columns: []column{
+		{name: "municipality", headers: []string{"municipality"}, required: true},
+	},
+	series:     yearHeader,
+	seriesRule: cellRule{kind: kindInt, min: bound(0)},
+}
+
+var demographicsLayout = csvLayout{
+	name: DatasetDemographics,
+	columns: []column{
+		{name: "id", headers: []string{"id"}, rule: cellRule{optional: true}},
+		{name: "date", headers: []string{"date"}, required: true, rule: cellRule{kind: kindDate, format: simpleDateLayout}},
+		{name: "category", headers: []string{"category"}, required: true},
+		{name: "cases", headers: []string{"cases"}, required: true, rule: count},
+		{name: "deaths", headers: []string{"deaths"}, required: true, rule: count},
+		{name: "intensive", headers: []string{"intensive"}, required: true, rule: count},
+		{name: "discharged", headers: []string{"discharged"}, required: true, rule: count},
+		{name: "hospitalized", headers: []string{"hospitalized"}, required: true, rule: count},
+		{name: "hospitalized_in_icu", headers: []string{"hospitalized_in_icu"}, required: true, rule: count},
+		{name: "passed_away", headers: []string{"passed_away"}, required: true, rule: count},
+		{name: "recovered", headers: []string{"recovered"}, required: true, rule: count},
+		{name: "treated_at_home", headers: []string{"treated_at_home"}, required: true, rule: count},
+	},
+}
+
+var wasteLayout = csvLayout{
+	name: DatasetWaste,
+	columns: []column{
+		{name: "week", headers: []string{"week"}, required: true, rule: cellRule{kind: kindYearWeek}},
+		{name: "place", headers: []string{"area", "place"}, required: true},
+		{name: "place_en", headers: []string{"area_en", "place_en"}, rule: cellRule{optional: true}},
+		{name: "percentage", headers: []string{"pct_change_weekly_viral_load", "percentage"}, required: true,
+			rule: cellRule{kind: kindPercent}},
+	},
+}
+
+var vaccinationsLayout = csvLayout{
+	name: DatasetVaccinations,
+	columns: []column{
+		{name: "area", headers: []string{"area", "regional_unit_normalized"}, required: true},
+		{name: "date", headers: []string{"referencedate", "date"}, required: true,
+			rule: cellRule{kind: kindDate, format: simpleDateLayout}},
+		{name: "dose1", headers: []string{"dailydose1", "dose1"}, required: true, rule: optCount},
+		{name: "dose2", headers: []string{"dailydose2", "dose2"}, rule: optCount},
+		{name: "dose3", headers: []string{"dailydose3", "dose3"}, rule: optCount},
+		{name: "dose4", headers: []string{"dailydose4", "dose4"}, rule: optCount},
+	},
+}
+
+// layouts are the layouts of the sources by dataset name
+var layouts = map[string]csvLayout{
+	DatasetCases:                 casesLayout,
+	DatasetTimeline:              timelineLayout,
+	DatasetDeathsPerMunicipality: deathsLayout,
+	DatasetDemographics:          demographicsLayout,
+	DatasetWaste:                 wasteLayout,
+	DatasetVaccinations:          vaccinationsLayout,
+}
+
+// dateHeader recognizes headers holding dates as M/D/YY
+func dateHeader(header string) (time.Time, bool) {
+	d, err := csvHeaderToDate(strings.TrimSpace(header))
+	return d, err == nil
+}
+
+var yearHeaderRegexp = regexp.MustCompile(`_(\d{4})$`)
+
+// yearHeader recognizes headers ending in a year, like deaths_covid_2021
+func yearHeader(header string) (time.Time, bool) {
+	m := yearHeaderRegexp.FindStringSubmatch(strings.TrimSpace(header))
+	if m == nil {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// locate finds the declared columns among headers. Headers that are neither declared nor part of the series are
+// unknown, and are ignored.
+func (l csvLayout) locate(headers []string) *csvColumns {
+	byHeader := make(map[string]string)
+	for _, c := range l.columns {
+		for _, h := range c.headers {
+			byHeader[normalizeLabel(h)] = c.name
+		}
+	}
+
+	cols := &csvColumns{index: make(map[string]int)}
+	for i, h := range headers {
+		if name, ok := byHeader[normalizeLabel(h)]; ok {
+			if _, dup := cols.index[name]; dup {
+				cols.duplicates = append(cols.duplicates, h)
+				continue
+			}
+			cols.index[name] = i
+			continue
+		}
+		if l.series != nil {
+			if d, ok := l.series(h); ok {
+				cols.dates = append(cols.dates, dateColumn{index: i, header: h, date: d})
+				continue
+			}
+		}
+		cols.unknown = append(cols.unknown, h)
+	}
+
+	for _, c := range l.columns {
+		if _, ok := cols.index[c.name]; !ok && c.required {
+			cols.missing = append(cols.missing, c.headers[0])
+		}
+	}
+
+	return cols
+}
+
+// mapColumns locates the declared columns among headers. It fails if a required column is missing or appears more
+// than once. Unknown headers are ignored; they are reported by ValidateSource.
+func (l csvLayout) mapColumns(headers []string) (*csvColumns, error) {
+	cols := l.locate(headers)
+	if len(cols.duplicates) > 0 {
+		return nil, fmt.Errorf("%s csv has duplicate columns %q", l.name, cols.duplicates)
+	}
+	if len(cols.missing) > 0 {
+		return nil, fmt.Errorf("%s csv misses required columns %q", l.name, cols.missing)
+	}
+
+	return cols, nil
+}
+
+// value returns the value of the named column in row, or an empty string if the file does not have it
+func (c *csvColumns) value(row []string, name string) string {
+	i, ok := c.index[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// timelineRow declares a row of the timeline CSV and the field of FullInfo it fills.
+type timelineRow struct {
+	labels   []string // accepted Status labels, matched case-insensitively
+	required bool
+	rule     cellRule
+	set      func(fi *FullInfo, value string) error
+}
+
+var (
+	// daily counts may be negative, when upstream corrects previous days
+	dailyCount = cellRule{kind: kindInt, optional: true}
+	count      = cellRule{kind: kindInt, min: bound(0)}
+	optCount   = cellRule{kind: kindInt, optional: true, min: bound(0)}
+	estimate   = cellRule{kind: kindFloat, optional: true, min: bound(0)}
+	// occupancy percentages out of 0-100 are quarantined by detectAnomalies, instead of rejecting the whole file
+	occupancy = cellRule{kind: kindFloat, optional: true}
+)
+
+var timelineRows = []timelineRow{
+	{labels: []string{"cases"}, required: true, rule: dailyCount, set: setInt(func(fi *FullInfo) **int { return &fi.Cases })},
+	{labels: []string{"total_reinfections"}, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.TotalReinfections })},
+	{labels: []string{"deaths"}, required: true, rule: dailyCount, set: setInt(func(fi *FullInfo) **int { return &fi.Deaths })},
+	{labels: []string{"deaths_cum"}, required: true, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.DeathsCum })},
+	{labels: []string{"recovered"}, required: true, rule: dailyCount, set: setInt(func(fi *FullInfo) **int { return &fi.Recovered })},
+	{labels: []string{"hospital_admissions"}, required: true, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.HospitalAdmissions })},
+	{labels: []string{"hospital_discharges"}, required: true, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.HospitalDischarges })},
+	{labels: []string{"intubated"}, required: true, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.Intubated })},
+	{labels: []string{"intubated_unvac"}, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.IntubatedUnvac })},
+	{labels: []string{"intubated_vac"}, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.IntubatedVac })},
+	{labels: []string{"icu_occupancy"}, required: true, rule: occupancy, set: setFloat(func(fi *FullInfo) **float64 { return &fi.IcuOccupancy })},
+	{labels: []string{"beds_occupancy"}, required: true, rule: occupancy, set: setFloat(func(fi *FullInfo) **float64 { return &fi.BedsOccupancy })},
+	{labels: []string{"estimated_new_rtpcr_tests"}, required: true, rule: estimate, set: setEstimate(func(fi *FullInfo) **int { return &fi.EstimatedNewRtpcrTests })},
+	// upstream spells it with a typo
+	{labels: []string{"esitmated_new_rapid_tests", "estimated_new_rapid_tests"}, required: true, rule: estimate, set: setEstimate(func(fi *FullInfo) **int { return &fi.EstimatedNewRapidTests })},
+	{labels: []string{"estimated_new_total_tests"}, required: true, rule: estimate, set: setEstimate(func(fi *FullInfo) **int { return &fi.EstimatedNewTotalTests })},
+	{labels: []string{"total cases", "cases_cum"}, required: true, rule: optCount, set: setInt(func(fi *FullInfo) **int { return &fi.CasesCum })},
+}
+
+// setInt parses integer values into the field of FullInfo returned by field. Empty values are stored as nil.
+func setInt(field func(fi *FullInfo) **int) func(fi *FullInfo, value string) error {
+	return func(fi *FullInfo, value string) error {
+		v, err := vartypes.ParseNullableInt(value)
+		*field(fi) = v
+		return err
+	}
+}
+
+// setEstimate is like setInt, but accepts fractional numbers, which are truncated
+func setEstimate(field func(fi *FullInfo) **int) func(fi *FullInfo, value string) error {
+	return func(fi *FullInfo, value string) error {
+		v, err := vartypes.ParseNullableFloat(value)
+		if v != nil {
+			*field(fi) = vartypes.IntPtr(int(*v))
+		}
+		return err
+	}
+}
+
+func setFloat(field func(fi *FullInfo) **float64) func(fi *FullInfo, value string) error {
+	return func(fi *FullInfo, value string) error {
+		v, err := vartypes.ParseNullableFloat(value)
+		*field(fi) = v
+		return err
+	}
+}
+
+// timelineIgnoredLabels are rows of the timeline CSV that we know of, but do not store
+var timelineIgnoredLabels = []string{"new_reinfections", "hospitalized", "intensive_care", "icu_discharges",
+	"cumulative_rtpcr_tests_raw", "cumulative_rapid_tests_raw"}
+
+// timelineRowsByLabel indexes timelineRows by their normalized labels
+func timelineRowsByLabel() map[string]*timelineRow {
+	res := make(map[string]*timelineRow)
+	for i := range timelineRows {
+		for _, l := range timelineRows[i].labels {
+			res[normalizeLabel(l)] = &timelineRows[i]
+		}
+	}
+	return res
+}
+
+// isIgnoredTimelineLabel reports whether a normalized label belongs to a row that is known, but not stored
+func isIgnoredTimelineLabel(label string) bool {
+	for _, l := range timelineIgnoredLabels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// missingTimelineRows returns the first label of every required timeline row that was not seen
+func missingTimelineRows(seen map[*timelineRow]bool) []string {
+	var missing []string
+	for i := range timelineRows {
+		if timelineRows[i].required && !seen[&timelineRows[i]] {
+			missing = append(missing, timelineRows[i].labels[0])
+		}
+	}
+	return missing
+}
+
+func normalizeLabel(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
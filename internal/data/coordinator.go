@@ -0,0 +1,397 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ingestion runs upsert the same tables, so a single one may run at a time, across all replicas. Within a replica,
+// runs are requested as jobs through Service.RequestRun: a request is coalesced into the job in progress if that job
+// populates all of its datasets, and queued behind it otherwise. Requests queued together share a single job. Across
+// replicas, jobs hold a Postgres advisory lock; scheduled jobs are skipped while another replica holds it, since every
+// replica follows the same schedule, while requested ones wait for it.
+
+// Outcomes of requesting an ingestion run.
+const (
+	// RunStarted runs were started right away
+	RunStarted = "started"
+	// RunCoalesced requests are served by the job in progress
+	RunCoalesced = "coalesced"
+	// RunQueued runs start once the run in progress, in this or another replica, is over
+	RunQueued = "queued"
+	// RunSkipped scheduled runs are left to the replica already populating the database
+	RunSkipped = "skipped"
+)
+
+// Statuses of jobs and of their datasets, besides those of ingestion runs.
+const (
+	StatusQueued    = "queued"
+	StatusCancelled = "cancelled"
+)
+
+// ErrJobFinished is returned when cancelling a job that is already over.
+var ErrJobFinished = errors.New("job is already finished")
+
+// ingestionLockKey identifies the advisory lock of ingestion runs
+const ingestionLockKey = 19_2020
+
+// maxFinishedJobs is the number of finished jobs kept for polling
+const maxFinishedJobs = 100
+
+// Job is a requested ingestion run, along with the progress of each of its datasets.
+type Job struct {
+	Id      int    `json:"id"`
+	Trigger string `json:"trigger"`
+	// Status is StatusQueued, StatusRunning, StatusSucceeded, StatusFailed, StatusCancelled or StatusSkipped, if it
+	// was scheduled while another replica was populating the database
+	Status string `json:"status"`
+	// RunId is the ingestion run of the job, once it started
+	RunId      int               `json:"run_id,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at"`
+	Datasets   []DatasetProgress `json:"datasets"`
+	Error      string            `json:"error,omitempty"`
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// all is set if the job populates all datasets
+	all bool
+}
+
+// DatasetProgress is the progress of a dataset of a job. Its status is StatusQueued until its step starts, and then
+// that of the step.
+type DatasetProgress struct {
+	Dataset string `json:"dataset"`
+	Status  string `json:"status"`
+	StepStats
+	Error string `json:"error,omitempty"`
+}
+
+// coordinator keeps track of the jobs of a service: the one in progress, the one queued behind it and the finished
+// ones, for polling
+type coordinator struct {
+	mu      sync.Mutex
+	running *Job
+	queued  *Job
+	jobs    map[int]*Job
+	// finished holds the ids of the finished jobs, oldest first
+	finished []int
+	lastId   int
+	// wg waits for the jobs in progress and queued
+	wg sync.WaitGroup
+}
+
+// newJob creates a queued job of datasets, or of all datasets if none is given, running on a child of ctx
+func (c *coordinator) newJob(ctx context.Context, trigger string, datasets, all []string) *Job {
+	c.lastId++
+	job := &Job{Id: c.lastId, Trigger: trigger, Status: StatusQueued, CreatedAt: time.Now(), all: len(datasets) == 0}
+	job.ctx, job.cancel = context.WithCancel(ctx)
+	if job.all {
+		datasets = all
+	}
+	job.add(datasets)
+	if c.jobs == nil {
+		c.jobs = make(map[int]*Job)
+	}
+	c.jobs[job.Id] = job
+	return job
+}
+
+// add adds datasets to the job, unless it already has them
+func (j *Job) add(datasets []string) {
+	for _, d := range datasets {
+		if !j.has(d) {
+			j.Datasets = append(j.Datasets, DatasetProgress{Dataset: d, Status: StatusQueued})
+		}
+	}
+}
+
+func (j *Job) has(dataset string) bool {
+	for _, d := range j.Datasets {
+		if d.Dataset == dataset {
+			return true
+		}
+	}
+	return false
+}
+
+// covers tells whether the job populates all the given datasets, none meaning all of them
+func (j *Job) covers(datasets []string) bool {
+	if j.all {
+		return true
+	}
+	if len(datasets) == 0 {
+		return false
+	}
+	for _, d := range datasets {
+		if !j.has(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// merge adds the datasets of another request to a queued job. Requests of the refresh endpoint take precedence over
+// scheduled ones, so that the job waits for other replicas.
+func (j *Job) merge(trigger string, datasets, all []string) {
+	if trigger == TriggerRefresh {
+		j.Trigger = trigger
+	}
+	if len(datasets) == 0 {
+		j.all, datasets = true, all
+	}
+	j.add(datasets)
+}
+
+// names returns the datasets to populate, nil meaning all of them
+func (j *Job) names() []string {
+	if j.all {
+		return nil
+	}
+	var res []string
+	for _, d := range j.Datasets {
+		res = append(res, d.Dataset)
+	}
+	return res
+}
+
+// snapshot returns a copy of the job that is safe to read while the job goes on
+func (j *Job) snapshot() Job {
+	res := *j
+	res.Datasets = append([]DatasetProgress(nil), j.Datasets...)
+	return res
+}
+
+// lockOutcome tells a request whether its job took the lock of ingestion runs right away
+type lockOutcome struct {
+	locked bool
+	err    error
+}
+
+// RequestRun asks for an ingestion run of the named datasets, or of all datasets if none is named. It returns the job
+// serving the request and what happened to the request: the job was either started, coalesced into the job in
+// progress, queued behind it or, if scheduled, skipped. Jobs go on in the background, on a child of ctx.
+func (s *Service) RequestRun(ctx context.Context, trigger string, datasets ...string) (Job, string, error) {
+	all := s.DatasetNames()
+	for _, name := range datasets {
+		if !contains(all, name) {
+			return Job{}, "", fmt.Errorf("unknown dataset %s, use one of %s", name, strings.Join(all, ", "))
+		}
+	}
+
+	c := &s.runs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running != nil {
+		if c.running.covers(datasets) {
+			return c.running.snapshot(), RunCoalesced, nil
+		}
+		if c.queued != nil {
+			c.queued.merge(trigger, datasets, all)
+		} else {
+			c.queued = c.newJob(ctx, trigger, datasets, all)
+		}
+		return c.queued.snapshot(), RunQueued, nil
+	}
+
+	job := c.newJob(ctx, trigger, datasets, all)
+	c.running = job
+	locked := make(chan lockOutcome, 1)
+	c.wg.Add(1)
+	go s.executeJobs(job, locked)
+	// the job is returned as it was requested, while c.mu is released until the job tried the lock, so that a slow
+	// database holds up neither other requests nor the job. Requests in the meantime are coalesced into the job or
+	// queued behind it.
+	requested := job.snapshot()
+	c.mu.Unlock()
+	outcome := <-locked
+	c.mu.Lock()
+	switch {
+	case outcome.err != nil:
+		return Job{}, "", outcome.err
+	case outcome.locked:
+		return requested, RunStarted, nil
+	case trigger == TriggerSchedule:
+		return requested, RunSkipped, nil
+	}
+	return requested, RunQueued, nil
+}
+
+// Job returns a job by its id. Finished jobs are kept for a while.
+func (s *Service) Job(id int) (Job, error) {
+	s.runs.mu.Lock()
+	defer s.runs.mu.Unlock()
+	job, ok := s.runs.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job.snapshot(), nil
+}
+
+// CancelJob cancels a queued or running job. Datasets of a running job that are already populated keep their rows.
+// ErrJobFinished is returned, along with the job, if it is already over.
+func (s *Service) CancelJob(id int) (Job, error) {
+	c := &s.runs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, ok := c.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if job.FinishedAt != nil {
+		return job.snapshot(), ErrJobFinished
+	}
+	job.cancel()
+	if c.queued == job {
+		c.queued = nil
+		c.finish(job, StatusCancelled, nil)
+	}
+	log.Printf("cancelled job %d", job.Id)
+	return job.snapshot(), nil
+}
+
+// WaitRuns waits for the jobs in progress and queued to finish. Cancelling their context stops them.
+func (s *Service) WaitRuns() {
+	s.runs.wg.Wait()
+}
+
+// executeJobs runs job, and then every job queued behind it, one at a time
+func (s *Service) executeJobs(job *Job, locked chan<- lockOutcome) {
+	c := &s.runs
+	defer c.wg.Done()
+	for job != nil {
+		status, err := s.executeJob(job, locked)
+		locked = nil
+
+		c.mu.Lock()
+		c.finish(job, status, err)
+		job, c.queued = c.queued, nil
+		c.running = job
+		c.mu.Unlock()
+	}
+}
+
+// executeJob populates the datasets of job holding the lock of ingestion runs, and returns the status it ended with.
+// If given, locked is told whether the lock was taken right away.
+func (s *Service) executeJob(job *Job, locked chan<- lockOutcome) (string, error) {
+	c := &s.runs
+	populate := func() error {
+		c.mu.Lock()
+		now := time.Now()
+		job.Status, job.StartedAt = StatusRunning, &now
+		c.mu.Unlock()
+
+		_, err := s.populateDatasets(job.ctx, job.Trigger, func(step IngestionStep) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.progress(job, step)
+		}, job.names()...)
+		return err
+	}
+	ok, err := s.repo.WithIngestionLock(job.ctx, false, func() error {
+		if locked != nil {
+			locked <- lockOutcome{locked: true}
+			locked = nil
+		}
+		return populate()
+	})
+	if locked != nil {
+		locked <- lockOutcome{err: err}
+	}
+	if err == nil && !ok {
+		if job.Trigger == TriggerSchedule {
+			log.Printf("skipping job %d, another replica is populating the database", job.Id)
+			return StatusSkipped, nil
+		}
+		log.Printf("job %d waits for another replica to finish populating the database", job.Id)
+		_, err = s.repo.WithIngestionLock(job.ctx, true, populate)
+	}
+	switch {
+	case job.ctx.Err() != nil:
+		return StatusCancelled, err
+	case err != nil:
+		log.Printf("ERROR: database population of job %d failed: %s", job.Id, err)
+		return StatusFailed, err
+	}
+	return StatusSucceeded, nil
+}
+
+// progress updates the dataset of a step of job. c.mu must be held.
+func (c *coordinator) progress(job *Job, step IngestionStep) {
+	if step.RunId > 0 {
+		job.RunId = step.RunId
+	}
+	for i := range job.Datasets {
+		d := &job.Datasets[i]
+		if d.Dataset == step.Dataset {
+			d.Status, d.StepStats, d.Error = step.Status, step.StepStats, step.Error
+		}
+	}
+}
+
+// finish ends job with a status. Datasets that never started end with the status of the job, or as failed if the job
+// succeeded without them. c.mu must be held.
+func (c *coordinator) finish(job *Job, status string, err error) {
+	job.cancel()
+	now := time.Now()
+	job.Status, job.FinishedAt = status, &now
+	if err != nil {
+		job.Error = err.Error()
+	}
+	for i := range job.Datasets {
+		d := &job.Datasets[i]
+		if d.Status == StatusQueued || d.Status == StatusRunning {
+			d.Status = status
+			if status == StatusSucceeded {
+				d.Status = StatusFailed
+			}
+		}
+	}
+
+	c.finished = append(c.finished, job.Id)
+	if len(c.finished) > maxFinishedJobs {
+		delete(c.jobs, c.finished[0])
+		c.finished = c.finished[1:]
+	}
+}
+
+// WithIngestionLock takes a session-level advisory lock on a connection of its own, which is held while fn runs. The
+// lock is released once fn returns, or along with the connection if the replica dies.
+func (r *PgRepo) WithIngestionLock(ctx context.Context, wait bool, fn func() error) (bool, error) {
+	if r.pool == nil {
+		return false, fmt.Errorf("the ingestion lock cannot be taken within a transaction")
+	}
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("cannot lock ingestion runs: %s", err)
+	}
+	defer conn.Release()
+
+	sql := `SELECT pg_try_advisory_lock($1)`
+	if wait {
+		// blocks until the lock is released, or ctx is done
+		sql = `SELECT true FROM pg_advisory_lock($1)`
+	}
+	locked := false
+	if err := conn.QueryRow(ctx, sql, ingestionLockKey).Scan(&locked); err != nil {
+		return false, fmt.Errorf("cannot lock ingestion runs: %s", err)
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		// ctx may be done by now
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, ingestionLockKey); err != nil {
+			// a closed connection is not returned to the pool, and its session takes the lock along with it
+			log.Printf("ERROR: cannot unlock ingestion runs, closing the connection: %s", err)
+			conn.Conn().Close(context.Background())
+		}
+	}()
+	return true, fn()
+}
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"covid19-greece-api/pkg/file"
+)
+
+func testCoordinatedService(t *testing.T) (*Service, *RepoMock) {
+	repo := NewRepoMock(gomock.NewController(t))
+	src := file.NewMemorySource("test", nil)
+	srv, err := NewService(repo, Sources{Cases: src, Timeline: src, DeathsPerMunicipality: src, Demographics: src,
+		Waste: src})
+	assert.Nil(t, err)
+	return srv, repo
+}
+
+func TestRequestRunCoalescesAndQueues(t *testing.T) {
+	srv, repo := testCoordinatedService(t)
+	ctx := context.Background()
+
+	repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, _ bool, fn func() error) (bool, error) {
+			return true, fn()
+		})
+	// runs fail right away once released, as nothing else is expected to be written
+	release := make(chan struct{})
+	var runs []string
+	repo.EXPECT().CreateIngestionRun(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, run *IngestionRun) error {
+			<-release
+			runs = append(runs, run.Trigger)
+			return errors.New("database is down")
+		})
+
+	started, outcome, err := srv.RequestRun(ctx, TriggerSchedule, DatasetCases, DatasetTimeline)
+	assert.Nil(t, err)
+	assert.Equal(t, RunStarted, outcome)
+
+	queuedId := started.Id + 1
+	for _, req := range []struct {
+		datasets []string
+		outcome  string
+		jobId    int
+	}{
+		{[]string{DatasetTimeline}, RunCoalesced, started.Id},
+		{[]string{DatasetDemographics}, RunQueued, queuedId},
+		{nil, RunQueued, queuedId},
+		{[]string{DatasetCases}, RunCoalesced, started.Id},
+	} {
+		job, outcome, err := srv.RequestRun(ctx, TriggerRefresh, req.datasets...)
+		assert.Nil(t, err)
+		assert.Equal(t, req.outcome, outcome, req.datasets)
+		assert.Equal(t, req.jobId, job.Id, req.datasets)
+	}
+	assert.True(t, srv.runs.queued.all)
+
+	_, _, err = srv.RequestRun(ctx, TriggerRefresh, DatasetWaste)
+	assert.NotNil(t, err)
+
+	// both queued requests are populated by a single run
+	close(release)
+	srv.WaitRuns()
+	assert.Equal(t, []string{TriggerSchedule, TriggerRefresh}, runs)
+	assert.Nil(t, srv.runs.running)
+
+	queued, err := srv.Job(queuedId)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusFailed, queued.Status)
+	assert.Equal(t, "cannot record ingestion run: database is down", queued.Error)
+	assert.Len(t, queued.Datasets, len(srv.DatasetNames()))
+	for _, d := range queued.Datasets {
+		assert.Equal(t, StatusFailed, d.Status, d.Dataset)
+	}
+}
+
+func TestRequestRunIsNotBlockedByTheLock(t *testing.T) {
+	srv, repo := testCoordinatedService(t)
+	ctx := context.Background()
+
+	// the lock takes a while, as the database is slow
+	trying, release := make(chan struct{}), make(chan struct{})
+	repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ bool, fn func() error) (bool, error) {
+			close(trying)
+			<-release
+			return true, fn()
+		})
+	repo.EXPECT().CreateIngestionRun(gomock.Any(), gomock.Any()).Return(errors.New("database is down"))
+	started := make(chan string)
+	go func() {
+		_, outcome, err := srv.RequestRun(ctx, TriggerRefresh, DatasetCases)
+		assert.Nil(t, err)
+		started <- outcome
+	}()
+	<-trying
+
+	// requests are served in the meantime
+	job, err := srv.Job(1)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+	job, outcome, err := srv.RequestRun(ctx, TriggerRefresh, DatasetCases)
+	assert.Nil(t, err)
+	assert.Equal(t, RunCoalesced, outcome)
+	assert.Equal(t, 1, job.Id)
+
+	close(release)
+	assert.Equal(t, RunStarted, <-started)
+	srv.WaitRuns()
+}
+
+func TestJobProgress(t *testing.T) {
+	srv, repo := testCoordinatedService(t)
+	ctx := context.Background()
+
+	repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).Return(true, nil)
+	job, _, err := srv.RequestRun(ctx, TriggerRefresh, DatasetCases, DatasetDemographics)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+	assert.Equal(t, []DatasetProgress{
+		{Dataset: DatasetCases, Status: StatusQueued},
+		{Dataset: DatasetDemographics, Status: StatusQueued},
+	}, job.Datasets)
+	srv.WaitRuns()
+
+	c := &srv.runs
+	c.mu.Lock()
+	running := c.jobs[job.Id]
+	running.Status = StatusRunning
+	c.progress(running, IngestionStep{RunId: 7, Dataset: DatasetCases, Status: StatusRunning})
+	c.progress(running, IngestionStep{RunId: 7, Dataset: DatasetDemographics, Status: StatusFailed, Error: "bad header",
+		StepStats: StepStats{RowsRead: 10, RowsRejected: 10}})
+	c.mu.Unlock()
+
+	job, err = srv.Job(job.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, job.RunId)
+	assert.Equal(t, []DatasetProgress{
+		{Dataset: DatasetCases, Status: StatusRunning},
+		{Dataset: DatasetDemographics, Status: StatusFailed, Error: "bad header",
+			StepStats: StepStats{RowsRead: 10, RowsRejected: 10}},
+	}, job.Datasets)
+
+	_, err = srv.Job(job.Id + 1)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestCancelJob(t *testing.T) {
+	srv, repo := testCoordinatedService(t)
+	ctx := context.Background()
+
+	// the running job goes on until it is cancelled
+	repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ bool, fn func() error) (bool, error) {
+			return true, fn()
+		})
+	repo.EXPECT().CreateIngestionRun(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ *IngestionRun) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	running, outcome, err := srv.RequestRun(ctx, TriggerRefresh, DatasetCases)
+	assert.Nil(t, err)
+	assert.Equal(t, RunStarted, outcome)
+	queued, outcome, err := srv.RequestRun(ctx, TriggerRefresh, DatasetTimeline)
+	assert.Nil(t, err)
+	assert.Equal(t, RunQueued, outcome)
+
+	// a queued job never runs
+	job, err := srv.CancelJob(queued.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusCancelled, job.Status)
+	assert.Equal(t, StatusCancelled, job.Datasets[0].Status)
+	assert.Nil(t, srv.runs.queued)
+
+	_, err = srv.CancelJob(running.Id)
+	assert.Nil(t, err)
+	srv.WaitRuns()
+	job, err = srv.Job(running.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusCancelled, job.Status)
+	assert.Equal(t, "cannot record ingestion run: context canceled", job.Error)
+
+	job, err = srv.CancelJob(running.Id)
+	assert.True(t, errors.Is(err, ErrJobFinished))
+	assert.Equal(t, StatusCancelled, job.Status)
+	_, err = srv.CancelJob(running.Id + 5)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestRequestRunDefersToOtherReplicas(t *testing.T) {
+	srv, repo := testCoordinatedService(t)
+	ctx := context.Background()
+
+	// another replica holds the lock
+	repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).Times(2).Return(false, nil)
+	skipped, outcome, err := srv.RequestRun(ctx, TriggerSchedule)
+	assert.Nil(t, err)
+	assert.Equal(t, RunSkipped, outcome)
+	srv.WaitRuns()
+	skipped, err = srv.Job(skipped.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusSkipped, skipped.Status)
+
+	// refresh requests wait for it
+	repo.EXPECT().WithIngestionLock(gomock.Any(), true, gomock.Any()).Return(true, nil)
+	_, outcome, err = srv.RequestRun(ctx, TriggerRefresh)
+	assert.Nil(t, err)
+	assert.Equal(t, RunQueued, outcome)
+	srv.WaitRuns()
+
+	repo.EXPECT().WithIngestionLock(gomock.Any(), false, gomock.Any()).Return(false, errors.New("database is down"))
+	_, _, err = srv.RequestRun(ctx, TriggerRefresh)
+	assert.NotNil(t, err)
+	srv.WaitRuns()
+}
@@ -0,0 +1,752 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+)
+
+// diffSamples is the number of changed values kept in every table diff
+const diffSamples = 10
+
+// errDryRun is returned by the dry run repository for writes that population never does.
+var errDryRun = errors.New("writes are not allowed in a dry run")
+
+// ValueChange is a value that a population would change.
+type ValueChange struct {
+	Key    string `json:"key"`
+	Column string `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// TableDiff summarizes how a population would change a table. Rows that are not in the sources are never touched,
+// so they are not counted.
+type TableDiff struct {
+	Table     string `json:"table"`
+	Existing  int    `json:"existing"`
+	New       int    `json:"new"`
+	Changed   int    `json:"changed"`
+	Unchanged int    `json:"unchanged"`
+	// Samples are the first changed values
+	Samples []ValueChange `json:"samples"`
+}
+
+// ChangedPercent is the percentage of the existing rows that would be changed
+func (d *TableDiff) ChangedPercent() float64 {
+	if d.Existing == 0 {
+		return 0
+	}
+	return 100 * float64(d.Changed) / float64(d.Existing)
+}
+
+// compare counts a row of the sources against the existing one, or against nothing if old is nil.
+// old and new are the values of columns.
+func (d *TableDiff) compare(key string, columns []string, old, new []interface{}) {
+	if old == nil {
+		d.New++
+		return
+	}
+	changed := false
+	for i, c := range columns {
+		o, n := formatValue(old[i]), formatValue(new[i])
+		if o == n {
+			continue
+		}
+		changed = true
+		if len(d.Samples) < diffSamples {
+			d.Samples = append(d.Samples, ValueChange{Key: key, Column: c, Old: o, New: n})
+		}
+	}
+	if changed {
+		d.Changed++
+	} else {
+		d.Unchanged++
+	}
+}
+
+// formatValue formats values of the database, dereferencing pointers. nil is "null" and times are dates.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case *int:
+		if v == nil {
+			return "null"
+		}
+		return strconv.Itoa(*v)
+	case *float64:
+		if v == nil {
+			return "null"
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	case *string:
+		if v == nil {
+			return "null"
+		}
+		return *v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(simpleDateLayout)
+	}
+	return fmt.Sprint(v)
+}
+
+// DiffReport is the outcome of a dry run, by table.
+type DiffReport struct {
+	Tables []*TableDiff `json:"tables"`
+	// Skipped are the datasets that were selected, but not compared
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// table returns the diff of a table, adding it to the report the first time
+func (r *DiffReport) table(name string) *TableDiff {
+	for _, t := range r.Tables {
+		if t.Table == name {
+			return t
+		}
+	}
+	t := &TableDiff{Table: name}
+	r.Tables = append(r.Tables, t)
+	return t
+}
+
+// Exceeds returns the tables whose changed rows are more than maxPercent of their existing rows
+func (r *DiffReport) Exceeds(maxPercent float64) []string {
+	var res []string
+	for _, t := range r.Tables {
+		if t.ChangedPercent() > maxPercent {
+			res = append(res, t.Table)
+		}
+	}
+	return res
+}
+
+func (r *DiffReport) String() string {
+	var b strings.Builder
+	for _, t := range r.Tables {
+		fmt.Fprintf(&b, "%s: %d existing rows, %d new, %d changed (%.1f%%), %d unchanged\n", t.Table, t.Existing,
+			t.New, t.Changed, t.ChangedPercent(), t.Unchanged)
+		for _, s := range t.Samples {
+			fmt.Fprintf(&b, "  %s, %s: %s -> %s\n", s.Key, s.Column, s.Old, s.New)
+		}
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&b, "skipped, as dry runs do not compare registry datasets: %s\n", strings.Join(r.Skipped, ", "))
+	}
+	return b.String()
+}
+
+// Steps selects what a dry run populates.
+type Steps struct {
+	RegionalUnits         bool
+	Cases                 bool
+	Waste                 bool
+	Timeline              bool
+	DeathsPerMunicipality bool
+	Demographics          bool
+	// Vaccinations are left out if their source is not set
+	Vaccinations bool
+	// Registry are datasets of the registry, which dry runs do not compare, but report as skipped
+	Registry []string
+}
+
+// AllSteps populates all built-in datasets
+var AllSteps = Steps{RegionalUnits: true, Cases: true, Waste: true, Timeline: true, DeathsPerMunicipality: true,
+	Demographics: true, Vaccinations: true}
+
+// DryRun parses and validates the sources of the selected steps, and compares them with the current contents of the
+// database, without writing anything. Values that would be quarantined are compared as they would be published.
+func (s *Service) DryRun(ctx context.Context, steps Steps) (*DiffReport, error) {
+	repo := newDryRunRepo(s.repo)
+	repo.report.Skipped = append(repo.report.Skipped, steps.Registry...)
+	for _, st := range []struct {
+		run      bool
+		name     string
+		populate populateFunc
+		sources  []string
+	}{
+		{steps.RegionalUnits, "regional units", s.populateRegionalUnits, []string{DatasetCases}},
+		{steps.Cases, "cases", s.populateCases, []string{DatasetCases}},
+		{steps.Waste, "waste", s.populateWaste, []string{DatasetWaste}},
+		{steps.Timeline, "timeline", s.populateTimeline, []string{DatasetTimeline}},
+		{steps.DeathsPerMunicipality, "deaths per municipality", s.populateDeathsPerMunicipality,
+			[]string{DatasetDeathsPerMunicipality}},
+		{steps.Demographics, "demographics", s.populateDemographic, []string{DatasetDemographics}},
+		{steps.Vaccinations && s.vaccinationsSrc != nil, "vaccinations", s.populateVaccinations,
+			[]string{DatasetVaccinations}},
+	} {
+		if !st.run {
+			continue
+		}
+		if err := s.validate(ctx, st.sources...); err != nil {
+			return repo.report, err
+		}
+		if err := st.populate(ctx, repo, &StepStats{}); err != nil {
+			return repo.report, fmt.Errorf("dry run of %s failed: %s", st.name, err)
+		}
+	}
+	return repo.report, nil
+}
+
+// dryRunRepo reads from the database, while it compares what would be written with what is already there.
+// It never writes: writes that population does are compared, and the rest fail with errDryRun.
+type dryRunRepo struct {
+	db     Repo
+	report *DiffReport
+
+	// regional units by normalized name, municipalities by slug and waste sites by name, as they would be after
+	// populating
+	regionalUnits  map[string]RegionalUnit
+	municipalities map[string]Municipality
+	wasteSites     map[string]WasteSite
+	// new municipalities get negative ids, as they have none yet
+	nextMunId int
+
+	cases        []CaseRecord
+	timeline     []FullInfo
+	deaths       []YearlyDeaths
+	demographics []DemographicInfo
+	waste        []WasteMeasurement
+	vaccinations []VaccinationRecord
+	// mergedWaste are all measurements as they would be after merging the staged ones, once merged
+	mergedWaste []WasteMeasurement
+}
+
+func newDryRunRepo(repo Repo) *dryRunRepo {
+	return &dryRunRepo{db: repo, report: &DiffReport{}, nextMunId: -1}
+}
+
+func (r *dryRunRepo) WithTx(_ context.Context, fn func(repo Repo) error) error {
+	return fn(r)
+}
+
+func (r *dryRunRepo) WithSnapshot(_ context.Context, fn func(repo Repo) error) error {
+	return fn(r)
+}
+
+func (r *dryRunRepo) loadRegionalUnits(ctx context.Context) error {
+	if r.regionalUnits != nil {
+		return nil
+	}
+	units, err := r.db.GetRegionalUnits(ctx)
+	if err != nil {
+		return err
+	}
+	r.regionalUnits = make(map[string]RegionalUnit)
+	for _, ru := range units {
+		r.regionalUnits[ru.RegionalUnitNormalized] = ru
+	}
+	r.report.table("regional_units").Existing = len(units)
+	return nil
+}
+
+// AddRegionalUnit never updates existing regional units, like PgRepo.AddRegionalUnit
+func (r *dryRunRepo) AddRegionalUnit(ctx context.Context, ru RegionalUnit) (bool, error) {
+	if err := r.loadRegionalUnits(ctx); err != nil {
+		return false, err
+	}
+	diff := r.report.table("regional_units")
+	if _, ok := r.regionalUnits[ru.RegionalUnitNormalized]; ok {
+		diff.Unchanged++
+		return false, nil
+	}
+	diff.New++
+	r.regionalUnits[ru.RegionalUnitNormalized] = ru
+	return true, nil
+}
+
+func (r *dryRunRepo) AddMunicipality(ctx context.Context, name string) (int, error) {
+	if r.municipalities == nil {
+		muns, err := r.db.GetMunicipalities(ctx)
+		if err != nil {
+			return 0, err
+		}
+		r.municipalities = make(map[string]Municipality)
+		for _, m := range muns {
+			r.municipalities[m.Slug] = m
+		}
+		r.report.table("municipalities").Existing = len(muns)
+	}
+	diff := r.report.table("municipalities")
+	if m, ok := r.municipalities[slug.Make(name)]; ok {
+		diff.Unchanged++
+		return m.Id, nil
+	}
+	diff.New++
+	m := Municipality{Id: r.nextMunId, Name: name, Slug: slug.Make(name)}
+	r.nextMunId--
+	r.municipalities[m.Slug] = m
+	return m.Id, nil
+}
+
+func (r *dryRunRepo) StageCases(_ context.Context, cases []CaseRecord) error {
+	r.cases = append(r.cases, cases...)
+	return nil
+}
+
+func (r *dryRunRepo) MergeCases(ctx context.Context) (MergeResult, error) {
+	if err := r.loadRegionalUnits(ctx); err != nil {
+		return MergeResult{}, err
+	}
+	current, err := r.db.GetCases(ctx, CasesFilter{})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	slugs := make(map[int]string)
+	known := make(map[string]bool)
+	for _, ru := range r.regionalUnits {
+		slugs[ru.Id] = ru.Slug
+		known[ru.Slug] = true
+	}
+	existing := make(map[string]Case)
+	for _, c := range current {
+		existing[slugs[c.RegionalUnitId]+" "+c.Date.Format(simpleDateLayout)] = c
+	}
+
+	diff := r.report.table("cases_per_regional_unit")
+	diff.Existing = len(current)
+	staged := make(map[string]CaseRecord)
+	var keys []string
+	for _, c := range r.cases {
+		// cases of unknown regional units are dropped, like PgRepo.MergeCases does
+		if !known[c.RegionalUnitSlug] {
+			continue
+		}
+		key := c.RegionalUnitSlug + " " + c.Date.Format(simpleDateLayout)
+		if _, ok := staged[key]; !ok {
+			keys = append(keys, key)
+		}
+		staged[key] = c
+	}
+	r.cases = nil
+	for _, key := range keys {
+		var old []interface{}
+		if c, ok := existing[key]; ok {
+			old = caseValues(c.Cases, c.PeriodStart, c.PeriodEnd, c.Cadence)
+		}
+		c := staged[key]
+		diff.compare(key, caseValueColumns, old, caseValues(c.Cases, c.PeriodStart, c.PeriodEnd, c.Cadence))
+	}
+	return diff.result(), nil
+}
+
+func (r *dryRunRepo) StageTimeline(_ context.Context, infos []FullInfo) error {
+	r.timeline = append(r.timeline, infos...)
+	return nil
+}
+
+func (r *dryRunRepo) MergeTimeline(ctx context.Context) (MergeResult, error) {
+	current, err := r.db.GetFromTimeline(ctx, DatesFilter{})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	existing := make(map[string]FullInfo)
+	for _, fi := range current {
+		existing[fi.Date.Format(simpleDateLayout)] = fi
+	}
+
+	diff := r.report.table("greece_timeline")
+	diff.Existing = len(current)
+	staged, keys := lastByKey(len(r.timeline), func(i int) string { return r.timeline[i].Date.Format(simpleDateLayout) })
+	for _, key := range keys {
+		var old []interface{}
+		if fi, ok := existing[key]; ok {
+			old = timelineValues(fi)
+		}
+		diff.compare(key, timelineValueColumns, old, timelineValues(r.timeline[staged[key]]))
+	}
+	r.timeline = nil
+	return diff.result(), nil
+}
+
+func (r *dryRunRepo) StageYearlyDeaths(_ context.Context, deaths []YearlyDeaths) error {
+	r.deaths = append(r.deaths, deaths...)
+	return nil
+}
+
+func (r *dryRunRepo) MergeYearlyDeaths(ctx context.Context) (MergeResult, error) {
+	current, err := r.db.GetDeathsPerMunicipality(ctx, DeathsFilter{})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	names := make(map[int]string)
+	for _, m := range r.municipalities {
+		names[m.Id] = m.Name
+	}
+	key := func(d YearlyDeaths) string {
+		return fmt.Sprintf("%s %d", names[d.MunId], d.Year)
+	}
+	existing := make(map[string]YearlyDeaths)
+	for _, d := range current {
+		existing[key(d)] = d
+	}
+
+	diff := r.report.table("deaths_per_municipality_cum")
+	diff.Existing = len(current)
+	staged, keys := lastByKey(len(r.deaths), func(i int) string { return key(r.deaths[i]) })
+	for _, k := range keys {
+		var old []interface{}
+		if d, ok := existing[k]; ok {
+			old = []interface{}{d.Deaths}
+		}
+		diff.compare(k, []string{"deaths_cum"}, old, []interface{}{r.deaths[staged[k]].Deaths})
+	}
+	r.deaths = nil
+	return diff.result(), nil
+}
+
+func (r *dryRunRepo) StageDemographicInfo(_ context.Context, infos []DemographicInfo) error {
+	r.demographics = append(r.demographics, infos...)
+	return nil
+}
+
+func (r *dryRunRepo) MergeDemographicInfo(ctx context.Context) (MergeResult, error) {
+	current, err := r.db.GetDemographicInfo(ctx, DemographicFilter{})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	key := func(info DemographicInfo) string {
+		return info.Date.Format(simpleDateLayout) + " " + info.Category
+	}
+	existing := make(map[string]DemographicInfo)
+	for _, info := range current {
+		existing[key(info)] = info
+	}
+
+	diff := r.report.table("demography_per_age")
+	diff.Existing = len(current)
+	staged, keys := lastByKey(len(r.demographics), func(i int) string { return key(r.demographics[i]) })
+	for _, k := range keys {
+		var old []interface{}
+		if info, ok := existing[k]; ok {
+			old = demographicValues(info)
+		}
+		diff.compare(k, demographicValueColumns, old, demographicValues(r.demographics[staged[k]]))
+	}
+	r.demographics = nil
+	return diff.result(), nil
+}
+
+// AddWasteSite never updates existing sites, like PgRepo.AddWasteSite
+func (r *dryRunRepo) AddWasteSite(ctx context.Context, site WasteSite) (bool, error) {
+	if r.wasteSites == nil {
+		sites, err := r.db.GetWasteSites(ctx)
+		if err != nil {
+			return false, err
+		}
+		r.wasteSites = make(map[string]WasteSite)
+		for _, ws := range sites {
+			r.wasteSites[ws.Name] = ws
+		}
+		r.report.table("waste_sites").Existing = len(sites)
+	}
+	diff := r.report.table("waste_sites")
+	if _, ok := r.wasteSites[site.Name]; ok {
+		diff.Unchanged++
+		return false, nil
+	}
+	diff.New++
+	r.wasteSites[site.Name] = site
+	return true, nil
+}
+
+func (r *dryRunRepo) StageWaste(_ context.Context, measurements []WasteMeasurement) error {
+	r.waste = append(r.waste, measurements...)
+	return nil
+}
+
+func (r *dryRunRepo) MergeWaste(ctx context.Context) (MergeResult, error) {
+	current, err := r.db.GetWaste(ctx, WasteFilter{})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	key := func(m WasteMeasurement) string {
+		return fmt.Sprintf("%s %d-%d", m.Site, m.Year, m.Week)
+	}
+	existing := make(map[string]WasteMeasurement)
+	for _, m := range current {
+		existing[key(m)] = m
+	}
+
+	diff := r.report.table("waste_measurements")
+	diff.Existing = len(current)
+	// measurements of unknown sites are dropped, like PgRepo.MergeWaste does
+	var known []WasteMeasurement
+	for _, m := range r.waste {
+		if _, ok := r.wasteSites[m.Site]; ok {
+			known = append(known, m)
+		}
+	}
+	columns := []string{"week_start", "week_end", "percentage"}
+	values := func(m WasteMeasurement) []interface{} {
+		return []interface{}{m.WeekStart.Format(simpleDateLayout), m.WeekEnd.Format(simpleDateLayout), m.Percentage}
+	}
+	staged, keys := lastByKey(len(known), func(i int) string { return key(known[i]) })
+	for _, k := range keys {
+		var old []interface{}
+		if m, ok := existing[k]; ok {
+			old = values(m)
+		}
+		diff.compare(k, columns, old, values(known[staged[k]]))
+	}
+
+	r.mergedWaste = make([]WasteMeasurement, 0, len(existing)+len(keys))
+	for _, m := range current {
+		if i, ok := staged[key(m)]; ok {
+			m.WeekStart, m.WeekEnd, m.Percentage = known[i].WeekStart, known[i].WeekEnd, known[i].Percentage
+		}
+		r.mergedWaste = append(r.mergedWaste, m)
+	}
+	for _, k := range keys {
+		if _, ok := existing[k]; !ok {
+			r.mergedWaste = append(r.mergedWaste, known[staged[k]])
+		}
+	}
+	// in the order of PgRepo.GetWaste
+	sort.SliceStable(r.mergedWaste, func(i, j int) bool {
+		a, b := r.mergedWaste[i], r.mergedWaste[j]
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		if a.Week != b.Week {
+			return a.Week < b.Week
+		}
+		return a.Site < b.Site
+	})
+	r.waste = nil
+	return diff.result(), nil
+}
+
+// GetWaste returns the merged measurements once waste was merged, so that the timeline is compared with the highest
+// measurements it would get
+func (r *dryRunRepo) GetWaste(ctx context.Context, filter WasteFilter) ([]WasteMeasurement, error) {
+	if r.mergedWaste != nil && filter == (WasteFilter{}) {
+		return r.mergedWaste, nil
+	}
+	return r.db.GetWaste(ctx, filter)
+}
+
+func (r *dryRunRepo) StageVaccinations(_ context.Context, records []VaccinationRecord) error {
+	r.vaccinations = append(r.vaccinations, records...)
+	return nil
+}
+
+func (r *dryRunRepo) MergeVaccinations(ctx context.Context) (MergeResult, error) {
+	if err := r.loadRegionalUnits(ctx); err != nil {
+		return MergeResult{}, err
+	}
+	current, err := r.db.GetVaccinations(ctx, VaccinationsFilter{})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	slugs := make(map[int]string)
+	knownSlugs := make(map[string]bool)
+	for _, ru := range r.regionalUnits {
+		slugs[ru.Id] = ru.Slug
+		knownSlugs[ru.Slug] = true
+	}
+	key := func(ru string, d time.Time, dose int) string {
+		return fmt.Sprintf("%s %s dose %d", ru, d.Format(simpleDateLayout), dose)
+	}
+	existing := make(map[string]Vaccination)
+	for _, v := range current {
+		existing[key(slugs[*v.RegionalUnitId], v.Date, v.Dose)] = v
+	}
+
+	diff := r.report.table("vaccinations")
+	diff.Existing = len(current)
+	// vaccinations of unknown regional units are dropped, like PgRepo.MergeVaccinations does
+	var known []VaccinationRecord
+	for _, v := range r.vaccinations {
+		if knownSlugs[v.RegionalUnitSlug] {
+			known = append(known, v)
+		}
+	}
+	columns := []string{"doses"}
+	staged, keys := lastByKey(len(known), func(i int) string {
+		return key(known[i].RegionalUnitSlug, known[i].Date, known[i].Dose)
+	})
+	for _, k := range keys {
+		var old []interface{}
+		if v, ok := existing[k]; ok {
+			old = []interface{}{v.Doses}
+		}
+		diff.compare(k, columns, old, []interface{}{known[staged[k]].Doses})
+	}
+	r.vaccinations = nil
+	return diff.result(), nil
+}
+
+// QuarantineValue only counts the values that would be quarantined
+func (r *dryRunRepo) QuarantineValue(_ context.Context, _ *QuarantinedValue) error {
+	r.report.table("quarantined_values").New++
+	return nil
+}
+
+// registry datasets are not part of dry runs
+func (r *dryRunRepo) EnsureDatasetTable(context.Context, DatasetDefinition) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) StageDatasetRows(context.Context, DatasetDefinition, [][]interface{}) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) MergeDatasetRows(context.Context, DatasetDefinition) (MergeResult, error) {
+	return MergeResult{}, errDryRun
+}
+
+func (r *dryRunRepo) SaveSourceState(context.Context, SourceState) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) CreateIngestionRun(context.Context, *IngestionRun) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) FinishIngestionRun(context.Context, *IngestionRun) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) AddIngestionStep(context.Context, *IngestionStep) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) ResolveQuarantinedValue(context.Context, int, string, time.Time) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) SetTimelineValue(context.Context, time.Time, string, *float64) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) SyncHierarchy(context.Context) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) DeleteTableRows(context.Context, string) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) ImportTableRows(context.Context, string, []string, func() ([]*string, error)) error {
+	return errDryRun
+}
+
+func (r *dryRunRepo) WithIngestionLock(context.Context, bool, func() error) (bool, error) {
+	return false, errDryRun
+}
+
+// Reads go to the database. Every method of Repo is listed here or above, so that new ones cannot reach the database
+// unnoticed.
+
+func (r *dryRunRepo) GetRegionalUnits(ctx context.Context) ([]RegionalUnit, error) {
+	return r.db.GetRegionalUnits(ctx)
+}
+
+func (r *dryRunRepo) GetCases(ctx context.Context, filter CasesFilter) ([]Case, error) {
+	return r.db.GetCases(ctx, filter)
+}
+
+func (r *dryRunRepo) GetFromTimeline(ctx context.Context, filter DatesFilter) ([]FullInfo, error) {
+	return r.db.GetFromTimeline(ctx, filter)
+}
+
+func (r *dryRunRepo) GetMunicipalities(ctx context.Context) ([]Municipality, error) {
+	return r.db.GetMunicipalities(ctx)
+}
+
+func (r *dryRunRepo) GetDeathsPerMunicipality(ctx context.Context, filter DeathsFilter) ([]YearlyDeaths, error) {
+	return r.db.GetDeathsPerMunicipality(ctx, filter)
+}
+
+func (r *dryRunRepo) GetDemographicInfo(ctx context.Context, filter DemographicFilter) ([]DemographicInfo, error) {
+	return r.db.GetDemographicInfo(ctx, filter)
+}
+
+func (r *dryRunRepo) GetCadencePeriods(ctx context.Context, dataset string) ([]CadencePeriod, error) {
+	return r.db.GetCadencePeriods(ctx, dataset)
+}
+
+func (r *dryRunRepo) GetHierarchy(ctx context.Context) ([]HierarchyNode, error) {
+	return r.db.GetHierarchy(ctx)
+}
+
+func (r *dryRunRepo) GetDeathsPerArea(ctx context.Context, filter DeathsFilter, level AreaLevel) ([]AreaDeaths, error) {
+	return r.db.GetDeathsPerArea(ctx, filter, level)
+}
+
+func (r *dryRunRepo) GetSourceState(ctx context.Context, name string) (SourceState, error) {
+	return r.db.GetSourceState(ctx, name)
+}
+
+func (r *dryRunRepo) GetIngestionRuns(ctx context.Context) ([]IngestionRun, error) {
+	return r.db.GetIngestionRuns(ctx)
+}
+
+func (r *dryRunRepo) GetIngestionRun(ctx context.Context, id int) (IngestionRun, error) {
+	return r.db.GetIngestionRun(ctx, id)
+}
+
+func (r *dryRunRepo) GetQuarantinedValues(ctx context.Context, filter QuarantineFilter) ([]QuarantinedValue, error) {
+	return r.db.GetQuarantinedValues(ctx, filter)
+}
+
+func (r *dryRunRepo) GetQuarantinedValue(ctx context.Context, id int) (QuarantinedValue, error) {
+	return r.db.GetQuarantinedValue(ctx, id)
+}
+
+func (r *dryRunRepo) GetRevisions(ctx context.Context, filter RevisionFilter) ([]Revision, error) {
+	return r.db.GetRevisions(ctx, filter)
+}
+
+func (r *dryRunRepo) GetWasteSites(ctx context.Context) ([]WasteSite, error) {
+	return r.db.GetWasteSites(ctx)
+}
+
+func (r *dryRunRepo) GetVaccinations(ctx context.Context, filter VaccinationsFilter) ([]Vaccination, error) {
+	return r.db.GetVaccinations(ctx, filter)
+}
+
+func (r *dryRunRepo) GetDatasetRows(ctx context.Context, def DatasetDefinition,
+	filter DatesFilter) ([]map[string]interface{}, error) {
+	return r.db.GetDatasetRows(ctx, def, filter)
+}
+
+func (r *dryRunRepo) GetTableColumns(ctx context.Context, table string) ([]string, error) {
+	return r.db.GetTableColumns(ctx, table)
+}
+
+func (r *dryRunRepo) ExportTableRows(ctx context.Context, table string, columns []string,
+	fn func(values []*string) error) error {
+	return r.db.ExportTableRows(ctx, table, columns, fn)
+}
+
+func (r *dryRunRepo) CountTableRows(ctx context.Context, table string) (int, error) {
+	return r.db.CountTableRows(ctx, table)
+}
+
+// result counts the diff as the merge would
+func (d *TableDiff) result() MergeResult {
+	return MergeResult{Inserted: d.New, Updated: d.Changed}
+}
+
+// lastByKey indexes n staged rows by their key, keeping the last row of every key like the merges do.
+// Keys are returned sorted.
+func lastByKey(n int, key func(i int) string) (map[string]int, []string) {
+	res := make(map[string]int)
+	for i := 0; i < n; i++ {
+		res[key(i)] = i
+	}
+	keys := make([]string, 0, len(res))
+	for k := range res {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return res, keys
+}
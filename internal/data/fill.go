@@ -0,0 +1,123 @@
+package data
+
+import "fmt"
+
+// Fill is the way values that were not reported are filled in responses.
+type Fill string
+
+const (
+	// FillNull leaves missing values nil. It is the default.
+	FillNull Fill = "null"
+	// FillZero replaces missing values with zero.
+	FillZero Fill = "zero"
+	// FillPrevious replaces missing values with the previous reported value of the same series. Values missing before
+	// anything was reported remain nil.
+	FillPrevious Fill = "previous"
+)
+
+// ParseFill parses a fill strategy. An empty string is FillNull.
+func ParseFill(s string) (Fill, error) {
+	switch Fill(s) {
+	case "", FillNull:
+		return FillNull, nil
+	case FillZero, FillPrevious:
+		return Fill(s), nil
+	}
+	return FillNull, fmt.Errorf("unknown fill %q, use one of null, zero or previous", s)
+}
+
+// FillTimeline fills the missing values of a timeline sorted by date. Waste places are only filled with previous.
+func FillTimeline(infos []FullInfo, fill Fill) {
+	if fill == FillNull {
+		return
+	}
+	for i := range infos {
+		var prev *FullInfo
+		if i > 0 {
+			prev = &infos[i-1]
+		}
+		fi := &infos[i]
+		fillValue(&fi.Cases, prevField(prev, func(p *FullInfo) *int { return p.Cases }), fill)
+		fillValue(&fi.TotalReinfections, prevField(prev, func(p *FullInfo) *int { return p.TotalReinfections }), fill)
+		fillValue(&fi.Deaths, prevField(prev, func(p *FullInfo) *int { return p.Deaths }), fill)
+		fillValue(&fi.DeathsCum, prevField(prev, func(p *FullInfo) *int { return p.DeathsCum }), fill)
+		fillValue(&fi.Recovered, prevField(prev, func(p *FullInfo) *int { return p.Recovered }), fill)
+		fillValue(&fi.HospitalAdmissions, prevField(prev, func(p *FullInfo) *int { return p.HospitalAdmissions }), fill)
+		fillValue(&fi.HospitalDischarges, prevField(prev, func(p *FullInfo) *int { return p.HospitalDischarges }), fill)
+		fillValue(&fi.Intubated, prevField(prev, func(p *FullInfo) *int { return p.Intubated }), fill)
+		fillValue(&fi.IntubatedVac, prevField(prev, func(p *FullInfo) *int { return p.IntubatedVac }), fill)
+		fillValue(&fi.IntubatedUnvac, prevField(prev, func(p *FullInfo) *int { return p.IntubatedUnvac }), fill)
+		fillValue(&fi.IcuOccupancy, prevField(prev, func(p *FullInfo) *float64 { return p.IcuOccupancy }), fill)
+		fillValue(&fi.BedsOccupancy, prevField(prev, func(p *FullInfo) *float64 { return p.BedsOccupancy }), fill)
+		fillValue(&fi.EstimatedNewRtpcrTests, prevField(prev, func(p *FullInfo) *int { return p.EstimatedNewRtpcrTests }), fill)
+		fillValue(&fi.EstimatedNewRapidTests, prevField(prev, func(p *FullInfo) *int { return p.EstimatedNewRapidTests }), fill)
+		fillValue(&fi.EstimatedNewTotalTests, prevField(prev, func(p *FullInfo) *int { return p.EstimatedNewTotalTests }), fill)
+		fillValue(&fi.CasesCum, prevField(prev, func(p *FullInfo) *int { return p.CasesCum }), fill)
+		fillValue(&fi.WasteHighestPercent, prevField(prev, func(p *FullInfo) *float64 { return p.WasteHighestPercent }), fill)
+		if fill == FillPrevious {
+			fillValue(&fi.WasteHighestPlace, prevField(prev, func(p *FullInfo) *string { return p.WasteHighestPlace }), fill)
+			fillValue(&fi.WasteHighestPlaceEn, prevField(prev, func(p *FullInfo) *string { return p.WasteHighestPlaceEn }), fill)
+		}
+	}
+}
+
+// FillCases fills the missing cases, sorted by date. Previous values are those of the same regional unit.
+func FillCases(cases []Case, fill Fill) {
+	if fill == FillNull {
+		return
+	}
+	prev := make(map[int]*int)
+	for i := range cases {
+		c := &cases[i]
+		fillValue(&c.Cases, prev[c.RegionalUnitId], fill)
+		prev[c.RegionalUnitId] = c.Cases
+	}
+}
+
+// FillDemographics fills the missing numbers of demographics, sorted by date. Previous values are those of the same
+// category.
+func FillDemographics(infos []DemographicInfo, fill Fill) {
+	if fill == FillNull {
+		return
+	}
+	prev := make(map[string]*DemographicInfo)
+	for i := range infos {
+		info := &infos[i]
+		p := prev[info.Category]
+		fillValue(&info.Cases, prevField(p, func(p *DemographicInfo) *int { return p.Cases }), fill)
+		fillValue(&info.Deaths, prevField(p, func(p *DemographicInfo) *int { return p.Deaths }), fill)
+		fillValue(&info.Intensive, prevField(p, func(p *DemographicInfo) *int { return p.Intensive }), fill)
+		fillValue(&info.Discharged, prevField(p, func(p *DemographicInfo) *int { return p.Discharged }), fill)
+		fillValue(&info.Hospitalized, prevField(p, func(p *DemographicInfo) *int { return p.Hospitalized }), fill)
+		fillValue(&info.HospitalizedInIcu, prevField(p, func(p *DemographicInfo) *int { return p.HospitalizedInIcu }), fill)
+		fillValue(&info.PassedAway, prevField(p, func(p *DemographicInfo) *int { return p.PassedAway }), fill)
+		fillValue(&info.Recovered, prevField(p, func(p *DemographicInfo) *int { return p.Recovered }), fill)
+		fillValue(&info.TreatedAtHome, prevField(p, func(p *DemographicInfo) *int { return p.TreatedAtHome }), fill)
+		prev[info.Category] = info
+	}
+}
+
+// fillValue fills v if it is missing. prev is the previous value of the series, which has already been filled.
+func fillValue[T any](v **T, prev *T, fill Fill) {
+	if *v != nil {
+		return
+	}
+	switch fill {
+	case FillZero:
+		var zero T
+		*v = &zero
+	case FillPrevious:
+		if prev != nil {
+			p := *prev
+			*v = &p
+		}
+	}
+}
+
+// prevField returns a field of the previous item, or nil if there is no previous item
+func prevField[I, T any](prev *I, field func(p *I) *T) *T {
+	if prev == nil {
+		return nil
+	}
+	return field(prev)
+}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"covid19-greece-api/pkg/vartypes"
+)
+
+func TestParseFill(t *testing.T) {
+	for s, expected := range map[string]Fill{"": FillNull, "null": FillNull, "zero": FillZero, "previous": FillPrevious} {
+		fill, err := ParseFill(s)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, fill)
+	}
+	_, err := ParseFill("average")
+	assert.NotNil(t, err)
+}
+
+func TestFillTimeline(t *testing.T) {
+	timeline := func() []FullInfo {
+		return []FullInfo{
+			{Date: time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC)},
+			{Date: time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), Cases: vartypes.IntPtr(3),
+				IcuOccupancy: vartypes.FloatPtr(0.5), WasteHighestPlace: vartypes.StringPtr("Πάτρα")},
+			{Date: time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC)},
+		}
+	}
+
+	infos := timeline()
+	FillTimeline(infos, FillNull)
+	assert.Equal(t, timeline(), infos)
+
+	infos = timeline()
+	FillTimeline(infos, FillZero)
+	assert.Equal(t, vartypes.IntPtr(0), infos[0].Cases)
+	assert.Equal(t, vartypes.IntPtr(3), infos[1].Cases)
+	assert.Equal(t, vartypes.IntPtr(0), infos[2].Cases)
+	assert.Equal(t, vartypes.FloatPtr(0), infos[2].IcuOccupancy)
+	assert.Nil(t, infos[2].WasteHighestPlace)
+
+	infos = timeline()
+	FillTimeline(infos, FillPrevious)
+	assert.Nil(t, infos[0].Cases)
+	assert.Equal(t, vartypes.IntPtr(3), infos[2].Cases)
+	assert.Equal(t, vartypes.FloatPtr(0.5), infos[2].IcuOccupancy)
+	assert.Equal(t, vartypes.StringPtr("Πάτρα"), infos[2].WasteHighestPlace)
+	// filling must not share values between dates
+	*infos[2].Cases = 4
+	assert.Equal(t, vartypes.IntPtr(3), infos[1].Cases)
+}
+
+func TestFillCasesPerRegionalUnit(t *testing.T) {
+	d := time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC)
+	cases := []Case{
+		{RegionalUnitId: 1, Date: d, Cases: vartypes.IntPtr(5)},
+		{RegionalUnitId: 2, Date: d},
+		{RegionalUnitId: 1, Date: d.AddDate(0, 0, 1)},
+		{RegionalUnitId: 2, Date: d.AddDate(0, 0, 1)},
+	}
+	FillCases(cases, FillPrevious)
+	assert.Nil(t, cases[1].Cases)
+	assert.Equal(t, vartypes.IntPtr(5), cases[2].Cases)
+	assert.Nil(t, cases[3].Cases)
+}
+
+func TestFillDemographicsPerCategory(t *testing.T) {
+	d := time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC)
+	infos := []DemographicInfo{
+		{Date: d, Category: "0-17", Deaths: vartypes.IntPtr(1)},
+		{Date: d, Category: "18-39", Deaths: vartypes.IntPtr(2)},
+		{Date: d.AddDate(0, 0, 1), Category: "0-17"},
+		{Date: d.AddDate(0, 0, 1), Category: "18-39", Deaths: vartypes.IntPtr(3)},
+	}
+	FillDemographics(infos, FillPrevious)
+	assert.Equal(t, vartypes.IntPtr(1), infos[2].Deaths)
+	assert.Nil(t, infos[2].Cases)
+	assert.Equal(t, vartypes.IntPtr(3), infos[3].Deaths)
+}
@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gosimple/slug"
+	"github.com/jackc/pgx/v4"
+)
+
+// The administrative hierarchy of Greece: municipality -> regional unit -> prefecture -> department. Prefectures
+// and departments are those of the regional units, while municipalities are linked to their regional units by the
+// YPES registry.
+
+// AreaLevel is a level of the administrative hierarchy.
+type AreaLevel string
+
+const (
+	AreaDepartment   AreaLevel = "department"
+	AreaPrefecture   AreaLevel = "prefecture"
+	AreaRegionalUnit AreaLevel = "regional_unit"
+	AreaMunicipality AreaLevel = "municipality"
+)
+
+// ParseGroupBy parses the level municipal values are grouped by. An empty string does not group them.
+func ParseGroupBy(s string) (AreaLevel, error) {
+	switch AreaLevel(s) {
+	case "", AreaMunicipality:
+		return AreaMunicipality, nil
+	case AreaRegionalUnit, AreaPrefecture, AreaDepartment:
+		return AreaLevel(s), nil
+	}
+	return AreaMunicipality, fmt.Errorf("unknown group_by %q, use one of regional_unit, prefecture or department", s)
+}
+
+// HierarchyNode is an area along with the areas of the next level in it.
+type HierarchyNode struct {
+	Level    AreaLevel       `json:"level"`
+	Id       int             `json:"id"`
+	Name     string          `json:"name"`
+	Slug     string          `json:"slug"`
+	Children []HierarchyNode `json:"children,omitempty"`
+}
+
+// AreaDeaths are the deaths of the municipalities of an area in a year, along with the number of municipalities
+// reporting them.
+type AreaDeaths struct {
+	Level          AreaLevel `json:"level"`
+	Id             int       `json:"id"`
+	Name           string    `json:"name"`
+	Slug           string    `json:"slug"`
+	Year           int       `json:"year"`
+	Deaths         int       `json:"deaths"`
+	Municipalities int       `json:"municipalities"`
+}
+
+// hierarchyRow is a regional unit with its prefecture, department and one of its municipalities, if any
+type hierarchyRow struct {
+	department, prefecture, regionalUnit HierarchyNode
+	municipality                         *HierarchyNode
+}
+
+// buildHierarchy builds the tree of departments from rows sorted by department, prefecture, regional unit and
+// municipality. A prefecture spanning more than one department appears under each of them.
+func buildHierarchy(rows []hierarchyRow) []HierarchyNode {
+	var res []HierarchyNode
+	for _, row := range rows {
+		if len(res) == 0 || res[len(res)-1].Id != row.department.Id {
+			res = append(res, row.department)
+		}
+		d := &res[len(res)-1]
+		if len(d.Children) == 0 || d.Children[len(d.Children)-1].Id != row.prefecture.Id {
+			d.Children = append(d.Children, row.prefecture)
+		}
+		p := &d.Children[len(d.Children)-1]
+		if len(p.Children) == 0 || p.Children[len(p.Children)-1].Id != row.regionalUnit.Id {
+			p.Children = append(p.Children, row.regionalUnit)
+		}
+		if row.municipality != nil {
+			ru := &p.Children[len(p.Children)-1]
+			ru.Children = append(ru.Children, *row.municipality)
+		}
+	}
+	return res
+}
+
+// SyncHierarchy links the regional units to their prefectures and departments, and the municipalities of the YPES
+// registry to their regional units. Municipalities of unknown regional units are left unlinked.
+func (r *PgRepo) SyncHierarchy(ctx context.Context) error {
+	rus, err := r.GetRegionalUnits(ctx)
+	if err != nil {
+		return err
+	}
+	var municipalities, regionalUnits []string
+	for _, m := range r.csvInfo {
+		if len(m.RegionalUnit) > 0 {
+			municipalities = append(municipalities, m.Slug)
+			regionalUnits = append(regionalUnits, slug.Make(m.RegionalUnit))
+		}
+	}
+
+	return r.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		for _, ru := range rus {
+			if _, err := tx.Exec(ctx, `INSERT INTO departments (name, slug) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING`,
+				ru.Department, slug.Make(ru.Department)); err != nil {
+				return fmt.Errorf("cannot add department: %s", err)
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO prefectures (name, slug) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING`,
+				ru.Prefecture, slug.Make(ru.Prefecture)); err != nil {
+				return fmt.Errorf("cannot add prefecture: %s", err)
+			}
+			sql := `UPDATE regional_units SET department_id=(SELECT id FROM departments WHERE name=$1),
+                    prefecture_id=(SELECT id FROM prefectures WHERE name=$2) WHERE id=$3`
+			if _, err := tx.Exec(ctx, sql, ru.Department, ru.Prefecture, ru.Id); err != nil {
+				return fmt.Errorf("cannot link regional unit to its prefecture: %s", err)
+			}
+		}
+
+		sql := `UPDATE municipalities m SET regional_unit_id=ru.id
+                FROM unnest($1::text[], $2::text[]) AS l (municipality, regional_unit)
+                JOIN regional_units ru ON ru.slug = l.regional_unit
+                WHERE m.slug = l.municipality AND m.regional_unit_id IS DISTINCT FROM ru.id`
+		tag, err := tx.Exec(ctx, sql, municipalities, regionalUnits)
+		if err != nil {
+			return fmt.Errorf("cannot link municipalities to their regional units: %s", err)
+		}
+		log.Printf("linked %d regional units and %d municipalities to the hierarchy", len(rus), tag.RowsAffected())
+		return nil
+	})
+}
+
+// GetHierarchy returns the departments with their prefectures, regional units and municipalities, by name.
+// Regional units that are not linked yet are left out.
+func (r *PgRepo) GetHierarchy(ctx context.Context) ([]HierarchyNode, error) {
+	sql := `SELECT d.id,d.name,d.slug,p.id,p.name,p.slug,ru.id,ru.regional_unit,ru.slug,m.id,m.name,m.slug
+            FROM regional_units ru
+            JOIN departments d ON d.id = ru.department_id
+            JOIN prefectures p ON p.id = ru.prefecture_id
+            LEFT JOIN municipalities m ON m.regional_unit_id = ru.id
+            ORDER BY d.name, p.name, ru.regional_unit, m.name`
+	rows, err := r.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get hierarchy: %s", err)
+	}
+	defer rows.Close()
+
+	var res []hierarchyRow
+	for rows.Next() {
+		row := hierarchyRow{
+			department:   HierarchyNode{Level: AreaDepartment},
+			prefecture:   HierarchyNode{Level: AreaPrefecture},
+			regionalUnit: HierarchyNode{Level: AreaRegionalUnit},
+		}
+		var munId *int
+		var munName, munSlug *string
+		if err := rows.Scan(&row.department.Id, &row.department.Name, &row.department.Slug, &row.prefecture.Id,
+			&row.prefecture.Name, &row.prefecture.Slug, &row.regionalUnit.Id, &row.regionalUnit.Name,
+			&row.regionalUnit.Slug, &munId, &munName, &munSlug); err != nil {
+			return nil, fmt.Errorf("cannot scan hierarchy row: %s", err)
+		}
+		if munId != nil {
+			row.municipality = &HierarchyNode{Level: AreaMunicipality, Id: *munId, Name: *munName, Slug: *munSlug}
+		}
+		res = append(res, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot get hierarchy: %s", err)
+	}
+	return buildHierarchy(res), nil
+}
+
+// GetDeathsPerArea returns the deaths of the municipalities grouped by the areas of a level and year, by year and
+// area. Municipalities that are not linked to a regional unit are left out.
+func (r *PgRepo) GetDeathsPerArea(ctx context.Context, filter DeathsFilter, level AreaLevel) ([]AreaDeaths, error) {
+	var area string
+	switch level {
+	case AreaRegionalUnit:
+		area = `ru.id, ru.regional_unit, ru.slug FROM deaths_per_municipality_cum y
+                JOIN municipalities m ON m.id = y.municipality_id
+                JOIN regional_units ru ON ru.id = m.regional_unit_id`
+	case AreaPrefecture:
+		area = `a.id, a.name, a.slug FROM deaths_per_municipality_cum y
+                JOIN municipalities m ON m.id = y.municipality_id
+                JOIN regional_units ru ON ru.id = m.regional_unit_id
+                JOIN prefectures a ON a.id = ru.prefecture_id`
+	case AreaDepartment:
+		area = `a.id, a.name, a.slug FROM deaths_per_municipality_cum y
+                JOIN municipalities m ON m.id = y.municipality_id
+                JOIN regional_units ru ON ru.id = m.regional_unit_id
+                JOIN departments a ON a.id = ru.department_id`
+	default:
+		return nil, fmt.Errorf("cannot group deaths by %s", level)
+	}
+	sql := `SELECT y.year, COALESCE(SUM(y.deaths_cum), 0), COUNT(*), ` + area + ` WHERE 1=1 `
+	counter := 1
+	var args []interface{}
+
+	if filter.MunId > 0 {
+		sql += fmt.Sprintf(` AND y.municipality_id=$%d `, counter)
+		counter++
+		args = append(args, filter.MunId)
+	}
+
+	if filter.Year > 0 {
+		sql += fmt.Sprintf(` AND y.year=$%d `, counter)
+		counter++
+		args = append(args, filter.Year)
+	}
+
+	sql += asOfSql(filter.AsOf, &counter, &args)
+	sql += ` GROUP BY 1, 4, 5, 6 ORDER BY 1, 5 `
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query deaths per %s: %s", level, err)
+	}
+	defer rows.Close()
+
+	var res []AreaDeaths
+	for rows.Next() {
+		d := AreaDeaths{Level: level}
+		if err := rows.Scan(&d.Year, &d.Deaths, &d.Municipalities, &d.Id, &d.Name, &d.Slug); err != nil {
+			return nil, fmt.Errorf("cannot scan deaths per %s: %s", level, err)
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
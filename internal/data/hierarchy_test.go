@@ -0,0 +1,50 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	for s, expected := range map[string]AreaLevel{
+		"":              AreaMunicipality,
+		"municipality":  AreaMunicipality,
+		"regional_unit": AreaRegionalUnit,
+		"prefecture":    AreaPrefecture,
+		"department":    AreaDepartment,
+	} {
+		level, err := ParseGroupBy(s)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, level)
+	}
+	_, err := ParseGroupBy("village")
+	assert.NotNil(t, err)
+}
+
+func TestBuildHierarchy(t *testing.T) {
+	node := func(level AreaLevel, id int) HierarchyNode { return HierarchyNode{Level: level, Id: id} }
+	mun := func(id int) *HierarchyNode { n := node(AreaMunicipality, id); return &n }
+	// prefecture 3 spans departments 1 and 2, and regional unit 6 has no municipalities yet
+	rows := []hierarchyRow{
+		{node(AreaDepartment, 1), node(AreaPrefecture, 3), node(AreaRegionalUnit, 5), mun(10)},
+		{node(AreaDepartment, 1), node(AreaPrefecture, 3), node(AreaRegionalUnit, 5), mun(11)},
+		{node(AreaDepartment, 1), node(AreaPrefecture, 4), node(AreaRegionalUnit, 6), nil},
+		{node(AreaDepartment, 2), node(AreaPrefecture, 3), node(AreaRegionalUnit, 7), mun(12)},
+	}
+
+	ru5 := node(AreaRegionalUnit, 5)
+	ru5.Children = []HierarchyNode{*mun(10), *mun(11)}
+	ru7 := node(AreaRegionalUnit, 7)
+	ru7.Children = []HierarchyNode{*mun(12)}
+	p3a, p3b, p4 := node(AreaPrefecture, 3), node(AreaPrefecture, 3), node(AreaPrefecture, 4)
+	p3a.Children = []HierarchyNode{ru5}
+	p4.Children = []HierarchyNode{node(AreaRegionalUnit, 6)}
+	p3b.Children = []HierarchyNode{ru7}
+	d1, d2 := node(AreaDepartment, 1), node(AreaDepartment, 2)
+	d1.Children = []HierarchyNode{p3a, p4}
+	d2.Children = []HierarchyNode{p3b}
+
+	assert.Equal(t, []HierarchyNode{d1, d2}, buildHierarchy(rows))
+	assert.Nil(t, buildHierarchy(nil))
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Values of the datasets are never overwritten. Every version of a row is kept along with the period the API knew
+// it, from valid_from until valid_to, and the ingestion run that recorded it. The current version of a row is the
+// one without valid_to. Reads return the current versions, or the versions known at the end of a past day.
+
+type ingestionRunKey struct{}
+
+// withIngestionRun marks the versions written with ctx as recorded by an ingestion run
+func withIngestionRun(ctx context.Context, runId int) context.Context {
+	return context.WithValue(ctx, ingestionRunKey{}, runId)
+}
+
+// ingestionRun returns the ingestion run writing with ctx, or nil if the write is not part of one
+func ingestionRun(ctx context.Context) *int {
+	if id, ok := ctx.Value(ingestionRunKey{}).(int); ok {
+		return &id
+	}
+	return nil
+}
+
+// asOfSql restricts a query to the versions known at the end of the day asOf, or to the current versions if asOf
+// is zero. counter is the number of the next query argument, and both counter and args are updated.
+func asOfSql(asOf time.Time, counter *int, args *[]interface{}) string {
+	if asOf.IsZero() {
+		return " AND valid_to IS NULL "
+	}
+	sql := fmt.Sprintf(" AND valid_from < $%[1]d AND (valid_to IS NULL OR valid_to >= $%[1]d) ", *counter)
+	*counter++
+	*args = append(*args, asOf.AddDate(0, 0, 1))
+	return sql
+}
+
+// writeVersion makes values the current version of the row of table with the given keys. The current version
+// is replaced only if its values differ. It reports whether the row had no current version before.
+func (r *PgRepo) writeVersion(
+	ctx context.Context,
+	table string,
+	keys []string,
+	keyArgs []interface{},
+	values []string,
+	valueArgs []interface{},
+) (bool, error) {
+	var where, params []string
+	for i, k := range keys {
+		where = append(where, fmt.Sprintf("%s=$%d", k, i+1))
+		params = append(params, fmt.Sprintf("$%d", i+1))
+	}
+	for i := range values {
+		params = append(params, fmt.Sprintf("$%d", len(keys)+i+1))
+	}
+	args := append(append([]interface{}{}, keyArgs...), valueArgs...)
+	at, run := len(args)+1, len(args)+2
+
+	closeSql := fmt.Sprintf(`UPDATE %s SET valid_to=$%d WHERE valid_to IS NULL AND %s AND (%s) IS DISTINCT FROM (%s)`,
+		table, at, strings.Join(where, " AND "), strings.Join(values, ","), strings.Join(params[len(keys):], ","))
+	insertSql := fmt.Sprintf(`INSERT INTO %s (%s,%s,valid_from,ingestion_run_id) VALUES (%s,$%d,$%d)
+	                          ON CONFLICT (%s) WHERE valid_to IS NULL DO NOTHING`,
+		table, strings.Join(keys, ","), strings.Join(values, ","), strings.Join(params, ","), at, run,
+		strings.Join(keys, ","))
+
+	var inserted bool
+	err := r.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		now := time.Now()
+		closed, err := tx.Exec(ctx, closeSql, append(args, now)...)
+		if err != nil {
+			return err
+		}
+		added, err := tx.Exec(ctx, insertSql, append(args, now, ingestionRun(ctx))...)
+		if err != nil {
+			return err
+		}
+		inserted = added.RowsAffected() == 1 && closed.RowsAffected() == 0
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("cannot write version of %s: %s", table, err)
+	}
+	return inserted, nil
+}
@@ -0,0 +1,30 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsOfSql(t *testing.T) {
+	counter := 2
+	args := []interface{}{"first"}
+	assert.Equal(t, " AND valid_to IS NULL ", asOfSql(time.Time{}, &counter, &args))
+	assert.Equal(t, 2, counter)
+	assert.Len(t, args, 1)
+
+	// a day is known until its end
+	sql := asOfSql(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), &counter, &args)
+	assert.Equal(t, " AND valid_from < $2 AND (valid_to IS NULL OR valid_to >= $2) ", sql)
+	assert.Equal(t, 3, counter)
+	assert.Equal(t, []interface{}{"first", time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC)}, args)
+}
+
+func TestIngestionRun(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, ingestionRun(ctx))
+	id := 7
+	assert.Equal(t, &id, ingestionRun(withIngestionRun(ctx, 7)))
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"errors"
+	"time"
+)
+
+// Statuses of ingestion runs and of their steps.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// What started an ingestion run.
+const (
+	TriggerSchedule = "schedule"
+	TriggerRefresh  = "refresh"
+)
+
+// ErrNotFound is returned by the repository when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// IngestionRun is a single execution of PopulateEverything.
+type IngestionRun struct {
+	Id         int             `json:"id"`
+	Trigger    string          `json:"trigger"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+	Status     string          `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Steps      []IngestionStep `json:"steps,omitempty"`
+}
+
+// IngestionStep is the population of a single dataset during an ingestion run.
+type IngestionStep struct {
+	Id         int       `json:"id"`
+	RunId      int       `json:"run_id"`
+	Dataset    string    `json:"dataset"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Status     string    `json:"status"`
+	StepStats
+	SourceUrl    string `json:"source_url"`
+	SourceSha256 string `json:"source_sha256"`
+	Error        string `json:"error,omitempty"`
+}
+
+// StepStats counts what happened to the rows of a dataset while populating it.
+type StepStats struct {
+	RowsRead     int `json:"rows_read"`
+	RowsInserted int `json:"rows_inserted"`
+	RowsUpdated  int `json:"rows_updated"`
+	RowsRejected int `json:"rows_rejected"`
+	// ValuesQuarantined counts the values that were withheld as suspicious, see Service.quarantine
+	ValuesQuarantined int `json:"values_quarantined"`
+	// ValuesRevised counts the published values that were changed, see Revision
+	ValuesRevised int `json:"values_revised"`
+}
+
+// merged counts the rows written by a merge
+func (st *StepStats) merged(res MergeResult) {
+	st.RowsInserted += res.Inserted
+	st.RowsUpdated += res.Updated
+	st.ValuesRevised += res.Revised
+}
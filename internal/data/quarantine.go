@@ -0,0 +1,231 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Statuses of quarantined values.
+const (
+	QuarantinePending  = "pending"
+	QuarantineApproved = "approved"
+	QuarantineRejected = "rejected"
+)
+
+// ErrAlreadyResolved is returned when approving or rejecting a quarantined value that is no longer pending.
+var ErrAlreadyResolved = errors.New("already resolved")
+
+// QuarantinedValue is a value of a dataset that was withheld during ingestion because it looked suspicious.
+// PublishedValue is the value that was published instead, if any.
+type QuarantinedValue struct {
+	Id             int        `json:"id"`
+	Dataset        string     `json:"dataset"`
+	Date           time.Time  `json:"date"`
+	Field          string     `json:"field"`
+	Value          float64    `json:"value"`
+	PublishedValue *float64   `json:"published_value"`
+	Reason         string     `json:"reason"`
+	Status         string     `json:"status"`
+	DetectedAt     time.Time  `json:"detected_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+}
+
+type QuarantineFilter struct {
+	Dataset string
+	Status  string
+}
+
+// quarantine withholds the suspicious values of a timeline sorted by date, replacing them with the published ones,
+// or with NULL if there are none, e.g. for a new date. Only approving a value publishes it. Values that were not
+// quarantined before are stored as pending. It returns the number of suspicious values.
+func (s *Service) quarantine(ctx context.Context, repo Repo, infos []FullInfo) (int, error) {
+	quarantined, err := repo.GetQuarantinedValues(ctx, QuarantineFilter{Dataset: DatasetTimeline})
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[quarantineKey]QuarantinedValue)
+	for _, q := range quarantined {
+		known[quarantineKey{q.Date.Format(simpleDateLayout), q.Field}] = q
+	}
+
+	anomalies := detectAnomalies(infos, s.anomalies, known)
+	if len(anomalies) == 0 {
+		return 0, nil
+	}
+
+	current, err := repo.GetFromTimeline(ctx, DatesFilter{})
+	if err != nil {
+		return 0, err
+	}
+	published := make(map[string]*FullInfo)
+	for i := range current {
+		published[current[i].Date.Format(simpleDateLayout)] = &current[i]
+	}
+	byDate := make(map[string]*FullInfo)
+	for i := range infos {
+		byDate[infos[i].Date.Format(simpleDateLayout)] = &infos[i]
+	}
+
+	series := checkedSeriesByField()
+	for _, a := range anomalies {
+		date := a.Date.Format(simpleDateLayout)
+		sr := series[a.Field]
+		var pub *float64
+		if p, ok := published[date]; ok {
+			pub = sr.get(p)
+		}
+		sr.set(byDate[date], pub)
+
+		if q, ok := known[quarantineKey{date, a.Field}]; ok && q.Value == a.Value {
+			continue
+		}
+		nq := &QuarantinedValue{
+			Dataset:        DatasetTimeline,
+			Date:           a.Date,
+			Field:          a.Field,
+			Value:          a.Value,
+			PublishedValue: pub,
+			Reason:         a.Reason,
+			Status:         QuarantinePending,
+			DetectedAt:     time.Now(),
+		}
+		if err := repo.QuarantineValue(ctx, nq); err != nil {
+			return 0, err
+		}
+		log.Printf("quarantined %s of %s, value %v: %s", a.Field, date, a.Value, a.Reason)
+	}
+
+	return len(anomalies), nil
+}
+
+// ResolveQuarantined approves or rejects a pending quarantined value. Approved values are published right away,
+// while rejected ones stay withheld for as long as the source keeps them. Rejecting a value with no published value
+// clears the field, in case the value was published before values like it were withheld.
+func (s *Service) ResolveQuarantined(ctx context.Context, id int, approve bool) (QuarantinedValue, error) {
+	var q QuarantinedValue
+	err := s.repo.WithTx(ctx, func(repo Repo) error {
+		var err error
+		if q, err = repo.GetQuarantinedValue(ctx, id); err != nil {
+			return err
+		}
+		if q.Status != QuarantinePending {
+			return ErrAlreadyResolved
+		}
+		q.Status = QuarantineRejected
+		if approve {
+			q.Status = QuarantineApproved
+			if err := repo.SetTimelineValue(ctx, q.Date, q.Field, &q.Value); err != nil {
+				return err
+			}
+		} else if q.PublishedValue == nil {
+			if err := repo.SetTimelineValue(ctx, q.Date, q.Field, nil); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		q.ResolvedAt = &now
+		return repo.ResolveQuarantinedValue(ctx, q.Id, q.Status, now)
+	})
+	return q, err
+}
+
+// QuarantineValue stores a quarantined value as pending, replacing any previous decision on the same value.
+func (r *PgRepo) QuarantineValue(ctx context.Context, q *QuarantinedValue) error {
+	sql := `INSERT INTO quarantined_values (dataset,date,field,value,published_value,reason,status,detected_at)
+            VALUES ($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT (dataset,date,field) DO UPDATE SET value=$4,
+            published_value=$5,reason=$6,status=$7,detected_at=$8,resolved_at=NULL RETURNING id`
+	err := r.conn.QueryRow(ctx, sql, q.Dataset, q.Date, q.Field, q.Value, q.PublishedValue, q.Reason, q.Status,
+		q.DetectedAt).Scan(&q.Id)
+	if err != nil {
+		return fmt.Errorf("cannot quarantine %s of %s: %s", q.Field, q.Date.Format(simpleDateLayout), err)
+	}
+	return nil
+}
+
+// GetQuarantinedValues returns the quarantined values, latest detected first.
+func (r *PgRepo) GetQuarantinedValues(ctx context.Context, filter QuarantineFilter) ([]QuarantinedValue, error) {
+	sql := `SELECT id,dataset,date,field,value,published_value,reason,status,detected_at,resolved_at
+            FROM quarantined_values WHERE 1=1 `
+	counter := 1
+	var args []interface{}
+	if len(filter.Dataset) > 0 {
+		sql += fmt.Sprintf(" AND dataset=$%d ", counter)
+		counter++
+		args = append(args, filter.Dataset)
+	}
+	if len(filter.Status) > 0 {
+		sql += fmt.Sprintf(" AND status=$%d ", counter)
+		counter++
+		args = append(args, filter.Status)
+	}
+	sql += " ORDER BY detected_at DESC, id DESC "
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get quarantined values: %s", err)
+	}
+	defer rows.Close()
+
+	var res []QuarantinedValue
+	for rows.Next() {
+		var q QuarantinedValue
+		if err := rows.Scan(&q.Id, &q.Dataset, &q.Date, &q.Field, &q.Value, &q.PublishedValue, &q.Reason, &q.Status,
+			&q.DetectedAt, &q.ResolvedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan quarantined value: %s", err)
+		}
+		res = append(res, q)
+	}
+	return res, rows.Err()
+}
+
+// GetQuarantinedValue returns a quarantined value, or ErrNotFound. Within WithTx the value is locked until the
+// transaction ends.
+func (r *PgRepo) GetQuarantinedValue(ctx context.Context, id int) (QuarantinedValue, error) {
+	sql := `SELECT id,dataset,date,field,value,published_value,reason,status,detected_at,resolved_at
+            FROM quarantined_values WHERE id=$1 FOR UPDATE`
+	var q QuarantinedValue
+	err := r.conn.QueryRow(ctx, sql, id).Scan(&q.Id, &q.Dataset, &q.Date, &q.Field, &q.Value, &q.PublishedValue,
+		&q.Reason, &q.Status, &q.DetectedAt, &q.ResolvedAt)
+	if err == pgx.ErrNoRows {
+		return q, ErrNotFound
+	}
+	if err != nil {
+		return q, fmt.Errorf("cannot get quarantined value %d: %s", id, err)
+	}
+	return q, nil
+}
+
+func (r *PgRepo) ResolveQuarantinedValue(ctx context.Context, id int, status string, at time.Time) error {
+	sql := `UPDATE quarantined_values SET status=$2,resolved_at=$3 WHERE id=$1`
+	if _, err := r.conn.Exec(ctx, sql, id, status, at); err != nil {
+		return fmt.Errorf("cannot resolve quarantined value %d: %s", id, err)
+	}
+	return nil
+}
+
+// SetTimelineValue publishes a single value of the timeline, or NULL if value is nil, as a new version of its date.
+func (r *PgRepo) SetTimelineValue(ctx context.Context, date time.Time, field string, value *float64) error {
+	series, ok := checkedSeriesByField()[field]
+	if !ok {
+		return fmt.Errorf("unknown timeline field %s", field)
+	}
+	current, err := r.GetFromTimeline(ctx, DatesFilter{StartDate: date, EndDate: date})
+	if err != nil {
+		return err
+	}
+	fi := FullInfo{Date: date}
+	if len(current) > 0 {
+		fi = current[0]
+	}
+	series.set(&fi, value)
+	if _, err := r.writeVersion(ctx, "greece_timeline", []string{"date"}, []interface{}{date}, timelineValueColumns,
+		timelineValues(fi)); err != nil {
+		return fmt.Errorf("cannot set %s of %s: %s", field, date.Format(simpleDateLayout), err)
+	}
+	return nil
+}
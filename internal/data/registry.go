@@ -0,0 +1,552 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"covid19-greece-api/pkg/file"
+	"covid19-greece-api/pkg/vartypes"
+)
+
+// Datasets that need no code of their own are declared in a registry file, in YAML or JSON:
+//
+//	datasets:
+//	- name: vaccinations_per_age
+//	  source: https://example.org/vaccinations_per_age.csv
+//	  table: vaccinations_per_age
+//	  layout: long
+//	  columns:
+//	  - {name: date, type: date, format: "2006-01-02"}
+//	  - {name: age_group, headers: [age, age_group]}
+//	  - {name: doses, type: int, optional: true}
+//	  key: [date, age_group]
+//
+// Every dataset is loaded into its own table, versioned like the rest of the datasets, and served at
+// /datasets/{name}. Tables are created when the dataset is first populated; fields cannot be changed afterwards
+// without a migration.
+
+// FieldType is the type of the values of a field.
+type FieldType string
+
+const (
+	FieldText    FieldType = "text"
+	FieldInt     FieldType = "int"
+	FieldFloat   FieldType = "float"
+	FieldPercent FieldType = "percent"
+	FieldDate    FieldType = "date"
+)
+
+// DatasetLayout is how the rows of a source hold the values of a dataset.
+type DatasetLayout string
+
+const (
+	// LayoutLong sources have a row per record and a column per field.
+	LayoutLong DatasetLayout = "long"
+	// LayoutWide sources have a column per date, like the cases of iMEdD, so every cell of a date column is a record.
+	LayoutWide DatasetLayout = "wide"
+)
+
+// FieldDefinition maps a column of the source to a field of the dataset.
+type FieldDefinition struct {
+	Name string `json:"name" yaml:"name"`
+	// Headers are the accepted headers of the column, matched case-insensitively. They default to the name.
+	Headers []string `json:"headers,omitempty" yaml:"headers"`
+	// Type defaults to text
+	Type FieldType `json:"type" yaml:"type"`
+	// Format is the layout of dates, in Go's notation. It defaults to 2006-01-02.
+	Format string `json:"format,omitempty" yaml:"format"`
+	// Optional fields may be empty, and are stored as NULL. Fields of the key cannot be optional.
+	Optional bool `json:"optional,omitempty" yaml:"optional"`
+}
+
+// SeriesDefinition declares the date columns of a wide source.
+type SeriesDefinition struct {
+	// Field is the name of the date field the date of every column is stored in
+	Field string `json:"field" yaml:"field"`
+	// Format is the layout of the date headers, in Go's notation
+	Format string `json:"format" yaml:"format"`
+	// Value is the field the cells of the date columns are stored in; its headers are ignored
+	Value FieldDefinition `json:"value" yaml:"value"`
+}
+
+// DatasetDefinition declares a dataset of the registry.
+type DatasetDefinition struct {
+	Name   string        `json:"name" yaml:"name"`
+	Source string        `json:"source" yaml:"source"`
+	Table  string        `json:"table" yaml:"table"`
+	Layout DatasetLayout `json:"layout" yaml:"layout"`
+	// Columns are the fields read from columns of their own
+	Columns []FieldDefinition `json:"columns" yaml:"columns"`
+	// Series is required by wide layouts
+	Series *SeriesDefinition `json:"series,omitempty" yaml:"series"`
+	// Key are the fields identifying a record
+	Key []string `json:"key" yaml:"key"`
+	// DateField is the field dates are filtered by. It defaults to the series field of wide layouts.
+	DateField string `json:"date_field,omitempty" yaml:"date_field"`
+
+	src file.Source
+}
+
+// Registry is the contents of a registry file.
+type Registry struct {
+	Datasets []DatasetDefinition `json:"datasets" yaml:"datasets"`
+}
+
+var identifierRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// reservedFields are the columns every dataset table has
+var reservedFields = map[string]bool{"id": true, "valid_from": true, "valid_to": true, "ingestion_run_id": true}
+
+// migratedTables are created by migrations besides the tables of bundleTables. Staging tables are told apart by their
+// prefix.
+var migratedTables = map[string]bool{"schema_migrations": true}
+
+// LoadRegistry reads and validates the datasets of a registry file. Files ending in .json are read as JSON, and
+// anything else as YAML.
+func LoadRegistry(path string) ([]DatasetDefinition, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read dataset registry: %s", err)
+	}
+	var reg Registry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, &reg)
+	} else {
+		err = yaml.Unmarshal(b, &reg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse dataset registry %s: %s", path, err)
+	}
+
+	names, tables := make(map[string]bool), make(map[string]bool)
+	for i := range reg.Datasets {
+		def := &reg.Datasets[i]
+		if err := def.init(); err != nil {
+			return nil, fmt.Errorf("invalid dataset %q of registry %s: %s", def.Name, path, err)
+		}
+		if names[def.Name] || tables[def.Table] {
+			return nil, fmt.Errorf("invalid dataset %q of registry %s: name or table is used twice", def.Name, path)
+		}
+		names[def.Name], tables[def.Table] = true, true
+	}
+	return reg.Datasets, nil
+}
+
+// init validates the definition, fills its defaults and parses its source
+func (d *DatasetDefinition) init() error {
+	if !identifierRegexp.MatchString(d.Name) {
+		return fmt.Errorf("name has to be lowercase letters, digits and underscores")
+	}
+	if _, ok := layouts[d.Name]; ok {
+		return fmt.Errorf("name is taken by a built-in dataset")
+	}
+	if !identifierRegexp.MatchString(d.Table) {
+		return fmt.Errorf("table has to be lowercase letters, digits and underscores")
+	}
+	if contains(bundleTables, d.Table) || migratedTables[d.Table] || strings.HasPrefix(d.Table, "staging_") {
+		return fmt.Errorf("table %s is a built-in table", d.Table)
+	}
+	switch d.Layout {
+	case "":
+		d.Layout = LayoutLong
+	case LayoutLong, LayoutWide:
+	default:
+		return fmt.Errorf("unknown layout %q, use long or wide", d.Layout)
+	}
+	if d.Layout == LayoutWide {
+		if d.Series == nil {
+			return fmt.Errorf("wide layouts need a series")
+		}
+		if len(d.Series.Format) == 0 {
+			return fmt.Errorf("the series has no format")
+		}
+		if len(d.Series.Value.Type) == 0 {
+			d.Series.Value.Type = FieldText
+		}
+		if len(d.DateField) == 0 {
+			d.DateField = d.Series.Field
+		}
+	} else if d.Series != nil {
+		return fmt.Errorf("only wide layouts have a series")
+	}
+
+	fields := make(map[string]FieldDefinition)
+	for i := range d.Columns {
+		c := &d.Columns[i]
+		if len(c.Headers) == 0 {
+			c.Headers = []string{c.Name}
+		}
+		if len(c.Type) == 0 {
+			c.Type = FieldText
+		}
+	}
+	for _, f := range d.fields() {
+		if !identifierRegexp.MatchString(f.Name) || reservedFields[f.Name] {
+			return fmt.Errorf("invalid field name %q", f.Name)
+		}
+		if _, dup := fields[f.Name]; dup {
+			return fmt.Errorf("field %s is declared twice", f.Name)
+		}
+		switch f.Type {
+		case FieldText, FieldInt, FieldFloat, FieldPercent, FieldDate:
+		default:
+			return fmt.Errorf("field %s has unknown type %q, use one of text, int, float, percent or date", f.Name, f.Type)
+		}
+		fields[f.Name] = f
+	}
+
+	if len(d.Key) == 0 {
+		return fmt.Errorf("key is missing")
+	}
+	for _, k := range d.Key {
+		f, ok := fields[k]
+		if !ok {
+			return fmt.Errorf("key field %s is not declared", k)
+		}
+		if f.Optional {
+			return fmt.Errorf("key field %s cannot be optional", k)
+		}
+	}
+	if len(d.values()) == 0 {
+		return fmt.Errorf("there are no fields besides the key")
+	}
+	if len(d.DateField) > 0 {
+		if f, ok := fields[d.DateField]; !ok || f.Type != FieldDate {
+			return fmt.Errorf("date field %s is not a declared date", d.DateField)
+		}
+	}
+
+	src, err := file.ParseSource(d.Source)
+	if err != nil {
+		return fmt.Errorf("invalid source: %s", err)
+	}
+	d.src = src
+	return nil
+}
+
+// fields returns all fields of the dataset: the columns, followed by the date and value of the series
+func (d DatasetDefinition) fields() []FieldDefinition {
+	fields := append([]FieldDefinition(nil), d.Columns...)
+	if d.Series != nil {
+		fields = append(fields, FieldDefinition{Name: d.Series.Field, Type: FieldDate}, d.Series.Value)
+	}
+	return fields
+}
+
+// values returns the names of the fields that are not part of the key, in the order of fields
+func (d DatasetDefinition) values() []string {
+	key := make(map[string]bool)
+	for _, k := range d.Key {
+		key[k] = true
+	}
+	var res []string
+	for _, f := range d.fields() {
+		if !key[f.Name] {
+			res = append(res, f.Name)
+		}
+	}
+	return res
+}
+
+// layout is the contract of the source of the dataset
+func (d DatasetDefinition) layout() csvLayout {
+	l := csvLayout{name: d.Name}
+	for _, c := range d.Columns {
+		l.columns = append(l.columns, column{name: c.Name, headers: c.Headers, required: true, rule: c.rule()})
+	}
+	if d.Series != nil {
+		format := d.Series.Format
+		l.series = func(header string) (time.Time, bool) {
+			t, err := time.Parse(format, strings.TrimSpace(header))
+			return t, err == nil
+		}
+		l.seriesRule = d.Series.Value.rule()
+	}
+	return l
+}
+
+func (f FieldDefinition) dateFormat() string {
+	if len(f.Format) == 0 {
+		return simpleDateLayout
+	}
+	return f.Format
+}
+
+// rule is the contract of the values of the field
+func (f FieldDefinition) rule() cellRule {
+	r := cellRule{optional: f.Optional}
+	switch f.Type {
+	case FieldInt:
+		r.kind = kindInt
+	case FieldFloat:
+		r.kind = kindFloat
+	case FieldPercent:
+		r.kind = kindPercent
+	case FieldDate:
+		r.kind, r.format = kindDate, f.dateFormat()
+	}
+	return r
+}
+
+// parse converts a value of the source to the type of the field. Empty values are nil.
+func (f FieldDefinition) parse(value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	switch f.Type {
+	case FieldInt:
+		n, err := vartypes.ParseNullableInt(value)
+		if err != nil {
+			return nil, err
+		}
+		return int64(*n), nil
+	case FieldFloat:
+		return strconv.ParseFloat(value, 64)
+	case FieldPercent:
+		return strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	case FieldDate:
+		return time.Parse(f.dateFormat(), value)
+	}
+	return value, nil
+}
+
+// sqlType is the column type of the field
+func (f FieldDefinition) sqlType() string {
+	switch f.Type {
+	case FieldInt:
+		return "BIGINT"
+	case FieldFloat, FieldPercent:
+		return "FLOAT"
+	case FieldDate:
+		return "DATE"
+	}
+	return "TEXT"
+}
+
+// RegisterDatasets adds datasets of a registry to the datasets the service populates.
+func (s *Service) RegisterDatasets(defs []DatasetDefinition) {
+	s.registry = append(s.registry, defs...)
+}
+
+// Dataset returns a dataset of the registry by its name.
+func (s *Service) Dataset(name string) (DatasetDefinition, bool) {
+	for _, d := range s.registry {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return DatasetDefinition{}, false
+}
+
+// Datasets returns the datasets of the registry, in the order they were registered.
+func (s *Service) Datasets() []DatasetDefinition {
+	return s.registry
+}
+
+// PopulateDataset populates a dataset of the registry.
+func (s *Service) PopulateDataset(ctx context.Context, name string) error {
+	def, ok := s.Dataset(name)
+	if !ok {
+		return fmt.Errorf("unknown dataset %s", name)
+	}
+	return s.populateInTx(ctx, s.populateDataset(def), def.Name)
+}
+
+// populateDataset returns the populateFunc of a dataset of the registry. A row of a long source is a record, while
+// every date column of a wide source makes a record out of the same row.
+func (s *Service) populateDataset(def DatasetDefinition) populateFunc {
+	return func(ctx context.Context, repo Repo, stats *StepStats) error {
+		if err := repo.EnsureDatasetTable(ctx, def); err != nil {
+			return err
+		}
+
+		rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, def.Name))
+		if err != nil {
+			return fmt.Errorf("error reading csv file: %s", err)
+		}
+		defer rows.Close()
+
+		headers, err := readHeaders(rows)
+		if err != nil {
+			return err
+		}
+		cols, err := def.layout().mapColumns(headers)
+		if err != nil {
+			return err
+		}
+
+		var batch [][]interface{}
+		for rows.Next() {
+			row := rows.Row()
+			stats.RowsRead++
+			var values []interface{}
+			for _, c := range def.Columns {
+				v, err := c.parse(cols.value(row, c.Name))
+				if err != nil {
+					return fmt.Errorf("bad %s at line %d: %s", c.Name, rows.Line(), err)
+				}
+				values = append(values, v)
+			}
+			if def.Series == nil {
+				batch = append(batch, values)
+			}
+			for _, dc := range cols.dates {
+				v, err := def.Series.Value.parse(row[dc.index])
+				if err != nil {
+					return fmt.Errorf("bad %s at line %d, column %s: %s", def.Series.Value.Name, rows.Line(),
+						dc.header, err)
+				}
+				batch = append(batch, append(append([]interface{}(nil), values...), dc.date, v))
+			}
+			if len(batch) >= StageBatchSize {
+				if err := repo.StageDatasetRows(ctx, def, batch); err != nil {
+					return fmt.Errorf("error adding %s: %s", def.Name, err)
+				}
+				batch = batch[:0]
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error reading csv file: %s", err)
+		}
+		if err := repo.StageDatasetRows(ctx, def, batch); err != nil {
+			return fmt.Errorf("error adding %s: %s", def.Name, err)
+		}
+		res, err := repo.MergeDatasetRows(ctx, def)
+		if err != nil {
+			return fmt.Errorf("error adding %s: %s", def.Name, err)
+		}
+		stats.merged(res)
+
+		log.Printf("added %s of %d rows", def.Name, stats.RowsRead)
+
+		return nil
+	}
+}
+
+// EnsureDatasetTable creates the table of a dataset of the registry and its staging table, unless they exist.
+// It fails if an existing table misses fields of the dataset.
+func (r *PgRepo) EnsureDatasetTable(ctx context.Context, def DatasetDefinition) error {
+	var columns, staged []string
+	for _, f := range def.fields() {
+		c := f.Name + " " + f.sqlType()
+		staged = append(staged, c)
+		if !f.Optional {
+			c += " NOT NULL"
+		}
+		columns = append(columns, c)
+	}
+	for _, sql := range []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (%s, valid_from TIMESTAMP NOT NULL, valid_to TIMESTAMP,
+		             ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL)`,
+			def.Table, strings.Join(columns, ", ")),
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS idx_%[1]s_current ON %[1]s (%[2]s) WHERE valid_to IS NULL`,
+			def.Table, strings.Join(def.Key, ", ")),
+		fmt.Sprintf(`CREATE UNLOGGED TABLE IF NOT EXISTS staging_%s (id BIGSERIAL, %s)`,
+			def.Table, strings.Join(staged, ", ")),
+	} {
+		if _, err := r.conn.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("cannot create table of dataset %s: %s", def.Name, err)
+		}
+	}
+
+	rows, err := r.conn.Query(ctx, `SELECT column_name FROM information_schema.columns
+                                    WHERE table_schema = current_schema() AND table_name = $1`, def.Table)
+	if err != nil {
+		return fmt.Errorf("cannot get columns of table %s: %s", def.Table, err)
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("cannot scan column of table %s: %s", def.Table, err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("cannot get columns of table %s: %s", def.Table, err)
+	}
+	for _, f := range def.fields() {
+		if !existing[f.Name] {
+			return fmt.Errorf("table %s has no column %s, fields of a dataset cannot change without a migration",
+				def.Table, f.Name)
+		}
+	}
+	return nil
+}
+
+// StageDatasetRows copies records of a dataset of the registry, with the values of its fields in order, into its
+// staging table.
+func (r *PgRepo) StageDatasetRows(ctx context.Context, def DatasetDefinition, records [][]interface{}) error {
+	var columns []string
+	for _, f := range def.fields() {
+		columns = append(columns, f.Name)
+	}
+	return r.stage(ctx, "staging_"+def.Table, columns, len(records), func(i int) []interface{} {
+		return records[i]
+	})
+}
+
+func (r *PgRepo) MergeDatasetRows(ctx context.Context, def DatasetDefinition) (MergeResult, error) {
+	staging := "staging_" + def.Table
+	return r.merge(ctx, staging, mergeSql(def.Name, def.Table, def.Key, def.values(),
+		stagedSql(staging, def.Key, def.values())))
+}
+
+// GetDatasetRows returns the records of a dataset of the registry by their key, as maps of field names to values.
+// Dates filter the date field of the dataset, if it has one.
+func (r *PgRepo) GetDatasetRows(ctx context.Context, def DatasetDefinition, filter DatesFilter) ([]map[string]interface{}, error) {
+	var columns []string
+	for _, f := range def.fields() {
+		columns = append(columns, f.Name)
+	}
+	sql := fmt.Sprintf(`SELECT %s FROM %s WHERE 1=1 `, strings.Join(columns, ","), def.Table)
+	counter := 1
+	var args []interface{}
+
+	if len(def.DateField) > 0 && !filter.StartDate.IsZero() {
+		sql += fmt.Sprintf(" AND %s >= $%d ", def.DateField, counter)
+		counter++
+		args = append(args, filter.StartDate)
+	}
+
+	if len(def.DateField) > 0 && !filter.EndDate.IsZero() {
+		sql += fmt.Sprintf(" AND %s <= $%d ", def.DateField, counter)
+		counter++
+		args = append(args, filter.EndDate)
+	}
+
+	sql += asOfSql(filter.AsOf, &counter, &args)
+	sql += " ORDER BY " + strings.Join(def.Key, ",")
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get %s: %s", def.Name, err)
+	}
+	defer rows.Close()
+
+	var res []map[string]interface{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan %s: %s", def.Name, err)
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, c := range columns {
+			record[c] = values[i]
+		}
+		res = append(res, record)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRegistry(t *testing.T) {
+	defs, err := LoadRegistry("test_csv/testing_registry.yaml")
+	assert.Nil(t, err)
+	assert.Len(t, defs, 2)
+
+	wide := defs[0]
+	assert.Equal(t, LayoutWide, wide.Layout)
+	assert.Equal(t, "date", wide.DateField)
+	assert.Equal(t, []string{"population", "cases"}, wide.values())
+
+	long := defs[1]
+	assert.Equal(t, LayoutLong, long.Layout)
+	assert.Equal(t, FieldDefinition{Name: "area", Headers: []string{"area"}, Type: FieldText}, long.Columns[0])
+	assert.Empty(t, long.DateField)
+	assert.Equal(t, []string{"doses", "second_doses"}, long.values())
+}
+
+func TestLoadRegistryReadsJson(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"datasets": [{"name": "doses", "source": "doses.csv", "table": "doses",
+		"columns": [{"name": "date", "type": "date"}, {"name": "doses", "type": "int"}], "key": ["date"],
+		"date_field": "date"}]}`), 0o600))
+
+	defs, err := LoadRegistry(path)
+	assert.Nil(t, err)
+	assert.Len(t, defs, 1)
+	assert.Equal(t, "file://doses.csv", defs[0].src.String())
+}
+
+func TestLoadRegistryRejectsInvalidDatasets(t *testing.T) {
+	for def, msg := range map[string]string{
+		`{name: cases, source: a.csv, table: t, columns: [{name: a}, {name: b}], key: [a]}`:                 "taken by a built-in dataset",
+		`{name: d, source: a.csv, table: "t; DROP TABLE x", columns: [{name: a}, {name: b}], key: [a]}`:     "table has to be",
+		`{name: d, source: a.csv, table: greece_timeline, columns: [{name: a}, {name: b}], key: [a]}`:       "is a built-in table",
+		`{name: d, source: a.csv, table: revisions, columns: [{name: a}, {name: b}], key: [a]}`:             "is a built-in table",
+		`{name: d, source: a.csv, table: schema_migrations, columns: [{name: a}, {name: b}], key: [a]}`:     "is a built-in table",
+		`{name: d, source: a.csv, table: staging_t, columns: [{name: a}, {name: b}], key: [a]}`:             "is a built-in table",
+		`{name: d, source: a.csv, table: t, columns: [{name: a}, {name: b, type: money}], key: [a]}`:        `unknown type "money"`,
+		`{name: d, source: a.csv, table: t, columns: [{name: a, optional: true}, {name: b}], key: [a]}`:     "cannot be optional",
+		`{name: d, source: a.csv, table: t, columns: [{name: a}, {name: b}], key: [c]}`:                     "key field c is not declared",
+		`{name: d, source: a.csv, table: t, columns: [{name: a}], key: [a]}`:                                "no fields besides the key",
+		`{name: d, source: a.csv, table: t, layout: wide, columns: [{name: a}, {name: b}], key: [a]}`:       "need a series",
+		`{name: d, source: a.csv, table: t, columns: [{name: a}, {name: valid_to}], key: [a]}`:              "invalid field name",
+		`{name: d, source: a.csv, table: t, columns: [{name: a}, {name: b}], key: [a], date_field: b}`:      "not a declared date",
+		`{name: d, source: "ftp://a.csv", table: t, columns: [{name: a}, {name: b}], key: [a]}`:             "invalid source",
+		`{name: d, source: a.csv, table: t, columns: [{name: a}, {name: b}, {name: a}], key: [a]}`:          "declared twice",
+		`{name: d, source: a.csv, table: t, layout: sideways, columns: [{name: a}, {name: b}], key: [a]}`:   "unknown layout",
+		`{name: d, source: a.csv, table: t, columns: [{name: a}, {name: b}], key: [a], series: {field: c}}`: "only wide layouts",
+	} {
+		path := filepath.Join(t.TempDir(), "registry.yaml")
+		assert.Nil(t, os.WriteFile(path, []byte("datasets:\n- "+def+"\n"), 0o600))
+		_, err := LoadRegistry(path)
+		if assert.NotNil(t, err, def) {
+			assert.Contains(t, err.Error(), msg, def)
+		}
+	}
+}
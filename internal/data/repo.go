@@ -19,19 +19,73 @@ import (
 
 // Repository for storing all COVID data.
 
+// Methods adding data report whether a new row was inserted; false means that an existing row got a new version,
+// or that its values did not change. Previous versions are kept, see history.go.
 type Repo interface {
-	AddCase(ctx context.Context, date time.Time, amount int, sluggedRegionalUnit string) error
-	AddFullInfo(ctx context.Context, fi *FullInfo) error
-	AddRegionalUnit(ctx context.Context, rgu RegionalUnit) error
+	// WithTx runs fn as a single unit of work. The Repo passed to fn writes in a transaction which is committed
+	// only if fn returns no error, and rolled back otherwise.
+	WithTx(ctx context.Context, fn func(repo Repo) error) error
+	// WithSnapshot runs fn on a read-only Repo, which reads the database as it was when fn started, whatever is
+	// written meanwhile.
+	WithSnapshot(ctx context.Context, fn func(repo Repo) error) error
+	AddRegionalUnit(ctx context.Context, rgu RegionalUnit) (bool, error)
 	GetRegionalUnits(ctx context.Context) ([]RegionalUnit, error)
 	GetCases(ctx context.Context, filter CasesFilter) ([]Case, error)
 	GetFromTimeline(ctx context.Context, filter DatesFilter) ([]FullInfo, error)
-	AddYearlyDeath(ctx context.Context, munId, deaths, year int) error
 	AddMunicipality(ctx context.Context, name string) (int, error)
 	GetMunicipalities(ctx context.Context) ([]Municipality, error)
 	GetDeathsPerMunicipality(ctx context.Context, filter DeathsFilter) ([]YearlyDeaths, error)
 	GetDemographicInfo(ctx context.Context, filter DemographicFilter) ([]DemographicInfo, error)
-	AddDemographicInfo(ctx context.Context, info DemographicInfo) error
+	// Stage* methods copy rows into the staging table of a dataset, and Merge* methods move all staged rows into
+	// the dataset in a single statement. Both have to be called within the same WithTx.
+	StageCases(ctx context.Context, cases []CaseRecord) error
+	MergeCases(ctx context.Context) (MergeResult, error)
+	GetCadencePeriods(ctx context.Context, dataset string) ([]CadencePeriod, error)
+	SyncHierarchy(ctx context.Context) error
+	GetHierarchy(ctx context.Context) ([]HierarchyNode, error)
+	GetDeathsPerArea(ctx context.Context, filter DeathsFilter, level AreaLevel) ([]AreaDeaths, error)
+	StageTimeline(ctx context.Context, infos []FullInfo) error
+	MergeTimeline(ctx context.Context) (MergeResult, error)
+	StageYearlyDeaths(ctx context.Context, deaths []YearlyDeaths) error
+	MergeYearlyDeaths(ctx context.Context) (MergeResult, error)
+	StageDemographicInfo(ctx context.Context, infos []DemographicInfo) error
+	MergeDemographicInfo(ctx context.Context) (MergeResult, error)
+	GetSourceState(ctx context.Context, name string) (SourceState, error)
+	SaveSourceState(ctx context.Context, state SourceState) error
+	CreateIngestionRun(ctx context.Context, run *IngestionRun) error
+	FinishIngestionRun(ctx context.Context, run *IngestionRun) error
+	AddIngestionStep(ctx context.Context, step *IngestionStep) error
+	GetIngestionRuns(ctx context.Context) ([]IngestionRun, error)
+	GetIngestionRun(ctx context.Context, id int) (IngestionRun, error)
+	// WithIngestionLock runs fn holding the lock of ingestion runs, which is shared by all replicas. Unless it waits
+	// for the lock, fn is not run, and false is returned, if the lock is held elsewhere.
+	WithIngestionLock(ctx context.Context, wait bool, fn func() error) (bool, error)
+	QuarantineValue(ctx context.Context, q *QuarantinedValue) error
+	GetQuarantinedValues(ctx context.Context, filter QuarantineFilter) ([]QuarantinedValue, error)
+	GetQuarantinedValue(ctx context.Context, id int) (QuarantinedValue, error)
+	ResolveQuarantinedValue(ctx context.Context, id int, status string, at time.Time) error
+	SetTimelineValue(ctx context.Context, date time.Time, field string, value *float64) error
+	GetRevisions(ctx context.Context, filter RevisionFilter) ([]Revision, error)
+	AddWasteSite(ctx context.Context, site WasteSite) (bool, error)
+	GetWasteSites(ctx context.Context) ([]WasteSite, error)
+	StageWaste(ctx context.Context, measurements []WasteMeasurement) error
+	MergeWaste(ctx context.Context) (MergeResult, error)
+	GetWaste(ctx context.Context, filter WasteFilter) ([]WasteMeasurement, error)
+	StageVaccinations(ctx context.Context, records []VaccinationRecord) error
+	MergeVaccinations(ctx context.Context) (MergeResult, error)
+	GetVaccinations(ctx context.Context, filter VaccinationsFilter) ([]Vaccination, error)
+	EnsureDatasetTable(ctx context.Context, def DatasetDefinition) error
+	StageDatasetRows(ctx context.Context, def DatasetDefinition, records [][]interface{}) error
+	MergeDatasetRows(ctx context.Context, def DatasetDefinition) (MergeResult, error)
+	GetDatasetRows(ctx context.Context, def DatasetDefinition, filter DatesFilter) ([]map[string]interface{}, error)
+	// Table methods read and write whole tables for bundles, see bundle.go. Values are in the text format of
+	// Postgres, and nil for NULL.
+	GetTableColumns(ctx context.Context, table string) ([]string, error)
+	ExportTableRows(ctx context.Context, table string, columns []string, fn func(values []*string) error) error
+	CountTableRows(ctx context.Context, table string) (int, error)
+	DeleteTableRows(ctx context.Context, table string) error
+	// ImportTableRows copies the rows next returns one by one into a table, until it returns nil.
+	ImportTableRows(ctx context.Context, table string, columns []string, next func() ([]*string, error)) error
 }
 
 type YpesMunicipality struct {
@@ -40,11 +94,20 @@ type YpesMunicipality struct {
 	Code         string
 	Population11 int
 	Population21 int
+	// RegionalUnit is the normalized name of the regional unit of the municipality, if known
+	RegionalUnit string
 }
 
 type DatesFilter struct {
 	StartDate time.Time
 	EndDate   time.Time
+	// AsOf returns the values as they were known at the end of that day, instead of the current ones
+	AsOf time.Time
+}
+
+// Contains reports whether t is within the dates of the filter. Missing dates leave the period open.
+func (f DatesFilter) Contains(t time.Time) bool {
+	return (f.StartDate.IsZero() || !t.Before(f.StartDate)) && (f.EndDate.IsZero() || !t.After(f.EndDate))
 }
 
 type CasesFilter struct {
@@ -53,7 +116,9 @@ type CasesFilter struct {
 }
 
 type PgRepo struct {
-	conn    *pgxpool.Pool
+	conn querier
+	// pool is the pool conn comes from, unless conn is a transaction
+	pool    *pgxpool.Pool
 	csvInfo map[string]YpesMunicipality
 }
 
@@ -67,7 +132,7 @@ func NewPgRepo(conn *pgxpool.Pool, municipalitiesYpesCsvFile string) (*PgRepo, e
 		municipalitiesYpesCsvFile = filepath.Join(path.Dir(filename), "municipalities_ypes.csv")
 	}
 
-	data, err := file.ReadCsv(municipalitiesYpesCsvFile, true)
+	data, err := file.ReadCsvFile(municipalitiesYpesCsvFile)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read municipalities_ypes.csv: %s", err)
 	}
@@ -85,63 +150,54 @@ func NewPgRepo(conn *pgxpool.Pool, municipalitiesYpesCsvFile string) (*PgRepo, e
 			return nil, fmt.Errorf("municipalities_ypes.csv error at line %d: cannot convert %s to int: %s",
 				i, data[i][5], err)
 		}
-		ypesInfo[slugged] = YpesMunicipality{
+		m := YpesMunicipality{
 			Name:         name,
 			Slug:         slugged,
 			Code:         code,
 			Population11: population11,
 			Population21: population21,
 		}
+		// older files do not have the regional unit column
+		if len(data[i]) > 6 {
+			m.RegionalUnit = data[i][6]
+		}
+		ypesInfo[slugged] = m
 	}
 	log.Printf("municipality info from YPES loaded successfully")
 	return &PgRepo{
 		conn:    conn,
+		pool:    conn,
 		csvInfo: ypesInfo,
 	}, nil
 }
 
-func (r *PgRepo) AddCase(ctx context.Context, date time.Time, amount int, slugged string) error {
-	sql := `INSERT INTO cases_per_regional_unit (regional_unit_id, date, cases) 
-            VALUES ((SELECT id FROM regional_units WHERE slug=$1), $2, $3) ON CONFLICT (regional_unit_id, date) DO UPDATE SET cases=$3`
-	_, err := r.conn.Exec(ctx, sql, slugged, date, amount)
-	if err != nil {
-		return fmt.Errorf("could not insert row: %v", err)
-	}
-
-	return nil
+func (r *PgRepo) WithTx(ctx context.Context, fn func(repo Repo) error) error {
+	// on a repository that is already transactional, this creates a savepoint
+	return r.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		return fn(&PgRepo{conn: tx, csvInfo: r.csvInfo})
+	})
 }
 
-func (r *PgRepo) AddFullInfo(ctx context.Context, fi *FullInfo) error {
-	sql := `INSERT INTO greece_timeline (date,cases,total_reinfections,deaths,deaths_cum,recovered,beds_occupancy,
-			 icu_occupancy,intubated,intubated_vac,intubated_unvac,hospital_admissions,hospital_discharges,
-			 estimated_new_rtpcr_tests,estimated_new_rapid_tests,estimated_new_total_tests,cases_cum,waste_highest_place,
-             waste_highest_percentage,waste_highest_place_en) 
-           VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20) ON CONFLICT (date) DO UPDATE SET 
-           cases=$2,total_reinfections=$3,deaths=$4,deaths_cum=$5,recovered=$6,beds_occupancy=$7,icu_occupancy=$8,
-           intubated=$9,intubated_vac=$10,intubated_unvac=$11,hospital_admissions=$12,hospital_discharges=$13,
-           estimated_new_rtpcr_tests=$14,estimated_new_rapid_tests=$15,estimated_new_total_tests=$16,cases_cum=$17,
-           waste_highest_place=$18,waste_highest_percentage=$19,waste_highest_place_en=$20`
-	_, err := r.conn.Exec(ctx, sql, fi.Date, fi.Cases, fi.TotalReinfections, fi.Deaths, fi.DeathsCum, fi.Recovered,
-		fi.BedsOccupancy, fi.IcuOccupancy, fi.Intubated, fi.IntubatedVac, fi.IntubatedUnvac, fi.HospitalAdmissions,
-		fi.HospitalDischarges, fi.EstimatedNewRtpcrTests, fi.EstimatedNewRapidTests, fi.EstimatedNewTotalTests,
-		fi.CasesCum, fi.WasteHighestPlace, fi.WasteHighestPercent, fi.WasteHighestPlaceEn)
-	if err != nil {
-		return fmt.Errorf("error inserting into greece_timeline table: %s", err)
-	}
-
-	return nil
+func (r *PgRepo) WithSnapshot(ctx context.Context, fn func(repo Repo) error) error {
+	return r.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// this has to be the first statement of the transaction, so snapshots cannot be taken within one
+		if _, err := tx.Exec(ctx, `SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY`); err != nil {
+			return fmt.Errorf("cannot take a snapshot of the database: %s", err)
+		}
+		return fn(&PgRepo{conn: tx, csvInfo: r.csvInfo})
+	})
 }
 
-func (r *PgRepo) AddRegionalUnit(ctx context.Context, ru RegionalUnit) error {
+func (r *PgRepo) AddRegionalUnit(ctx context.Context, ru RegionalUnit) (bool, error) {
 	sql := `INSERT INTO regional_units (slug, department, prefecture, regional_unit_normalized, regional_unit, pop_11) 
             VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (regional_unit_normalized) DO NOTHING`
-	_, err := r.conn.Exec(ctx, sql, ru.Slug, ru.Department, ru.Prefecture,
+	tag, err := r.conn.Exec(ctx, sql, ru.Slug, ru.Department, ru.Prefecture,
 		ru.RegionalUnitNormalized, ru.RegionalUnit, ru.Pop11)
 	if err != nil {
-		return fmt.Errorf("could not insert regional_units row: %v", err)
+		return false, fmt.Errorf("could not insert regional_units row: %v", err)
 	}
 
-	return nil
+	return tag.RowsAffected() == 1, nil
 }
 
 func (r *PgRepo) GetRegionalUnits(ctx context.Context) ([]RegionalUnit, error) {
@@ -165,7 +221,7 @@ func (r *PgRepo) GetRegionalUnits(ctx context.Context) ([]RegionalUnit, error) {
 }
 
 func (r *PgRepo) GetMunicipalities(ctx context.Context) ([]Municipality, error) {
-	sql := `SELECT id,name,slug,code,pop_11,pop_21 FROM municipalities`
+	sql := `SELECT id,name,slug,code,pop_11,pop_21,regional_unit_id FROM municipalities`
 	rows, err := r.conn.Query(ctx, sql)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get from municipalities table: %s", err)
@@ -173,7 +229,8 @@ func (r *PgRepo) GetMunicipalities(ctx context.Context) ([]Municipality, error)
 	var res []Municipality
 	for rows.Next() {
 		var m Municipality
-		if err := rows.Scan(&m.Id, &m.Name, &m.Slug, &m.Code, &m.Population11, &m.Population21); err != nil {
+		if err := rows.Scan(&m.Id, &m.Name, &m.Slug, &m.Code, &m.Population11, &m.Population21,
+			&m.RegionalUnitId); err != nil {
 			return nil, fmt.Errorf("could not scan municipalities row: %s", err)
 		}
 		res = append(res, m)
@@ -181,14 +238,19 @@ func (r *PgRepo) GetMunicipalities(ctx context.Context) ([]Municipality, error)
 	return res, nil
 }
 
+// Case holds the cases of a regional unit reported at a date, covering the period from PeriodStart to PeriodEnd.
+// Cases that were not reported are nil.
 type Case struct {
 	RegionalUnitId int       `json:"regional_unit_id"`
 	Date           time.Time `json:"date"`
-	Cases          int       `json:"cases"`
+	Cases          *int      `json:"cases"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	Cadence        Cadence   `json:"cadence"`
 }
 
 func (r *PgRepo) GetCases(ctx context.Context, filter CasesFilter) ([]Case, error) {
-	sql := `SELECT regional_unit_id,date,cases FROM cases_per_regional_unit WHERE 1=1 `
+	sql := `SELECT regional_unit_id,date,cases,period_start,period_end,cadence FROM cases_per_regional_unit WHERE 1=1 `
 	counter := 1
 	var args []interface{}
 
@@ -210,6 +272,7 @@ func (r *PgRepo) GetCases(ctx context.Context, filter CasesFilter) ([]Case, erro
 		args = append(args, filter.EndDate)
 	}
 
+	sql += asOfSql(filter.AsOf, &counter, &args)
 	sql += " ORDER BY date ASC "
 
 	rows, err := r.conn.Query(ctx, sql, args...)
@@ -220,7 +283,7 @@ func (r *PgRepo) GetCases(ctx context.Context, filter CasesFilter) ([]Case, erro
 	var res []Case
 	for rows.Next() {
 		var c Case
-		if err := rows.Scan(&c.RegionalUnitId, &c.Date, &c.Cases); err != nil {
+		if err := rows.Scan(&c.RegionalUnitId, &c.Date, &c.Cases, &c.PeriodStart, &c.PeriodEnd, &c.Cadence); err != nil {
 			return nil, fmt.Errorf("could not scan cases row: %s", err)
 		}
 		res = append(res, c)
@@ -248,6 +311,7 @@ func (r *PgRepo) GetFromTimeline(ctx context.Context, filter DatesFilter) ([]Ful
 		args = append(args, filter.EndDate)
 	}
 
+	sql += asOfSql(filter.AsOf, &counter, &args)
 	sql += " ORDER BY date ASC "
 
 	rows, err := r.conn.Query(ctx, sql, args...)
@@ -271,16 +335,6 @@ func (r *PgRepo) GetFromTimeline(ctx context.Context, filter DatesFilter) ([]Ful
 	return fullInfos, nil
 }
 
-func (r *PgRepo) AddYearlyDeath(ctx context.Context, munId, deaths, year int) error {
-	sql := `INSERT INTO deaths_per_municipality_cum (year, municipality_id, deaths_cum) VALUES($1,$2,$3)
-			ON CONFLICT (year, municipality_id) DO UPDATE SET deaths_cum=$3`
-	if _, err := r.conn.Exec(ctx, sql, year, munId, deaths); err != nil {
-		return fmt.Errorf("could not add to deaths_per_municipality_cum: %s", err)
-	}
-
-	return nil
-}
-
 func (r *PgRepo) AddMunicipality(ctx context.Context, name string) (int, error) {
 	slugged := slug.Make(name)
 	sql := `SELECT id from municipalities WHERE slug=$1`
@@ -313,6 +367,8 @@ func (r *PgRepo) AddMunicipality(ctx context.Context, name string) (int, error)
 type DeathsFilter struct {
 	MunId int
 	Year  int
+	// AsOf returns the values as they were known at the end of that day, instead of the current ones
+	AsOf time.Time
 }
 
 func (r *PgRepo) GetDeathsPerMunicipality(ctx context.Context, filter DeathsFilter) ([]YearlyDeaths, error) {
@@ -332,6 +388,8 @@ func (r *PgRepo) GetDeathsPerMunicipality(ctx context.Context, filter DeathsFilt
 		args = append(args, filter.Year)
 	}
 
+	sql += asOfSql(filter.AsOf, &counter, &args)
+
 	rows, err := r.conn.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot query deaths_per_municipality_cum: %s", err)
@@ -349,19 +407,6 @@ func (r *PgRepo) GetDeathsPerMunicipality(ctx context.Context, filter DeathsFilt
 	return res, nil
 }
 
-func (r *PgRepo) AddDemographicInfo(ctx context.Context, info DemographicInfo) error {
-	sql := `INSERT INTO demography_per_age (date,category,cases,deaths,intensive,discharged,hospitalized,
-            hospitalized_in_icu,passed_away,recovered,treated_at_home) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) 
-            ON CONFLICT (date,category) DO UPDATE SET cases=$3,deaths=$4,intensive=$5,discharged=$6,hospitalized=$7, 
-            hospitalized_in_icu=$8,passed_away=$9,recovered=$10,treated_at_home=$11`
-	_, err := r.conn.Exec(ctx, sql, info.Date, info.Category, info.Cases, info.Deaths, info.Intensive, info.Discharged,
-		info.Hospitalized, info.HospitalizedInIcu, info.PassedAway, info.Recovered, info.TreatedAtHome)
-	if err != nil {
-		return fmt.Errorf("cannot add demographic info: %s", err)
-	}
-	return nil
-}
-
 type DemographicFilter struct {
 	DatesFilter
 	Category string
@@ -390,6 +435,7 @@ func (r *PgRepo) GetDemographicInfo(ctx context.Context, filter DemographicFilte
 		args = append(args, filter.Category)
 	}
 
+	sql += asOfSql(filter.AsOf, &counter, &args)
 	sql += " ORDER BY date ASC "
 
 	rows, err := r.conn.Query(ctx, sql, args...)
@@ -408,3 +454,145 @@ func (r *PgRepo) GetDemographicInfo(ctx context.Context, filter DemographicFilte
 	}
 	return res, nil
 }
+
+// SourceState holds what we know about the last version of a data source that was loaded.
+type SourceState struct {
+	Name        string
+	Fingerprint file.Fingerprint
+	LoadedAt    time.Time
+	SkippedAt   time.Time
+}
+
+// GetSourceState returns the state of a source, or an empty state if it was never loaded.
+func (r *PgRepo) GetSourceState(ctx context.Context, name string) (SourceState, error) {
+	sql := `SELECT etag,last_modified,sha256,loaded_at,skipped_at FROM source_states WHERE name=$1`
+	state := SourceState{Name: name}
+	var etag, lastModified, sha *string
+	var loadedAt, skippedAt *time.Time
+	err := r.conn.QueryRow(ctx, sql, name).Scan(&etag, &lastModified, &sha, &loadedAt, &skippedAt)
+	if err == pgx.ErrNoRows {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("cannot get source state: %s", err)
+	}
+	if etag != nil {
+		state.Fingerprint.ETag = *etag
+	}
+	if lastModified != nil {
+		state.Fingerprint.LastModified = *lastModified
+	}
+	if sha != nil {
+		state.Fingerprint.Sha256 = *sha
+	}
+	if loadedAt != nil {
+		state.LoadedAt = *loadedAt
+	}
+	if skippedAt != nil {
+		state.SkippedAt = *skippedAt
+	}
+	return state, nil
+}
+
+func (r *PgRepo) SaveSourceState(ctx context.Context, state SourceState) error {
+	sql := `INSERT INTO source_states (name,etag,last_modified,sha256,loaded_at,skipped_at) VALUES ($1,$2,$3,$4,$5,$6)
+			ON CONFLICT (name) DO UPDATE SET etag=$2,last_modified=$3,sha256=$4,loaded_at=$5,skipped_at=$6`
+	_, err := r.conn.Exec(ctx, sql, state.Name, state.Fingerprint.ETag, state.Fingerprint.LastModified,
+		state.Fingerprint.Sha256, nullTime(state.LoadedAt), nullTime(state.SkippedAt))
+	if err != nil {
+		return fmt.Errorf("cannot save source state: %s", err)
+	}
+	return nil
+}
+
+// nullTime maps zero times to NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (r *PgRepo) CreateIngestionRun(ctx context.Context, run *IngestionRun) error {
+	sql := `INSERT INTO ingestion_runs (trigger,started_at,status) VALUES ($1,$2,$3) RETURNING id`
+	if err := r.conn.QueryRow(ctx, sql, run.Trigger, run.StartedAt, run.Status).Scan(&run.Id); err != nil {
+		return fmt.Errorf("cannot create ingestion run: %s", err)
+	}
+	return nil
+}
+
+func (r *PgRepo) FinishIngestionRun(ctx context.Context, run *IngestionRun) error {
+	sql := `UPDATE ingestion_runs SET finished_at=$2,status=$3,error=$4 WHERE id=$1`
+	if _, err := r.conn.Exec(ctx, sql, run.Id, run.FinishedAt, run.Status, run.Error); err != nil {
+		return fmt.Errorf("cannot finish ingestion run %d: %s", run.Id, err)
+	}
+	return nil
+}
+
+func (r *PgRepo) AddIngestionStep(ctx context.Context, step *IngestionStep) error {
+	sql := `INSERT INTO ingestion_steps (run_id,dataset,started_at,finished_at,status,rows_read,rows_inserted,
+            rows_updated,rows_rejected,values_quarantined,values_revised,source_url,source_sha256,error)
+            VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14) RETURNING id`
+	err := r.conn.QueryRow(ctx, sql, step.RunId, step.Dataset, step.StartedAt, step.FinishedAt, step.Status,
+		step.RowsRead, step.RowsInserted, step.RowsUpdated, step.RowsRejected, step.ValuesQuarantined, step.ValuesRevised,
+		step.SourceUrl, step.SourceSha256, step.Error).Scan(&step.Id)
+	if err != nil {
+		return fmt.Errorf("cannot add ingestion step: %s", err)
+	}
+	return nil
+}
+
+// GetIngestionRuns returns all ingestion runs, latest first, without their steps.
+func (r *PgRepo) GetIngestionRuns(ctx context.Context) ([]IngestionRun, error) {
+	sql := `SELECT id,trigger,started_at,finished_at,status,error FROM ingestion_runs ORDER BY id DESC`
+	rows, err := r.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get ingestion runs: %s", err)
+	}
+	defer rows.Close()
+
+	var res []IngestionRun
+	for rows.Next() {
+		var run IngestionRun
+		if err := rows.Scan(&run.Id, &run.Trigger, &run.StartedAt, &run.FinishedAt, &run.Status,
+			&run.Error); err != nil {
+			return nil, fmt.Errorf("cannot scan ingestion run: %s", err)
+		}
+		res = append(res, run)
+	}
+	return res, rows.Err()
+}
+
+// GetIngestionRun returns an ingestion run together with its steps, or ErrNotFound.
+func (r *PgRepo) GetIngestionRun(ctx context.Context, id int) (IngestionRun, error) {
+	sql := `SELECT id,trigger,started_at,finished_at,status,error FROM ingestion_runs WHERE id=$1`
+	var run IngestionRun
+	err := r.conn.QueryRow(ctx, sql, id).Scan(&run.Id, &run.Trigger, &run.StartedAt, &run.FinishedAt, &run.Status,
+		&run.Error)
+	if err == pgx.ErrNoRows {
+		return run, ErrNotFound
+	}
+	if err != nil {
+		return run, fmt.Errorf("cannot get ingestion run %d: %s", id, err)
+	}
+
+	sql = `SELECT id,run_id,dataset,started_at,finished_at,status,rows_read,rows_inserted,rows_updated,rows_rejected,
+           values_quarantined,values_revised,source_url,source_sha256,error FROM ingestion_steps WHERE run_id=$1 ORDER BY id ASC`
+	rows, err := r.conn.Query(ctx, sql, id)
+	if err != nil {
+		return run, fmt.Errorf("cannot get steps of ingestion run %d: %s", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st IngestionStep
+		if err := rows.Scan(&st.Id, &st.RunId, &st.Dataset, &st.StartedAt, &st.FinishedAt, &st.Status, &st.RowsRead,
+			&st.RowsInserted, &st.RowsUpdated, &st.RowsRejected, &st.ValuesQuarantined, &st.ValuesRevised, &st.SourceUrl,
+			&st.SourceSha256, &st.Error); err != nil {
+			return run, fmt.Errorf("cannot scan ingestion step: %s", err)
+		}
+		run.Steps = append(run.Steps, st)
+	}
+
+	return run, rows.Err()
+}
@@ -35,89 +35,163 @@ func (m *RepoMock) EXPECT() *RepoMockMockRecorder {
 	return m.recorder
 }
 
-// AddCase mocks base method.
-func (m *RepoMock) AddCase(ctx context.Context, date time.Time, amount int, sluggedRegionalUnit string) error {
+// AddIngestionStep mocks base method.
+func (m *RepoMock) AddIngestionStep(ctx context.Context, step *IngestionStep) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddCase", ctx, date, amount, sluggedRegionalUnit)
+	ret := m.ctrl.Call(m, "AddIngestionStep", ctx, step)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// AddCase indicates an expected call of AddCase.
-func (mr *RepoMockMockRecorder) AddCase(ctx, date, amount, sluggedRegionalUnit interface{}) *gomock.Call {
+// AddIngestionStep indicates an expected call of AddIngestionStep.
+func (mr *RepoMockMockRecorder) AddIngestionStep(ctx, step interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCase", reflect.TypeOf((*RepoMock)(nil).AddCase), ctx, date, amount, sluggedRegionalUnit)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddIngestionStep", reflect.TypeOf((*RepoMock)(nil).AddIngestionStep), ctx, step)
 }
 
-// AddDemographicInfo mocks base method.
-func (m *RepoMock) AddDemographicInfo(ctx context.Context, info DemographicInfo) error {
+// AddMunicipality mocks base method.
+func (m *RepoMock) AddMunicipality(ctx context.Context, name string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddMunicipality", ctx, name)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddMunicipality indicates an expected call of AddMunicipality.
+func (mr *RepoMockMockRecorder) AddMunicipality(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMunicipality", reflect.TypeOf((*RepoMock)(nil).AddMunicipality), ctx, name)
+}
+
+// AddRegionalUnit mocks base method.
+func (m *RepoMock) AddRegionalUnit(ctx context.Context, rgu RegionalUnit) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRegionalUnit", ctx, rgu)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddRegionalUnit indicates an expected call of AddRegionalUnit.
+func (mr *RepoMockMockRecorder) AddRegionalUnit(ctx, rgu interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRegionalUnit", reflect.TypeOf((*RepoMock)(nil).AddRegionalUnit), ctx, rgu)
+}
+
+// AddWasteSite mocks base method.
+func (m *RepoMock) AddWasteSite(ctx context.Context, site WasteSite) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWasteSite", ctx, site)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddWasteSite indicates an expected call of AddWasteSite.
+func (mr *RepoMockMockRecorder) AddWasteSite(ctx, site interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWasteSite", reflect.TypeOf((*RepoMock)(nil).AddWasteSite), ctx, site)
+}
+
+// CountTableRows mocks base method.
+func (m *RepoMock) CountTableRows(ctx context.Context, table string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountTableRows", ctx, table)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountTableRows indicates an expected call of CountTableRows.
+func (mr *RepoMockMockRecorder) CountTableRows(ctx, table interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountTableRows", reflect.TypeOf((*RepoMock)(nil).CountTableRows), ctx, table)
+}
+
+// CreateIngestionRun mocks base method.
+func (m *RepoMock) CreateIngestionRun(ctx context.Context, run *IngestionRun) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddDemographicInfo", ctx, info)
+	ret := m.ctrl.Call(m, "CreateIngestionRun", ctx, run)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// AddDemographicInfo indicates an expected call of AddDemographicInfo.
-func (mr *RepoMockMockRecorder) AddDemographicInfo(ctx, info interface{}) *gomock.Call {
+// CreateIngestionRun indicates an expected call of CreateIngestionRun.
+func (mr *RepoMockMockRecorder) CreateIngestionRun(ctx, run interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddDemographicInfo", reflect.TypeOf((*RepoMock)(nil).AddDemographicInfo), ctx, info)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIngestionRun", reflect.TypeOf((*RepoMock)(nil).CreateIngestionRun), ctx, run)
 }
 
-// AddFullInfo mocks base method.
-func (m *RepoMock) AddFullInfo(ctx context.Context, fi *FullInfo) error {
+// DeleteTableRows mocks base method.
+func (m *RepoMock) DeleteTableRows(ctx context.Context, table string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddFullInfo", ctx, fi)
+	ret := m.ctrl.Call(m, "DeleteTableRows", ctx, table)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// AddFullInfo indicates an expected call of AddFullInfo.
-func (mr *RepoMockMockRecorder) AddFullInfo(ctx, fi interface{}) *gomock.Call {
+// DeleteTableRows indicates an expected call of DeleteTableRows.
+func (mr *RepoMockMockRecorder) DeleteTableRows(ctx, table interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFullInfo", reflect.TypeOf((*RepoMock)(nil).AddFullInfo), ctx, fi)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTableRows", reflect.TypeOf((*RepoMock)(nil).DeleteTableRows), ctx, table)
 }
 
-// AddMunicipality mocks base method.
-func (m *RepoMock) AddMunicipality(ctx context.Context, name string) (int, error) {
+// EnsureDatasetTable mocks base method.
+func (m *RepoMock) EnsureDatasetTable(ctx context.Context, def DatasetDefinition) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddMunicipality", ctx, name)
-	ret0, _ := ret[0].(int)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret := m.ctrl.Call(m, "EnsureDatasetTable", ctx, def)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
-// AddMunicipality indicates an expected call of AddMunicipality.
-func (mr *RepoMockMockRecorder) AddMunicipality(ctx, name interface{}) *gomock.Call {
+// EnsureDatasetTable indicates an expected call of EnsureDatasetTable.
+func (mr *RepoMockMockRecorder) EnsureDatasetTable(ctx, def interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMunicipality", reflect.TypeOf((*RepoMock)(nil).AddMunicipality), ctx, name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureDatasetTable", reflect.TypeOf((*RepoMock)(nil).EnsureDatasetTable), ctx, def)
 }
 
-// AddRegionalUnit mocks base method.
-func (m *RepoMock) AddRegionalUnit(ctx context.Context, rgu RegionalUnit) error {
+// ExportTableRows mocks base method.
+func (m *RepoMock) ExportTableRows(ctx context.Context, table string, columns []string, fn func([]*string) error) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddRegionalUnit", ctx, rgu)
+	ret := m.ctrl.Call(m, "ExportTableRows", ctx, table, columns, fn)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// AddRegionalUnit indicates an expected call of AddRegionalUnit.
-func (mr *RepoMockMockRecorder) AddRegionalUnit(ctx, rgu interface{}) *gomock.Call {
+// ExportTableRows indicates an expected call of ExportTableRows.
+func (mr *RepoMockMockRecorder) ExportTableRows(ctx, table, columns, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRegionalUnit", reflect.TypeOf((*RepoMock)(nil).AddRegionalUnit), ctx, rgu)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportTableRows", reflect.TypeOf((*RepoMock)(nil).ExportTableRows), ctx, table, columns, fn)
 }
 
-// AddYearlyDeath mocks base method.
-func (m *RepoMock) AddYearlyDeath(ctx context.Context, munId, deaths, year int) error {
+// FinishIngestionRun mocks base method.
+func (m *RepoMock) FinishIngestionRun(ctx context.Context, run *IngestionRun) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddYearlyDeath", ctx, munId, deaths, year)
+	ret := m.ctrl.Call(m, "FinishIngestionRun", ctx, run)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// AddYearlyDeath indicates an expected call of AddYearlyDeath.
-func (mr *RepoMockMockRecorder) AddYearlyDeath(ctx, munId, deaths, year interface{}) *gomock.Call {
+// FinishIngestionRun indicates an expected call of FinishIngestionRun.
+func (mr *RepoMockMockRecorder) FinishIngestionRun(ctx, run interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddYearlyDeath", reflect.TypeOf((*RepoMock)(nil).AddYearlyDeath), ctx, munId, deaths, year)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishIngestionRun", reflect.TypeOf((*RepoMock)(nil).FinishIngestionRun), ctx, run)
+}
+
+// GetCadencePeriods mocks base method.
+func (m *RepoMock) GetCadencePeriods(ctx context.Context, dataset string) ([]CadencePeriod, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCadencePeriods", ctx, dataset)
+	ret0, _ := ret[0].([]CadencePeriod)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCadencePeriods indicates an expected call of GetCadencePeriods.
+func (mr *RepoMockMockRecorder) GetCadencePeriods(ctx, dataset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCadencePeriods", reflect.TypeOf((*RepoMock)(nil).GetCadencePeriods), ctx, dataset)
 }
 
 // GetCases mocks base method.
@@ -135,6 +209,36 @@ func (mr *RepoMockMockRecorder) GetCases(ctx, filter interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCases", reflect.TypeOf((*RepoMock)(nil).GetCases), ctx, filter)
 }
 
+// GetDatasetRows mocks base method.
+func (m *RepoMock) GetDatasetRows(ctx context.Context, def DatasetDefinition, filter DatesFilter) ([]map[string]interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDatasetRows", ctx, def, filter)
+	ret0, _ := ret[0].([]map[string]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDatasetRows indicates an expected call of GetDatasetRows.
+func (mr *RepoMockMockRecorder) GetDatasetRows(ctx, def, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDatasetRows", reflect.TypeOf((*RepoMock)(nil).GetDatasetRows), ctx, def, filter)
+}
+
+// GetDeathsPerArea mocks base method.
+func (m *RepoMock) GetDeathsPerArea(ctx context.Context, filter DeathsFilter, level AreaLevel) ([]AreaDeaths, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeathsPerArea", ctx, filter, level)
+	ret0, _ := ret[0].([]AreaDeaths)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeathsPerArea indicates an expected call of GetDeathsPerArea.
+func (mr *RepoMockMockRecorder) GetDeathsPerArea(ctx, filter, level interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeathsPerArea", reflect.TypeOf((*RepoMock)(nil).GetDeathsPerArea), ctx, filter, level)
+}
+
 // GetDeathsPerMunicipality mocks base method.
 func (m *RepoMock) GetDeathsPerMunicipality(ctx context.Context, filter DeathsFilter) ([]YearlyDeaths, error) {
 	m.ctrl.T.Helper()
@@ -180,6 +284,51 @@ func (mr *RepoMockMockRecorder) GetFromTimeline(ctx, filter interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFromTimeline", reflect.TypeOf((*RepoMock)(nil).GetFromTimeline), ctx, filter)
 }
 
+// GetHierarchy mocks base method.
+func (m *RepoMock) GetHierarchy(ctx context.Context) ([]HierarchyNode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHierarchy", ctx)
+	ret0, _ := ret[0].([]HierarchyNode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHierarchy indicates an expected call of GetHierarchy.
+func (mr *RepoMockMockRecorder) GetHierarchy(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHierarchy", reflect.TypeOf((*RepoMock)(nil).GetHierarchy), ctx)
+}
+
+// GetIngestionRun mocks base method.
+func (m *RepoMock) GetIngestionRun(ctx context.Context, id int) (IngestionRun, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIngestionRun", ctx, id)
+	ret0, _ := ret[0].(IngestionRun)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIngestionRun indicates an expected call of GetIngestionRun.
+func (mr *RepoMockMockRecorder) GetIngestionRun(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIngestionRun", reflect.TypeOf((*RepoMock)(nil).GetIngestionRun), ctx, id)
+}
+
+// GetIngestionRuns mocks base method.
+func (m *RepoMock) GetIngestionRuns(ctx context.Context) ([]IngestionRun, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIngestionRuns", ctx)
+	ret0, _ := ret[0].([]IngestionRun)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIngestionRuns indicates an expected call of GetIngestionRuns.
+func (mr *RepoMockMockRecorder) GetIngestionRuns(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIngestionRuns", reflect.TypeOf((*RepoMock)(nil).GetIngestionRuns), ctx)
+}
+
 // GetMunicipalities mocks base method.
 func (m *RepoMock) GetMunicipalities(ctx context.Context) ([]Municipality, error) {
 	m.ctrl.T.Helper()
@@ -195,6 +344,36 @@ func (mr *RepoMockMockRecorder) GetMunicipalities(ctx interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMunicipalities", reflect.TypeOf((*RepoMock)(nil).GetMunicipalities), ctx)
 }
 
+// GetQuarantinedValue mocks base method.
+func (m *RepoMock) GetQuarantinedValue(ctx context.Context, id int) (QuarantinedValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuarantinedValue", ctx, id)
+	ret0, _ := ret[0].(QuarantinedValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuarantinedValue indicates an expected call of GetQuarantinedValue.
+func (mr *RepoMockMockRecorder) GetQuarantinedValue(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuarantinedValue", reflect.TypeOf((*RepoMock)(nil).GetQuarantinedValue), ctx, id)
+}
+
+// GetQuarantinedValues mocks base method.
+func (m *RepoMock) GetQuarantinedValues(ctx context.Context, filter QuarantineFilter) ([]QuarantinedValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuarantinedValues", ctx, filter)
+	ret0, _ := ret[0].([]QuarantinedValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuarantinedValues indicates an expected call of GetQuarantinedValues.
+func (mr *RepoMockMockRecorder) GetQuarantinedValues(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuarantinedValues", reflect.TypeOf((*RepoMock)(nil).GetQuarantinedValues), ctx, filter)
+}
+
 // GetRegionalUnits mocks base method.
 func (m *RepoMock) GetRegionalUnits(ctx context.Context) ([]RegionalUnit, error) {
 	m.ctrl.T.Helper()
@@ -209,3 +388,423 @@ func (mr *RepoMockMockRecorder) GetRegionalUnits(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRegionalUnits", reflect.TypeOf((*RepoMock)(nil).GetRegionalUnits), ctx)
 }
+
+// GetRevisions mocks base method.
+func (m *RepoMock) GetRevisions(ctx context.Context, filter RevisionFilter) ([]Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevisions", ctx, filter)
+	ret0, _ := ret[0].([]Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevisions indicates an expected call of GetRevisions.
+func (mr *RepoMockMockRecorder) GetRevisions(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevisions", reflect.TypeOf((*RepoMock)(nil).GetRevisions), ctx, filter)
+}
+
+// GetSourceState mocks base method.
+func (m *RepoMock) GetSourceState(ctx context.Context, name string) (SourceState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSourceState", ctx, name)
+	ret0, _ := ret[0].(SourceState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSourceState indicates an expected call of GetSourceState.
+func (mr *RepoMockMockRecorder) GetSourceState(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSourceState", reflect.TypeOf((*RepoMock)(nil).GetSourceState), ctx, name)
+}
+
+// GetTableColumns mocks base method.
+func (m *RepoMock) GetTableColumns(ctx context.Context, table string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTableColumns", ctx, table)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTableColumns indicates an expected call of GetTableColumns.
+func (mr *RepoMockMockRecorder) GetTableColumns(ctx, table interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTableColumns", reflect.TypeOf((*RepoMock)(nil).GetTableColumns), ctx, table)
+}
+
+// GetVaccinations mocks base method.
+func (m *RepoMock) GetVaccinations(ctx context.Context, filter VaccinationsFilter) ([]Vaccination, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVaccinations", ctx, filter)
+	ret0, _ := ret[0].([]Vaccination)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVaccinations indicates an expected call of GetVaccinations.
+func (mr *RepoMockMockRecorder) GetVaccinations(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVaccinations", reflect.TypeOf((*RepoMock)(nil).GetVaccinations), ctx, filter)
+}
+
+// GetWaste mocks base method.
+func (m *RepoMock) GetWaste(ctx context.Context, filter WasteFilter) ([]WasteMeasurement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWaste", ctx, filter)
+	ret0, _ := ret[0].([]WasteMeasurement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWaste indicates an expected call of GetWaste.
+func (mr *RepoMockMockRecorder) GetWaste(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWaste", reflect.TypeOf((*RepoMock)(nil).GetWaste), ctx, filter)
+}
+
+// GetWasteSites mocks base method.
+func (m *RepoMock) GetWasteSites(ctx context.Context) ([]WasteSite, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWasteSites", ctx)
+	ret0, _ := ret[0].([]WasteSite)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWasteSites indicates an expected call of GetWasteSites.
+func (mr *RepoMockMockRecorder) GetWasteSites(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWasteSites", reflect.TypeOf((*RepoMock)(nil).GetWasteSites), ctx)
+}
+
+// ImportTableRows mocks base method.
+func (m *RepoMock) ImportTableRows(ctx context.Context, table string, columns []string, next func() ([]*string, error)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportTableRows", ctx, table, columns, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ImportTableRows indicates an expected call of ImportTableRows.
+func (mr *RepoMockMockRecorder) ImportTableRows(ctx, table, columns, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportTableRows", reflect.TypeOf((*RepoMock)(nil).ImportTableRows), ctx, table, columns, next)
+}
+
+// MergeCases mocks base method.
+func (m *RepoMock) MergeCases(ctx context.Context) (MergeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeCases", ctx)
+	ret0, _ := ret[0].(MergeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeCases indicates an expected call of MergeCases.
+func (mr *RepoMockMockRecorder) MergeCases(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeCases", reflect.TypeOf((*RepoMock)(nil).MergeCases), ctx)
+}
+
+// MergeDatasetRows mocks base method.
+func (m *RepoMock) MergeDatasetRows(ctx context.Context, def DatasetDefinition) (MergeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeDatasetRows", ctx, def)
+	ret0, _ := ret[0].(MergeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeDatasetRows indicates an expected call of MergeDatasetRows.
+func (mr *RepoMockMockRecorder) MergeDatasetRows(ctx, def interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeDatasetRows", reflect.TypeOf((*RepoMock)(nil).MergeDatasetRows), ctx, def)
+}
+
+// MergeDemographicInfo mocks base method.
+func (m *RepoMock) MergeDemographicInfo(ctx context.Context) (MergeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeDemographicInfo", ctx)
+	ret0, _ := ret[0].(MergeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeDemographicInfo indicates an expected call of MergeDemographicInfo.
+func (mr *RepoMockMockRecorder) MergeDemographicInfo(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeDemographicInfo", reflect.TypeOf((*RepoMock)(nil).MergeDemographicInfo), ctx)
+}
+
+// MergeTimeline mocks base method.
+func (m *RepoMock) MergeTimeline(ctx context.Context) (MergeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeTimeline", ctx)
+	ret0, _ := ret[0].(MergeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeTimeline indicates an expected call of MergeTimeline.
+func (mr *RepoMockMockRecorder) MergeTimeline(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeTimeline", reflect.TypeOf((*RepoMock)(nil).MergeTimeline), ctx)
+}
+
+// MergeVaccinations mocks base method.
+func (m *RepoMock) MergeVaccinations(ctx context.Context) (MergeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeVaccinations", ctx)
+	ret0, _ := ret[0].(MergeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeVaccinations indicates an expected call of MergeVaccinations.
+func (mr *RepoMockMockRecorder) MergeVaccinations(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeVaccinations", reflect.TypeOf((*RepoMock)(nil).MergeVaccinations), ctx)
+}
+
+// MergeWaste mocks base method.
+func (m *RepoMock) MergeWaste(ctx context.Context) (MergeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeWaste", ctx)
+	ret0, _ := ret[0].(MergeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeWaste indicates an expected call of MergeWaste.
+func (mr *RepoMockMockRecorder) MergeWaste(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeWaste", reflect.TypeOf((*RepoMock)(nil).MergeWaste), ctx)
+}
+
+// MergeYearlyDeaths mocks base method.
+func (m *RepoMock) MergeYearlyDeaths(ctx context.Context) (MergeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeYearlyDeaths", ctx)
+	ret0, _ := ret[0].(MergeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeYearlyDeaths indicates an expected call of MergeYearlyDeaths.
+func (mr *RepoMockMockRecorder) MergeYearlyDeaths(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeYearlyDeaths", reflect.TypeOf((*RepoMock)(nil).MergeYearlyDeaths), ctx)
+}
+
+// QuarantineValue mocks base method.
+func (m *RepoMock) QuarantineValue(ctx context.Context, q *QuarantinedValue) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuarantineValue", ctx, q)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QuarantineValue indicates an expected call of QuarantineValue.
+func (mr *RepoMockMockRecorder) QuarantineValue(ctx, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuarantineValue", reflect.TypeOf((*RepoMock)(nil).QuarantineValue), ctx, q)
+}
+
+// ResolveQuarantinedValue mocks base method.
+func (m *RepoMock) ResolveQuarantinedValue(ctx context.Context, id int, status string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveQuarantinedValue", ctx, id, status, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResolveQuarantinedValue indicates an expected call of ResolveQuarantinedValue.
+func (mr *RepoMockMockRecorder) ResolveQuarantinedValue(ctx, id, status, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveQuarantinedValue", reflect.TypeOf((*RepoMock)(nil).ResolveQuarantinedValue), ctx, id, status, at)
+}
+
+// SaveSourceState mocks base method.
+func (m *RepoMock) SaveSourceState(ctx context.Context, state SourceState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSourceState", ctx, state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSourceState indicates an expected call of SaveSourceState.
+func (mr *RepoMockMockRecorder) SaveSourceState(ctx, state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSourceState", reflect.TypeOf((*RepoMock)(nil).SaveSourceState), ctx, state)
+}
+
+// SetTimelineValue mocks base method.
+func (m *RepoMock) SetTimelineValue(ctx context.Context, date time.Time, field string, value *float64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTimelineValue", ctx, date, field, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTimelineValue indicates an expected call of SetTimelineValue.
+func (mr *RepoMockMockRecorder) SetTimelineValue(ctx, date, field, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTimelineValue", reflect.TypeOf((*RepoMock)(nil).SetTimelineValue), ctx, date, field, value)
+}
+
+// StageCases mocks base method.
+func (m *RepoMock) StageCases(ctx context.Context, cases []CaseRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageCases", ctx, cases)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageCases indicates an expected call of StageCases.
+func (mr *RepoMockMockRecorder) StageCases(ctx, cases interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageCases", reflect.TypeOf((*RepoMock)(nil).StageCases), ctx, cases)
+}
+
+// StageDatasetRows mocks base method.
+func (m *RepoMock) StageDatasetRows(ctx context.Context, def DatasetDefinition, records [][]interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageDatasetRows", ctx, def, records)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageDatasetRows indicates an expected call of StageDatasetRows.
+func (mr *RepoMockMockRecorder) StageDatasetRows(ctx, def, records interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageDatasetRows", reflect.TypeOf((*RepoMock)(nil).StageDatasetRows), ctx, def, records)
+}
+
+// StageDemographicInfo mocks base method.
+func (m *RepoMock) StageDemographicInfo(ctx context.Context, infos []DemographicInfo) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageDemographicInfo", ctx, infos)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageDemographicInfo indicates an expected call of StageDemographicInfo.
+func (mr *RepoMockMockRecorder) StageDemographicInfo(ctx, infos interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageDemographicInfo", reflect.TypeOf((*RepoMock)(nil).StageDemographicInfo), ctx, infos)
+}
+
+// StageTimeline mocks base method.
+func (m *RepoMock) StageTimeline(ctx context.Context, infos []FullInfo) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageTimeline", ctx, infos)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageTimeline indicates an expected call of StageTimeline.
+func (mr *RepoMockMockRecorder) StageTimeline(ctx, infos interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageTimeline", reflect.TypeOf((*RepoMock)(nil).StageTimeline), ctx, infos)
+}
+
+// StageVaccinations mocks base method.
+func (m *RepoMock) StageVaccinations(ctx context.Context, records []VaccinationRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageVaccinations", ctx, records)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageVaccinations indicates an expected call of StageVaccinations.
+func (mr *RepoMockMockRecorder) StageVaccinations(ctx, records interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageVaccinations", reflect.TypeOf((*RepoMock)(nil).StageVaccinations), ctx, records)
+}
+
+// StageWaste mocks base method.
+func (m *RepoMock) StageWaste(ctx context.Context, measurements []WasteMeasurement) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageWaste", ctx, measurements)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageWaste indicates an expected call of StageWaste.
+func (mr *RepoMockMockRecorder) StageWaste(ctx, measurements interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageWaste", reflect.TypeOf((*RepoMock)(nil).StageWaste), ctx, measurements)
+}
+
+// StageYearlyDeaths mocks base method.
+func (m *RepoMock) StageYearlyDeaths(ctx context.Context, deaths []YearlyDeaths) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageYearlyDeaths", ctx, deaths)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageYearlyDeaths indicates an expected call of StageYearlyDeaths.
+func (mr *RepoMockMockRecorder) StageYearlyDeaths(ctx, deaths interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageYearlyDeaths", reflect.TypeOf((*RepoMock)(nil).StageYearlyDeaths), ctx, deaths)
+}
+
+// SyncHierarchy mocks base method.
+func (m *RepoMock) SyncHierarchy(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SyncHierarchy", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SyncHierarchy indicates an expected call of SyncHierarchy.
+func (mr *RepoMockMockRecorder) SyncHierarchy(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncHierarchy", reflect.TypeOf((*RepoMock)(nil).SyncHierarchy), ctx)
+}
+
+// WithIngestionLock mocks base method.
+func (m *RepoMock) WithIngestionLock(ctx context.Context, wait bool, fn func() error) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithIngestionLock", ctx, wait, fn)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WithIngestionLock indicates an expected call of WithIngestionLock.
+func (mr *RepoMockMockRecorder) WithIngestionLock(ctx, wait, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithIngestionLock", reflect.TypeOf((*RepoMock)(nil).WithIngestionLock), ctx, wait, fn)
+}
+
+// WithSnapshot mocks base method.
+func (m *RepoMock) WithSnapshot(ctx context.Context, fn func(Repo) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithSnapshot", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithSnapshot indicates an expected call of WithSnapshot.
+func (mr *RepoMockMockRecorder) WithSnapshot(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithSnapshot", reflect.TypeOf((*RepoMock)(nil).WithSnapshot), ctx, fn)
+}
+
+// WithTx mocks base method.
+func (m *RepoMock) WithTx(ctx context.Context, fn func(Repo) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx.
+func (mr *RepoMockMockRecorder) WithTx(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*RepoMock)(nil).WithTx), ctx, fn)
+}
@@ -0,0 +1,24 @@
+package data
+
+import (
+	"context"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// ExpectTx makes the mock run every unit of work given to WithTx against itself, the way a real transaction would
+// run against the database. Use the returned call to limit how many times it is expected.
+func (m *RepoMock) ExpectTx() *gomock.Call {
+	return m.EXPECT().WithTx(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, fn func(repo Repo) error) error {
+			return fn(m)
+		})
+}
+
+// ExpectSnapshot makes the mock run every unit of work given to WithSnapshot against itself.
+func (m *RepoMock) ExpectSnapshot() *gomock.Call {
+	return m.EXPECT().WithSnapshot(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, fn func(repo Repo) error) error {
+			return fn(m)
+		})
+}
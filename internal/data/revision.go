@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Revision is a value of a dataset that a load changed. Key identifies the row, e.g. its date and regional unit,
+// and values are formatted as text. Rows that are new are not revisions.
+type Revision struct {
+	Id             int                    `json:"id"`
+	Dataset        string                 `json:"dataset"`
+	Key            map[string]interface{} `json:"key"`
+	Field          string                 `json:"field"`
+	OldValue       *string                `json:"old_value"`
+	NewValue       *string                `json:"new_value"`
+	IngestionRunId *int                   `json:"ingestion_run_id"`
+	RecordedAt     time.Time              `json:"recorded_at"`
+}
+
+type RevisionFilter struct {
+	Dataset string
+	Field   string
+	// Since keeps the revisions recorded at or after it
+	Since time.Time
+	// AsOf keeps the revisions recorded by the end of that day
+	AsOf time.Time
+	// Limit is the number of revisions returned, all of them if zero
+	Limit int
+	// Offset is the number of revisions skipped
+	Offset int
+}
+
+// GetRevisions returns the revisions of the datasets, latest first. Revisions recorded by the same load are latest
+// first as well.
+func (r *PgRepo) GetRevisions(ctx context.Context, filter RevisionFilter) ([]Revision, error) {
+	sql := `SELECT id,dataset,key,field,old_value,new_value,ingestion_run_id,recorded_at FROM revisions WHERE 1=1 `
+	counter := 1
+	var args []interface{}
+	if len(filter.Dataset) > 0 {
+		sql += fmt.Sprintf(" AND dataset=$%d ", counter)
+		counter++
+		args = append(args, filter.Dataset)
+	}
+	if len(filter.Field) > 0 {
+		sql += fmt.Sprintf(" AND field=$%d ", counter)
+		counter++
+		args = append(args, filter.Field)
+	}
+	if !filter.Since.IsZero() {
+		sql += fmt.Sprintf(" AND recorded_at >= $%d ", counter)
+		counter++
+		args = append(args, filter.Since)
+	}
+	if !filter.AsOf.IsZero() {
+		sql += fmt.Sprintf(" AND recorded_at < $%d ", counter)
+		counter++
+		args = append(args, filter.AsOf.AddDate(0, 0, 1))
+	}
+	sql += " ORDER BY recorded_at DESC, id DESC "
+	if filter.Limit > 0 {
+		sql += fmt.Sprintf(" LIMIT $%d ", counter)
+		counter++
+		args = append(args, filter.Limit)
+	}
+	if filter.Offset > 0 {
+		sql += fmt.Sprintf(" OFFSET $%d ", counter)
+		args = append(args, filter.Offset)
+	}
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get revisions: %s", err)
+	}
+	defer rows.Close()
+
+	var res []Revision
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.Id, &rev.Dataset, &rev.Key, &rev.Field, &rev.OldValue, &rev.NewValue,
+			&rev.IngestionRunId, &rev.RecordedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan revision: %s", err)
+		}
+		res = append(res, rev)
+	}
+	return res, rows.Err()
+}
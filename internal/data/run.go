@@ -0,0 +1,128 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeouts bound how long the step of a dataset may take during an ingestion run, from checking its sources to
+// committing its rows. Steps running out of time fail without affecting the other datasets.
+type Timeouts struct {
+	// Default applies to datasets without a timeout of their own. Zero means no timeout.
+	Default time.Duration
+	// Datasets holds the timeouts of specific datasets, by name
+	Datasets map[string]time.Duration
+}
+
+// DefaultTimeouts leave plenty of time for retrying slow downloads.
+var DefaultTimeouts = Timeouts{Default: 15 * time.Minute}
+
+// of returns the timeout of a dataset
+func (t Timeouts) of(dataset string) time.Duration {
+	if d, ok := t.Datasets[dataset]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// SetTimeouts changes the timeouts of the steps of ingestion runs.
+func (s *Service) SetTimeouts(t Timeouts) {
+	s.timeouts = t
+}
+
+// OnChange registers fn to be called with the names of the datasets whose rows were inserted or updated by an
+// ingestion run, once the run is over. Runs that change nothing do not call it.
+func (s *Service) OnChange(fn func(datasets []string)) {
+	s.onChange = append(s.onChange, fn)
+}
+
+// DatasetResult is the outcome of the step of a dataset in an ingestion run.
+type DatasetResult struct {
+	Dataset string `json:"dataset"`
+	// Status is StatusSucceeded, StatusFailed or StatusSkipped, if the sources of the dataset had not changed
+	Status string `json:"status"`
+	// Changed is set if rows of the dataset were inserted or updated
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RunResult is the outcome of every dataset of an ingestion run. A dataset failing does not stop the others, so a
+// run may partly succeed.
+type RunResult struct {
+	RunId    int             `json:"run_id"`
+	Datasets []DatasetResult `json:"datasets"`
+
+	mu sync.Mutex
+	// progress, if set, is told about every step as it starts and once it is over
+	progress func(step IngestionStep)
+}
+
+// started reports a step that has just started
+func (r *RunResult) started(step *IngestionStep) {
+	if r.progress != nil {
+		running := *step
+		running.Status = StatusRunning
+		r.progress(running)
+	}
+}
+
+// add records the outcome of a step. It is safe for concurrent use.
+func (r *RunResult) add(step *IngestionStep) {
+	r.mu.Lock()
+	r.Datasets = append(r.Datasets, DatasetResult{
+		Dataset: step.Dataset,
+		Status:  step.Status,
+		Changed: step.Status == StatusSucceeded && step.RowsInserted+step.RowsUpdated > 0,
+		Error:   step.Error,
+	})
+	r.mu.Unlock()
+	if r.progress != nil {
+		r.progress(*step)
+	}
+}
+
+// sort orders the datasets by name, since steps finish in no particular order
+func (r *RunResult) sort() {
+	sort.Slice(r.Datasets, func(i, j int) bool {
+		return r.Datasets[i].Dataset < r.Datasets[j].Dataset
+	})
+}
+
+// WithStatus returns the names of the datasets of a status.
+func (r *RunResult) WithStatus(status string) []string {
+	var res []string
+	for _, d := range r.Datasets {
+		if d.Status == status {
+			res = append(res, d.Dataset)
+		}
+	}
+	return res
+}
+
+// Changed returns the names of the datasets whose rows were inserted or updated.
+func (r *RunResult) Changed() []string {
+	var res []string
+	for _, d := range r.Datasets {
+		if d.Changed {
+			res = append(res, d.Dataset)
+		}
+	}
+	return res
+}
+
+// Err describes the datasets that failed, if any.
+func (r *RunResult) Err() error {
+	var errs []string
+	for _, d := range r.Datasets {
+		if d.Status == StatusFailed {
+			errs = append(errs, fmt.Sprintf("%s: %s", d.Dataset, d.Error))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d datasets failed: %s", len(errs), len(r.Datasets), strings.Join(errs, "; "))
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"covid19-greece-api/pkg/cron"
+)
+
+// Scheduler populates datasets on cron schedules of their own, in a timezone. Datasets falling due together are
+// requested in a single ingestion run, which is coordinated with the other runs like any request (see RequestRun).
+// Runs missed while the scheduler was down are skipped rather than caught up with.
+type Scheduler struct {
+	srv *Service
+	loc *time.Location
+
+	// mu guards the next runs of entries
+	mu      sync.Mutex
+	entries []scheduleEntry
+}
+
+type scheduleEntry struct {
+	dataset  string
+	schedule *cron.Schedule
+	next     time.Time
+}
+
+// ScheduledRun is the next scheduled population of a dataset.
+type ScheduledRun struct {
+	Dataset  string    `json:"dataset"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next_run"`
+}
+
+// NewScheduler schedules the datasets of srv by the cron expressions of schedules, keyed by dataset name. Datasets
+// without an expression are not populated on schedule.
+func NewScheduler(srv *Service, schedules map[string]string, loc *time.Location) (*Scheduler, error) {
+	known := make(map[string]bool)
+	for _, name := range srv.DatasetNames() {
+		known[name] = true
+	}
+	sc := &Scheduler{srv: srv, loc: loc}
+	for dataset, expr := range schedules {
+		if !known[dataset] {
+			return nil, fmt.Errorf("cannot schedule unknown dataset %s", dataset)
+		}
+		schedule, err := cron.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule of %s: %s", dataset, err)
+		}
+		sc.entries = append(sc.entries, scheduleEntry{dataset: dataset, schedule: schedule})
+	}
+	sc.advance(time.Now(), nil)
+	return sc, nil
+}
+
+// Run requests runs of the datasets whenever they fall due, until ctx is done. The runs go on with ctx, so they are
+// cancelled along with it; use Service.WaitRuns to wait for them to stop.
+func (sc *Scheduler) Run(ctx context.Context) {
+	// runs missed while the scheduler was down are skipped
+	sc.advance(time.Now(), nil)
+	for {
+		next, ok := sc.nextRun()
+		if !ok {
+			<-ctx.Done()
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		due := sc.due(now)
+		if len(due) > 0 {
+			job, outcome, err := sc.srv.RequestRun(ctx, TriggerSchedule, due...)
+			if err != nil {
+				log.Printf("ERROR: scheduled population of %v failed: %s", due, err)
+			} else {
+				log.Printf("scheduled population of %v %s as job %d", due, outcome, job.Id)
+			}
+		}
+		sc.advance(now, due)
+	}
+}
+
+// Next returns the next scheduled population of every scheduled dataset, soonest first.
+func (sc *Scheduler) Next() []ScheduledRun {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	res := make([]ScheduledRun, 0, len(sc.entries))
+	for _, e := range sc.entries {
+		res = append(res, ScheduledRun{Dataset: e.dataset, Schedule: e.schedule.String(), Next: e.next})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Next.Equal(res[j].Next) {
+			return res[i].Next.Before(res[j].Next)
+		}
+		return res[i].Dataset < res[j].Dataset
+	})
+	return res
+}
+
+// advance moves the next runs of the given datasets, or of all datasets if none are given, to the first ones after
+// now. Entries that never fire again keep a zero next run.
+func (sc *Scheduler) advance(now time.Time, datasets []string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for i := range sc.entries {
+		e := &sc.entries[i]
+		if datasets == nil || contains(datasets, e.dataset) {
+			e.next = e.schedule.Next(now.In(sc.loc))
+		}
+	}
+}
+
+// nextRun returns the soonest next run, if any
+func (sc *Scheduler) nextRun() (time.Time, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var next time.Time
+	for _, e := range sc.entries {
+		if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+			next = e.next
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// due returns the datasets whose next run is not after now
+func (sc *Scheduler) due(now time.Time) []string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var res []string
+	for _, e := range sc.entries {
+		if !e.next.IsZero() && !e.next.After(now) {
+			res = append(res, e.dataset)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
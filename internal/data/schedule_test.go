@@ -0,0 +1,60 @@
+package data
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+
+	"covid19-greece-api/pkg/file"
+)
+
+func testScheduler(t *testing.T, schedules map[string]string) (*Scheduler, error) {
+	src := file.NewMemorySource("test", nil)
+	srv, err := NewService(nil, Sources{Cases: src, Timeline: src, DeathsPerMunicipality: src, Demographics: src,
+		Waste: src})
+	assert.Nil(t, err)
+	athens, err := time.LoadLocation("Europe/Athens")
+	assert.Nil(t, err)
+	return NewScheduler(srv, schedules, athens)
+}
+
+func TestNewSchedulerRejectsInvalidSchedules(t *testing.T) {
+	_, err := testScheduler(t, map[string]string{DatasetWaste: "@daily"})
+	assert.EqualError(t, err, "cannot schedule unknown dataset waste")
+	// vaccinations have no source
+	_, err = testScheduler(t, map[string]string{DatasetVaccinations: "@daily"})
+	assert.NotNil(t, err)
+	_, err = testScheduler(t, map[string]string{DatasetTimeline: "0 25 * * *"})
+	assert.NotNil(t, err)
+}
+
+func TestSchedulerSkipsMissedRuns(t *testing.T) {
+	sc, err := testScheduler(t, map[string]string{
+		DatasetTimeline:     "@hourly",
+		DatasetDemographics: "0 4 * * mon",
+		DatasetCases:        "0 4 * * *",
+	})
+	assert.Nil(t, err)
+
+	now := time.Date(2022, 3, 15, 10, 30, 0, 0, time.UTC) // 12:30 in Athens, on a Tuesday
+	sc.advance(now, nil)
+	next := sc.Next()
+	assert.Equal(t, []string{DatasetTimeline, DatasetCases, DatasetDemographics},
+		[]string{next[0].Dataset, next[1].Dataset, next[2].Dataset})
+	assert.Equal(t, time.Date(2022, 3, 15, 11, 0, 0, 0, time.UTC), next[0].Next.UTC())
+	assert.Equal(t, time.Date(2022, 3, 16, 2, 0, 0, 0, time.UTC), next[1].Next.UTC())
+	assert.Equal(t, time.Date(2022, 3, 21, 2, 0, 0, 0, time.UTC), next[2].Next.UTC())
+
+	// a day later, both daily and hourly runs are due, but only once
+	now = now.Add(24 * time.Hour)
+	due := sc.due(now)
+	assert.Equal(t, []string{DatasetCases, DatasetTimeline}, due)
+	sc.advance(now, due)
+	assert.Empty(t, sc.due(now))
+	next = sc.Next()
+	assert.Equal(t, time.Date(2022, 3, 16, 11, 0, 0, 0, time.UTC), next[0].Next.UTC())
+	assert.Equal(t, time.Date(2022, 3, 17, 2, 0, 0, 0, time.UTC), next[1].Next.UTC())
+	assert.Equal(t, time.Date(2022, 3, 21, 2, 0, 0, 0, time.UTC), next[2].Next.UTC())
+}
@@ -2,16 +2,14 @@ package data
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"covid19-greece-api/pkg/date"
-
-	"golang.org/x/sync/errgroup"
-
 	"github.com/gosimple/slug"
 
 	"covid19-greece-api/pkg/file"
@@ -23,40 +21,72 @@ const (
 	simpleDateLayout = "2006-01-02"
 )
 
+// Dataset names. They also name the source each dataset is read from.
+const (
+	DatasetCases                 = "cases"
+	DatasetTimeline              = "timeline"
+	DatasetDeathsPerMunicipality = "deaths_per_municipality"
+	DatasetDemographics          = "demographics"
+	DatasetWaste                 = "waste"
+	DatasetVaccinations          = "vaccinations"
+)
+
 type Service struct {
-	repo      Repo
-	fromFiles bool
+	repo Repo
 
 	// CSV files, most probably coming from here (https://github.com/iMEdD-Lab/open-data/).
 	// We strictly follow their format.
-	casesCsvSrc              string
-	timelineCsvSrc           string
-	deathsPerMunicipalitySrc string
-	demographicsSrc          string
-	wasteSrc                 string
+	casesCsvSrc              file.Source
+	timelineCsvSrc           file.Source
+	deathsPerMunicipalitySrc file.Source
+	demographicsSrc          file.Source
+	wasteSrc                 file.Source
+	// vaccinationsSrc is optional, vaccinations are not populated without it
+	vaccinationsSrc file.Source
+	// registry holds the datasets declared in a registry file, see registry.go
+	registry []DatasetDefinition
+
+	anomalies AnomalyConfig
+	timeouts  Timeouts
+	// onChange is called with the datasets changed by every ingestion run
+	onChange []func(datasets []string)
+	// runs coordinates the ingestion runs requested through RequestRun, see coordinator.go
+	runs coordinator
 }
 
+// Sources holds the source of each dataset. Every dataset may come from a different kind of source,
+// e.g. a local file for waste and remote URLs for everything else. All sources but Vaccinations are required.
+type Sources struct {
+	Cases                 file.Source
+	Timeline              file.Source
+	DeathsPerMunicipality file.Source
+	Demographics          file.Source
+	Waste                 file.Source
+	Vaccinations          file.Source
+}
+
+// FullInfo is the whole timeline of a date. Values that were not reported are nil.
 type FullInfo struct {
 	Date                   time.Time `json:"date"`
-	Cases                  int       `json:"cases"`
-	TotalReinfections      int       `json:"total_reinfections"`
-	Deaths                 int       `json:"deaths"`
-	DeathsCum              int       `json:"deaths_cum"`
-	Recovered              int       `json:"recovered"`
-	HospitalAdmissions     int       `json:"hospital_admissions"`
-	HospitalDischarges     int       `json:"hospital_discharges"`
-	Intubated              int       `json:"intubated"`
-	IntubatedVac           int       `json:"intubated_vac"`
-	IntubatedUnvac         int       `json:"intubated_unvac"`
-	IcuOccupancy           float64   `json:"icu_occupancy"`
-	BedsOccupancy          float64   `json:"beds_occupancy"`
-	EstimatedNewRtpcrTests int       `json:"estimated_new_rtpcr_tests"`
-	EstimatedNewRapidTests int       `json:"estimated_new_rapid_tests"`
-	EstimatedNewTotalTests int       `json:"estimated_new_total_tests"`
-	CasesCum               int       `json:"cases_cum"`
-	WasteHighestPlace      string    `json:"waste_highest_place"`
-	WasteHighestPlaceEn    string    `json:"waste_highest_place_en"`
-	WasteHighestPercent    float64   `json:"waste_highest_percent"`
+	Cases                  *int      `json:"cases"`
+	TotalReinfections      *int      `json:"total_reinfections"`
+	Deaths                 *int      `json:"deaths"`
+	DeathsCum              *int      `json:"deaths_cum"`
+	Recovered              *int      `json:"recovered"`
+	HospitalAdmissions     *int      `json:"hospital_admissions"`
+	HospitalDischarges     *int      `json:"hospital_discharges"`
+	Intubated              *int      `json:"intubated"`
+	IntubatedVac           *int      `json:"intubated_vac"`
+	IntubatedUnvac         *int      `json:"intubated_unvac"`
+	IcuOccupancy           *float64  `json:"icu_occupancy"`
+	BedsOccupancy          *float64  `json:"beds_occupancy"`
+	EstimatedNewRtpcrTests *int      `json:"estimated_new_rtpcr_tests"`
+	EstimatedNewRapidTests *int      `json:"estimated_new_rapid_tests"`
+	EstimatedNewTotalTests *int      `json:"estimated_new_total_tests"`
+	CasesCum               *int      `json:"cases_cum"`
+	WasteHighestPlace      *string   `json:"waste_highest_place"`
+	WasteHighestPlaceEn    *string   `json:"waste_highest_place_en"`
+	WasteHighestPercent    *float64  `json:"waste_highest_percent"`
 }
 
 type RegionalUnit struct {
@@ -76,310 +106,790 @@ type Municipality struct {
 	Code         string `json:"code"`
 	Population11 int    `json:"pop_11"`
 	Population21 int    `json:"pop_21"`
+	// RegionalUnitId is nil until the municipality is linked to its regional unit
+	RegionalUnitId *int `json:"regional_unit_id"`
 }
 
+// YearlyDeaths holds the deaths of a municipality in a year. Deaths that were not reported are nil.
 type YearlyDeaths struct {
-	MunId  int `json:"municipality_id"`
-	Deaths int `json:"deaths"`
-	Year   int `json:"year"`
+	MunId  int  `json:"municipality_id"`
+	Deaths *int `json:"deaths"`
+	Year   int  `json:"year"`
 }
 
+// DemographicInfo holds the numbers of an age category at a date. Values that were not reported are nil.
 type DemographicInfo struct {
 	Date              time.Time `json:"date"`
 	Category          string    `json:"category"`
-	Cases             int       `json:"cases"`
-	Deaths            int       `json:"deaths"`
-	Intensive         int       `json:"intensive"`
-	Discharged        int       `json:"discharged"`
-	Hospitalized      int       `json:"hospitalized"`
-	HospitalizedInIcu int       `json:"hospitalized_in_icu"`
-	PassedAway        int       `json:"passed_away"`
-	Recovered         int       `json:"recovered"`
-	TreatedAtHome     int       `json:"treated_at_home"`
-}
-
-func NewService(
-	repo Repo,
-	casesSrc string,
-	timelineSrc string,
-	deathsPerMunicipalitySrc string,
-	demographicsSrc string,
-	wasteSrc string,
-	fromFiles bool,
-) (*Service, error) {
+	Cases             *int      `json:"cases"`
+	Deaths            *int      `json:"deaths"`
+	Intensive         *int      `json:"intensive"`
+	Discharged        *int      `json:"discharged"`
+	Hospitalized      *int      `json:"hospitalized"`
+	HospitalizedInIcu *int      `json:"hospitalized_in_icu"`
+	PassedAway        *int      `json:"passed_away"`
+	Recovered         *int      `json:"recovered"`
+	TreatedAtHome     *int      `json:"treated_at_home"`
+}
+
+func NewService(repo Repo, sources Sources) (*Service, error) {
+	if sources.Cases == nil || sources.Timeline == nil || sources.DeathsPerMunicipality == nil ||
+		sources.Demographics == nil || sources.Waste == nil {
+		return nil, fmt.Errorf("all data sources must be set")
+	}
 	return &Service{
 		repo:                     repo,
-		casesCsvSrc:              casesSrc,
-		timelineCsvSrc:           timelineSrc,
-		deathsPerMunicipalitySrc: deathsPerMunicipalitySrc,
-		demographicsSrc:          demographicsSrc,
-		wasteSrc:                 wasteSrc,
-		fromFiles:                fromFiles,
+		casesCsvSrc:              sources.Cases,
+		timelineCsvSrc:           sources.Timeline,
+		deathsPerMunicipalitySrc: sources.DeathsPerMunicipality,
+		demographicsSrc:          sources.Demographics,
+		wasteSrc:                 sources.Waste,
+		vaccinationsSrc:          sources.Vaccinations,
+		anomalies:                DefaultAnomalyConfig,
+		timeouts:                 DefaultTimeouts,
 	}, nil
 }
 
-func (s *Service) PopulateEverything(ctx context.Context) error {
+// SetAnomalyConfig changes the checks of daily values of the timeline. Values of cfg that are not set keep their
+// defaults.
+func (s *Service) SetAnomalyConfig(cfg AnomalyConfig) {
+	if cfg.StdDevs > 0 {
+		s.anomalies.StdDevs = cfg.StdDevs
+	}
+	if cfg.Window > 0 {
+		s.anomalies.Window = cfg.Window
+	}
+	if cfg.MinBaseline > 0 {
+		s.anomalies.MinBaseline = cfg.MinBaseline
+	}
+}
+
+// PopulateEverything populates all datasets, skipping those whose sources have not changed since they were last loaded.
+// Datasets are populated concurrently, each within its timeout, and a dataset failing does not stop the others; the
+// result tells what happened to each of them, while the error is set if any of them failed.
+// Every run and each of its steps are recorded in the ingestion history.
+func (s *Service) PopulateEverything(ctx context.Context, trigger string) (*RunResult, error) {
+	return s.PopulateDatasets(ctx, trigger)
+}
+
+// PopulateDatasets is like PopulateEverything, but populates only the named datasets, or all of them if none is named.
+func (s *Service) PopulateDatasets(ctx context.Context, trigger string, datasets ...string) (*RunResult, error) {
+	return s.populateDatasets(ctx, trigger, nil, datasets...)
+}
+
+// populateDatasets is PopulateDatasets telling progress, if set, about every step as it starts and once it is over
+func (s *Service) populateDatasets(
+	ctx context.Context,
+	trigger string,
+	progress func(step IngestionStep),
+	datasets ...string,
+) (*RunResult, error) {
+	selected := make(map[string]bool)
+	for _, name := range s.DatasetNames() {
+		selected[name] = len(datasets) == 0
+	}
+	for _, name := range datasets {
+		if _, ok := selected[name]; !ok {
+			return nil, fmt.Errorf("unknown dataset %s, use one of %s", name, strings.Join(s.DatasetNames(), ", "))
+		}
+		selected[name] = true
+	}
+
 	start := time.Now()
-	g, _ := errgroup.WithContext(ctx)
+	run := &IngestionRun{Trigger: trigger, StartedAt: start, Status: StatusRunning}
+	if err := s.repo.CreateIngestionRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("cannot record ingestion run: %s", err)
+	}
+	result := &RunResult{RunId: run.Id, progress: progress}
+
+	var wg sync.WaitGroup
+	step := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
 
-	g.Go(func() error {
-		if err := s.PopulateRegionalUnits(ctx); err != nil {
-			return fmt.Errorf("error populating geo: %s", err)
+	step(func() {
+		var err error
+		if selected[DatasetCases] {
+			err = s.runStep(ctx, result, DatasetCases, func(ctx context.Context, repo Repo, stats *StepStats) error {
+				if err := s.populateRegionalUnits(ctx, repo, stats); err != nil {
+					return fmt.Errorf("error populating geo: %s", err)
+				}
+				if err := s.populateCases(ctx, repo, stats); err != nil {
+					return fmt.Errorf("error populating cases per regional unit: %s", err)
+				}
+				return nil
+			}, DatasetCases)
 		}
-		if err := s.PopulateCases(ctx); err != nil {
-			return fmt.Errorf("error populating cases per regional unit: %s", err)
+		if !selected[DatasetVaccinations] {
+			return
 		}
-		return nil
+		if err != nil {
+			result.add(&IngestionStep{RunId: result.RunId, Dataset: DatasetVaccinations, Status: StatusFailed,
+				Error: fmt.Sprintf("not populated, since %s failed", DatasetCases)})
+			return
+		}
+		// vaccinations are stored per regional unit, so they are populated once the regional units are there
+		s.runStep(ctx, result, DatasetVaccinations, s.populateVaccinations, DatasetVaccinations)
 	})
 
-	g.Go(func() error {
-		if err := s.PopulateTimeline(ctx); err != nil {
-			return fmt.Errorf("error populating timeline: %s", err)
+	if selected[DatasetTimeline] {
+		step(func() {
+			// the timeline also carries the highest waste measurements, so it has to be reloaded when either of them
+			// changes
+			s.runStep(ctx, result, DatasetTimeline, s.populateWasteAndTimeline, DatasetTimeline, DatasetWaste)
+		})
+	}
+
+	if selected[DatasetDeathsPerMunicipality] {
+		step(func() {
+			s.runStep(ctx, result, DatasetDeathsPerMunicipality, s.populateDeathsPerMunicipality,
+				DatasetDeathsPerMunicipality)
+		})
+	}
+
+	if selected[DatasetDemographics] {
+		step(func() {
+			s.runStep(ctx, result, DatasetDemographics, s.populateDemographic, DatasetDemographics)
+		})
+	}
+
+	for _, def := range s.registry {
+		def := def
+		if !selected[def.Name] {
+			continue
+		}
+		step(func() {
+			s.runStep(ctx, result, def.Name, s.populateDataset(def), def.Name)
+		})
+	}
+
+	wg.Wait()
+	result.sort()
+
+	// regional units and municipalities are added by different steps, so they are linked once both are done
+	err := result.Err()
+	if selected[DatasetCases] || selected[DatasetDeathsPerMunicipality] {
+		if hErr := s.SyncHierarchy(ctx); hErr != nil {
+			if err != nil {
+				hErr = fmt.Errorf("%s; %s", err, hErr)
+			}
+			err = hErr
+		}
+	}
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = StatusSucceeded
+	if err != nil {
+		run.Status = StatusFailed
+		run.Error = err.Error()
+	}
+	if rErr := s.repo.FinishIngestionRun(ctx, run); rErr != nil {
+		log.Printf("ERROR: cannot record end of ingestion run %d: %s", run.Id, rErr)
+	}
+
+	if changed := result.Changed(); len(changed) > 0 {
+		for _, fn := range s.onChange {
+			fn(changed)
+		}
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("error populating db: %s", err)
+	}
+
+	log.Printf("database populated successfully after %s", time.Since(start).String())
+
+	return result, nil
+}
+
+// DatasetNames returns the names of the datasets populated by ingestion runs: the built-in ones, followed by those of
+// the registry. Waste is populated along with the timeline, and vaccinations only if they have a source.
+func (s *Service) DatasetNames() []string {
+	names := []string{DatasetCases, DatasetTimeline, DatasetDeathsPerMunicipality, DatasetDemographics}
+	if s.vaccinationsSrc != nil {
+		names = append(names, DatasetVaccinations)
+	}
+	for _, def := range s.registry {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+// SyncHierarchy links the regional units and municipalities to the areas they belong to.
+func (s *Service) SyncHierarchy(ctx context.Context) error {
+	if err := s.repo.SyncHierarchy(ctx); err != nil {
+		return fmt.Errorf("error syncing hierarchy: %s", err)
+	}
+	return nil
+}
+
+// populateFunc populates a single dataset through repo, counting what happened to its rows in stats
+type populateFunc func(ctx context.Context, repo Repo, stats *StepStats) error
+
+// populateInTx validates the named sources and then runs populate in a single transaction, so that readers see
+// either the previous or the new data of the dataset, but never a mix of them.
+func (s *Service) populateInTx(ctx context.Context, populate populateFunc, sourceNames ...string) error {
+	tracked := make(map[string]*file.TrackedSource)
+	for _, name := range sourceNames {
+		if src := s.source(name); src != nil {
+			tracked[name] = file.Track(src)
+		}
+	}
+	ctx = withTracked(ctx, tracked)
+	if err := s.validate(ctx, sourceNames...); err != nil {
+		return err
+	}
+	return s.repo.WithTx(ctx, func(tx Repo) error {
+		if err := populate(ctx, tx, &StepStats{}); err != nil {
+			return err
+		}
+		// what was loaded has to be what was validated
+		for _, t := range tracked {
+			if _, err := t.Sha256(); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
+}
+
+// runStep populates a dataset as a step of an ingestion run, within the timeout of the dataset, and records the
+// outcome both in the ingestion history and in result.
+func (s *Service) runStep(ctx context.Context, result *RunResult, dataset string, populate populateFunc, sourceNames ...string) error {
+	step := &IngestionStep{RunId: result.RunId, Dataset: dataset, StartedAt: time.Now()}
+	result.started(step)
+	stepCtx := ctx
+	if timeout := s.timeouts.of(dataset); timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// the versions written by the step are tied to the run
+	err := s.populateIfChanged(withIngestionRun(stepCtx, result.RunId), step, populate, sourceNames...)
+	step.FinishedAt = time.Now()
+	if err != nil {
+		if errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %s", s.timeouts.of(dataset), err)
+		}
+		step.Status = StatusFailed
+		step.Error = err.Error()
+	}
+	// the step is recorded even if it ran out of time
+	if rErr := s.repo.AddIngestionStep(ctx, step); rErr != nil {
+		log.Printf("ERROR: cannot record ingestion step %s of run %d: %s", dataset, result.RunId, rErr)
+	}
+	result.add(step)
+	log.Printf("%s %s after %s (%d rows read, %d inserted, %d updated, %d rejected, %d values quarantined, "+
+		"%d values revised)", dataset, step.Status, step.FinishedAt.Sub(step.StartedAt), step.RowsRead,
+		step.RowsInserted, step.RowsUpdated, step.RowsRejected, step.ValuesQuarantined, step.ValuesRevised)
+	if err != nil {
+		log.Printf("ERROR: populating %s failed: %s", dataset, err)
+	}
 
-	g.Go(func() error {
-		if err := s.PopulateDeathsPerMunicipality(ctx); err != nil {
-			return fmt.Errorf("error populating municipalities: %s", err)
+	return err
+}
+
+// populateIfChanged runs populate only if at least one of the named sources changed since it was last loaded.
+// Sources are streamed, never held in memory: their contents are hashed while they are validated, which tells whether
+// they changed, and again while they are loaded, so that the fingerprints stored are the ones of the contents loaded.
+// Fingerprints are stored only after a successful population, so failed loads are retried next time. The step is
+// filled with the sources, the outcome and the row counts.
+func (s *Service) populateIfChanged(
+	ctx context.Context,
+	step *IngestionStep,
+	populate populateFunc,
+	sourceNames ...string,
+) error {
+	var states []SourceState
+	var prev []string
+	tracked := make(map[string]*file.TrackedSource)
+	defer func() {
+		for _, t := range tracked {
+			t.Close()
+		}
+	}()
+	for _, name := range sourceNames {
+		state, err := s.repo.GetSourceState(ctx, name)
+		if err != nil {
+			return err
+		}
+		prev = append(prev, state.Fingerprint.Sha256)
+		t, fp, err := file.Fetch(ctx, s.source(name), state.Fingerprint)
+		if err != nil {
+			return fmt.Errorf("cannot check source %s: %s", name, err)
+		}
+		if t != nil {
+			tracked[name] = t
+			fp.Sha256 = ""
+		}
+		state.Fingerprint = fp
+		states = append(states, state)
+	}
+
+	changed := false
+	if len(tracked) > 0 {
+		// sources that were not modified are read as well, so that the dataset is populated out of all of them
+		for _, name := range sourceNames {
+			if _, ok := tracked[name]; !ok {
+				tracked[name] = file.Track(s.source(name))
+			}
+		}
+		ctx = withTracked(ctx, tracked)
+
+		// nothing is written unless the sources satisfy their contracts. Validation reads every source completely,
+		// so their hashes are known afterwards.
+		if err := s.validate(ctx, sourceNames...); err != nil {
+			return err
+		}
+		for i, name := range sourceNames {
+			sum, err := tracked[name].Sha256()
+			if err != nil {
+				return err
+			}
+			states[i].Fingerprint.Sha256 = sum
+			changed = changed || sum != prev[i]
+		}
+	}
+	step.fillSources(s, sourceNames, states)
+
+	now := time.Now()
+	if !changed {
+		log.Printf("skipping %s, sources %v have not changed since %s", step.Dataset, sourceNames, latestLoad(states))
+		step.Status = StatusSkipped
+		for _, state := range states {
+			state.SkippedAt = now
+			if err := s.repo.SaveSourceState(ctx, state); err != nil {
+				return err
+			}
 		}
 		return nil
-	})
+	}
 
-	g.Go(func() error {
-		if err := s.PopulateDemographic(ctx); err != nil {
-			return fmt.Errorf("error populating demographics: %s", err)
+	// the fingerprints are stored in the same transaction as the data, once the contents loaded turned out to be the
+	// ones validated
+	err := s.repo.WithTx(ctx, func(tx Repo) error {
+		if err := populate(ctx, tx, &step.StepStats); err != nil {
+			return err
+		}
+		for i, state := range states {
+			if _, err := tracked[sourceNames[i]].Sha256(); err != nil {
+				return err
+			}
+			state.LoadedAt = now
+			if err := tx.SaveSourceState(ctx, state); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	step.Status = StatusSucceeded
+
+	return nil
+}
 
-	if err := g.Wait(); err != nil {
-		return fmt.Errorf("error populating db: %s", err)
+// fillSources records the named sources of the step and the hashes of their contents
+func (step *IngestionStep) fillSources(s *Service, sourceNames []string, states []SourceState) {
+	var urls, hashes []string
+	for i, name := range sourceNames {
+		urls = append(urls, s.source(name).String())
+		hashes = append(hashes, states[i].Fingerprint.Sha256)
 	}
+	step.SourceUrl = strings.Join(urls, ", ")
+	step.SourceSha256 = strings.Join(hashes, ", ")
+}
 
-	log.Printf("database populated successfully after %s", time.Since(start).String())
+// Validate checks the source of a dataset against its contract, without loading anything.
+func (s *Service) Validate(ctx context.Context, dataset string) (*ValidationReport, error) {
+	if def, ok := s.Dataset(dataset); ok {
+		return validateSource(ctx, def.layout(), s.sourceOf(ctx, dataset))
+	}
+	layout, ok := layouts[dataset]
+	if !ok {
+		return nil, fmt.Errorf("unknown dataset %s", dataset)
+	}
+	src := s.sourceOf(ctx, dataset)
+	if src == nil {
+		return nil, fmt.Errorf("no source is configured for dataset %s", dataset)
+	}
+	return validateSource(ctx, layout, src)
+}
 
+// validate fails if any of the named sources breaks its contract. The reports of invalid sources, and warnings of
+// valid ones, are logged.
+func (s *Service) validate(ctx context.Context, sourceNames ...string) error {
+	for _, name := range sourceNames {
+		report, err := s.Validate(ctx, name)
+		if err != nil {
+			return fmt.Errorf("cannot validate source %s: %s", name, err)
+		}
+		if !report.Valid() || len(report.Warnings) > 0 {
+			log.Printf("validation of %s", report)
+		}
+		if err := report.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// source returns the source of a dataset by its name
+func (s *Service) source(name string) file.Source {
+	switch name {
+	case DatasetCases:
+		return s.casesCsvSrc
+	case DatasetTimeline:
+		return s.timelineCsvSrc
+	case DatasetDeathsPerMunicipality:
+		return s.deathsPerMunicipalitySrc
+	case DatasetDemographics:
+		return s.demographicsSrc
+	case DatasetWaste:
+		return s.wasteSrc
+	case DatasetVaccinations:
+		return s.vaccinationsSrc
+	}
+	if def, ok := s.Dataset(name); ok {
+		return def.src
+	}
 	return nil
 }
 
+// trackedKey carries the tracked sources read with a context, by dataset
+type trackedKey struct{}
+
+// withTracked makes the datasets of tracked read out of their tracked sources with ctx
+func withTracked(ctx context.Context, tracked map[string]*file.TrackedSource) context.Context {
+	return context.WithValue(ctx, trackedKey{}, tracked)
+}
+
+// sourceOf returns the source of a dataset read with ctx: its tracked source, if it is tracked, or the source itself
+func (s *Service) sourceOf(ctx context.Context, name string) file.Source {
+	if tracked, ok := ctx.Value(trackedKey{}).(map[string]*file.TrackedSource); ok {
+		if t, ok := tracked[name]; ok {
+			return t
+		}
+	}
+	return s.source(name)
+}
+
+// latestLoad returns the most recent load time among the given source states, formatted for logging
+func latestLoad(states []SourceState) string {
+	var latest time.Time
+	for _, st := range states {
+		if st.LoadedAt.After(latest) {
+			latest = st.LoadedAt
+		}
+	}
+	if latest.IsZero() {
+		return "never"
+	}
+	return latest.Format(time.RFC3339)
+}
+
 func (s *Service) PopulateDeathsPerMunicipality(ctx context.Context) error {
-	data, err := file.ReadCsv(s.deathsPerMunicipalitySrc, s.fromFiles)
+	return s.populateInTx(ctx, s.populateDeathsPerMunicipality, DatasetDeathsPerMunicipality)
+}
+
+func (s *Service) populateDeathsPerMunicipality(ctx context.Context, repo Repo, stats *StepStats) error {
+	rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, DatasetDeathsPerMunicipality))
 	if err != nil {
 		return fmt.Errorf("error reading csv file: %v", err)
 	}
-	headers := data[0] // first element is always "municipality", then rest of columns are like deaths_covid_{year}
+	defer rows.Close()
 
+	// besides the municipality, columns are like deaths_covid_{year}
+	headers, err := readHeaders(rows)
+	if err != nil {
+		return err
+	}
+	cols, err := deathsLayout.mapColumns(headers)
+	if err != nil {
+		return err
+	}
 	var years []int
-	for _, h := range headers[1:] {
-		// extract year number from header
-		parts := strings.Split(h, "_")
-		years = append(years, vartypes.StringToInt(parts[len(parts)-1]))
+	for _, dc := range cols.dates {
+		years = append(years, dc.date.Year())
 	}
 
-	for _, d := range data[1:] {
-		name := d[0]
-		id, err := s.repo.AddMunicipality(ctx, name)
+	count := 0
+	var batch []YearlyDeaths
+	for rows.Next() {
+		d := rows.Row()
+		stats.RowsRead++
+		id, err := repo.AddMunicipality(ctx, cols.value(d, "municipality"))
 		if err != nil {
 			return err
 		}
-		for i, yearlyDeath := range d[1:] {
+		for _, dc := range cols.dates {
 			// match specific amount of deaths to specific year and municipality_id
-			if err := s.repo.AddYearlyDeath(ctx, id, vartypes.StringToInt(yearlyDeath), years[i]); err != nil {
+			deaths, err := vartypes.ParseNullableInt(d[dc.index])
+			if err != nil {
+				return fmt.Errorf("bad deaths number at line %d, column %s: %s", rows.Line(), dc.header, err)
+			}
+			batch = append(batch, YearlyDeaths{MunId: id, Deaths: deaths, Year: dc.date.Year()})
+		}
+		if len(batch) >= StageBatchSize {
+			if err := repo.StageYearlyDeaths(ctx, batch); err != nil {
 				return err
 			}
-
+			batch = batch[:0]
 		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %v", err)
 	}
+	if err := repo.StageYearlyDeaths(ctx, batch); err != nil {
+		return err
+	}
+	res, err := repo.MergeYearlyDeaths(ctx)
+	if err != nil {
+		return err
+	}
+	stats.merged(res)
 
-	log.Printf("added %d municipalities and their deaths info for years %v", len(data)-1, years)
+	log.Printf("added %d municipalities and their deaths info for years %v", count, years)
 
 	return nil
 }
 
 func (s *Service) PopulateRegionalUnits(ctx context.Context) error {
-	data, err := file.ReadCsv(s.casesCsvSrc, s.fromFiles)
+	return s.populateInTx(ctx, s.populateRegionalUnits, DatasetCases)
+}
+
+func (s *Service) populateRegionalUnits(ctx context.Context, repo Repo, _ *StepStats) error {
+	rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, DatasetCases))
 	if err != nil {
 		return fmt.Errorf("error reading csv file: %v", err)
 	}
+	defer rows.Close()
 
-	// take dates from csv first row
-	var dateHeaders []time.Time
-	headers := data[0]
-	for _, header := range headers[5:] {
-		t, err := csvHeaderToDate(header)
-		if err != nil {
-			return fmt.Errorf("cannot transform csv header %s to date: %s", header, err)
-		}
-		dateHeaders = append(dateHeaders, t)
+	headers, err := readHeaders(rows)
+	if err != nil {
+		return err
+	}
+	cols, err := casesLayout.mapColumns(headers)
+	if err != nil {
+		return err
 	}
 
-	for _, row := range data[1:] {
-		err := s.repo.AddRegionalUnit(ctx, RegionalUnit{
-			Slug:                   slug.Make(row[2]),
-			Department:             row[0],
-			Prefecture:             row[1],
-			RegionalUnitNormalized: row[2],
-			RegionalUnit:           row[3],
-			Pop11:                  vartypes.StringToInt(row[4]),
+	count := 0
+	for rows.Next() {
+		row := rows.Row()
+		pop, err := vartypes.ParseNullableInt(cols.value(row, "pop_11"))
+		if err == nil && pop == nil {
+			err = fmt.Errorf("population is missing")
+		}
+		if err != nil {
+			return fmt.Errorf("bad pop_11 at line %d: %s", rows.Line(), err)
+		}
+		_, err = repo.AddRegionalUnit(ctx, RegionalUnit{
+			Slug:                   slug.Make(cols.value(row, "regional_unit_normalized")),
+			Department:             cols.value(row, "department"),
+			Prefecture:             cols.value(row, "prefecture"),
+			RegionalUnitNormalized: cols.value(row, "regional_unit_normalized"),
+			RegionalUnit:           cols.value(row, "regional_unit"),
+			Pop11:                  *pop,
 		})
 		if err != nil {
 			return fmt.Errorf("cannot add regional unit: %s", err)
 		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %v", err)
 	}
 
-	log.Printf("added %d regional units", len(data)-1)
+	log.Printf("added %d regional units", count)
 
 	return nil
 }
 
 func (s *Service) PopulateCases(ctx context.Context) error {
-	data, err := file.ReadCsv(s.casesCsvSrc, s.fromFiles)
+	return s.populateInTx(ctx, s.populateCases, DatasetCases)
+}
+
+func (s *Service) populateCases(ctx context.Context, repo Repo, stats *StepStats) error {
+	rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, DatasetCases))
 	if err != nil {
 		return fmt.Errorf("error reading csv file: %v", err)
 	}
+	defer rows.Close()
 
-	// take dates from csv first row
-	var dateHeaders []time.Time
-	headers := data[0]
-	for _, header := range headers[5:] {
-		t, err := csvHeaderToDate(header)
-		if err != nil {
-			return fmt.Errorf("cannot transform csv header %s to date: %s", header, err)
-		}
-		dateHeaders = append(dateHeaders, t)
+	// dates are taken from the headers
+	headers, err := readHeaders(rows)
+	if err != nil {
+		return err
+	}
+	cols, err := casesLayout.mapColumns(headers)
+	if err != nil {
+		return err
 	}
 
-	// from 12/7 and later, EODY started giving weekly info instead of daily.
-	// From this date on, we only take the 1st of 7
-	weeklyDates := make(map[string]struct{})
-	startWithoutEody := time.Date(2022, 7, 12, 0, 0, 0, 0, time.Local)
-	it := startWithoutEody
-	for {
-		weeklyDates[it.Format(simpleDateLayout)] = struct{}{}
-		it = it.Add(7 * 24 * time.Hour)
-		if it.After(time.Now()) {
-			break
-		}
+	// values of dates that are not report dates of their cadence are dropped
+	periods, err := repo.GetCadencePeriods(ctx, DatasetCases)
+	if err != nil {
+		return fmt.Errorf("error getting cadences of cases: %s", err)
 	}
 
-	for _, row := range data[1:] {
-		for i, date := range dateHeaders {
-			if date.IsZero() {
-				return fmt.Errorf("invalid date for column %d: %v", i, row[i+5])
+	var batch []CaseRecord
+	for rows.Next() {
+		row := rows.Row()
+		stats.RowsRead++
+		sl := slug.Make(cols.value(row, "regional_unit_normalized"))
+		for _, dc := range cols.dates {
+			start, end, cadence, ok := observationPeriod(periods, dc.date)
+			if !ok {
+				continue
 			}
-			amount := vartypes.StringToInt(row[i+5])
-			if date.After(startWithoutEody) {
-				_, exists := weeklyDates[date.Format(simpleDateLayout)]
-				if !exists {
-					continue
-				}
+			amount, err := vartypes.ParseNullableInt(row[dc.index])
+			if err != nil {
+				return fmt.Errorf("bad cases number at line %d, column %s: %s", rows.Line(), dc.header, err)
 			}
-			sl := slug.Make(row[2])
-			if err := s.repo.AddCase(ctx, date, amount, sl); err != nil {
-				return fmt.Errorf("error adding death day: %v", err)
+			batch = append(batch, CaseRecord{
+				RegionalUnitSlug: sl,
+				Date:             dc.date,
+				Cases:            amount,
+				PeriodStart:      start,
+				PeriodEnd:        end,
+				Cadence:          cadence,
+			})
+		}
+		if len(batch) >= StageBatchSize {
+			if err := repo.StageCases(ctx, batch); err != nil {
+				return fmt.Errorf("error adding cases: %v", err)
 			}
+			batch = batch[:0]
 		}
-
-		log.Printf("added all cases for regional unit %s", row[2])
 	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %v", err)
+	}
+	if err := repo.StageCases(ctx, batch); err != nil {
+		return fmt.Errorf("error adding cases: %v", err)
+	}
+	res, err := repo.MergeCases(ctx)
+	if err != nil {
+		return fmt.Errorf("error adding cases: %v", err)
+	}
+	stats.merged(res)
+
+	log.Printf("added all cases for %d regional units", stats.RowsRead)
 
 	return nil
 }
 
+// populateWasteAndTimeline populates the waste measurements and the timeline, which carries the highest of them
+func (s *Service) populateWasteAndTimeline(ctx context.Context, repo Repo, stats *StepStats) error {
+	if err := s.populateWaste(ctx, repo, stats); err != nil {
+		return fmt.Errorf("error populating waste: %s", err)
+	}
+	return s.populateTimeline(ctx, repo, stats)
+}
+
 func (s *Service) PopulateTimeline(ctx context.Context) error {
-	data, err := file.ReadCsv(s.timelineCsvSrc, s.fromFiles)
+	return s.populateInTx(ctx, s.populateTimeline, DatasetTimeline)
+}
+
+func (s *Service) populateTimeline(ctx context.Context, repo Repo, stats *StepStats) error {
+	rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, DatasetTimeline))
 	if err != nil {
 		return fmt.Errorf("error reading csv file: %v", err)
 	}
+	defer rows.Close()
 
-	// take dates from csv first row
-	var dateHeaders []time.Time
-	headers := data[0]
-	for _, header := range headers[3:] {
-		t, err := csvHeaderToDate(header)
-		if err != nil {
-			return fmt.Errorf("cannot transform csv header %s to date: %s", header, err)
-		}
-		dateHeaders = append(dateHeaders, t)
+	// dates are taken from the headers, while every row holds a single field for all dates
+	headers, err := readHeaders(rows)
+	if err != nil {
+		return err
+	}
+	cols, err := timelineLayout.mapColumns(headers)
+	if err != nil {
+		return err
 	}
 
 	tl := make(map[string]*FullInfo)
+	for _, dc := range cols.dates {
+		tl[dc.date.Format(simpleDateLayout)] = &FullInfo{Date: dc.date}
+	}
 
-	for index, row := range data {
-		for i, date := range dateHeaders {
-			key := date.Format(simpleDateLayout)
-			if _, ok := tl[key]; !ok {
-				tl[key] = &FullInfo{
-					Date: date,
-				}
-			}
-			if date.IsZero() {
-				return fmt.Errorf("invalid date for column %d: %v", i, row[i+3])
-			}
-			amount := vartypes.StringToInt(row[i+3])
-			switch index {
-			case 1: //cases
-				tl[key].Cases = amount
-			case 3: //total_reinfections
-				tl[key].TotalReinfections = amount
-			case 4: //deaths
-				tl[key].Deaths = amount
-			case 5: //deaths_cum
-				tl[key].DeathsCum = amount
-			case 6: //recovered
-				tl[key].Recovered = amount
-			case 8: //hospital_admissions
-				tl[key].HospitalAdmissions = amount
-			case 9: //hospital_discharges
-				tl[key].HospitalDischarges = amount
-			case 12: //intubated
-				tl[key].Intubated = amount
-			case 13: //intubated_unvac
-				tl[key].IntubatedUnvac = amount
-			case 14: //intubated_vac
-				tl[key].IntubatedVac = amount
-			case 15: //icu_occupancy
-				tl[key].IcuOccupancy = vartypes.StringToFloat(row[i+3])
-			case 16: //beds_occupancy
-				tl[key].BedsOccupancy = vartypes.StringToFloat(row[i+3])
-			case 18: //estimated_new_rtpcr_tests
-				tl[key].EstimatedNewRtpcrTests = amount
-			case 20: //esitmated_new_rapid_tests
-				tl[key].EstimatedNewRapidTests = amount
-			case 21: //estimated_new_total_tests
-				tl[key].EstimatedNewTotalTests = amount
-			case 22: //estimated_new_total_tests
-				tl[key].CasesCum = amount
-			default:
-				// do nothing
+	// the whole timeline has to be gathered before storing it
+	byLabel := timelineRowsByLabel()
+	seen := make(map[*timelineRow]bool)
+	for rows.Next() {
+		row := rows.Row()
+		stats.RowsRead++
+		label := normalizeLabel(cols.value(row, "status"))
+		tr, ok := byLabel[label]
+		if !ok {
+			// unknown rows are reported by ValidateSource
+			continue
+		}
+		if seen[tr] {
+			return fmt.Errorf("timeline csv has more than one %q row, at line %d", label, rows.Line())
+		}
+		seen[tr] = true
+		for _, dc := range cols.dates {
+			if err := tr.set(tl[dc.date.Format(simpleDateLayout)], row[dc.index]); err != nil {
+				return fmt.Errorf("bad %s value at line %d, column %s: %s", label, rows.Line(), dc.header, err)
 			}
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %v", err)
+	}
+	if missing := missingTimelineRows(seen); len(missing) > 0 {
+		return fmt.Errorf("timeline csv misses required rows %q", missing)
+	}
 
-	wasteInfo, err := s.GetWasteDates()
+	wasteInfo, err := getWasteDates(ctx, repo)
 	if err != nil {
 		return fmt.Errorf("getting waste info error: %s", err)
 	}
 
-	end := time.Time{}
-	start := time.Now().Add(1000 * time.Hour * 24)
+	infos := make([]FullInfo, 0, len(tl))
 	for _, fl := range tl {
 		info, ok := wasteInfo[fl.Date.Format(simpleDateLayout)]
 		if ok {
-			fl.WasteHighestPercent = info.Percentage
-			fl.WasteHighestPlace = info.Place
-			fl.WasteHighestPlaceEn = info.PlaceEn
-		}
-		if err := s.repo.AddFullInfo(ctx, fl); err != nil {
-			return fmt.Errorf("cannot add full info: %s", err)
-		}
-		if fl.Date.Before(start) {
-			start = fl.Date
-		} else if fl.Date.After(end) {
-			end = fl.Date
+			fl.WasteHighestPercent = vartypes.FloatPtr(info.Percentage)
+			fl.WasteHighestPlace = vartypes.StringPtr(info.Place)
+			fl.WasteHighestPlaceEn = vartypes.StringPtr(info.PlaceEn)
 		}
+		infos = append(infos, *fl)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Date.Before(infos[j].Date)
+	})
+	var start, end time.Time
+	if len(infos) > 0 {
+		start, end = infos[0].Date, infos[len(infos)-1].Date
 	}
 
+	// suspicious values must not overwrite the published ones
+	quarantined, err := s.quarantine(ctx, repo, infos)
+	if err != nil {
+		return fmt.Errorf("cannot check timeline for anomalies: %s", err)
+	}
+	stats.ValuesQuarantined += quarantined
+
+	// the timeline is small, so it is staged in one go
+	if err := repo.StageTimeline(ctx, infos); err != nil {
+		return fmt.Errorf("cannot add full info: %s", err)
+	}
+	res, err := repo.MergeTimeline(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot add full info: %s", err)
+	}
+	stats.merged(res)
+
 	log.Printf(
 		"added full info for %d dates, from %s until %s", len(tl),
 		start.Format(simpleDateLayout),
@@ -390,137 +900,93 @@ func (s *Service) PopulateTimeline(ctx context.Context) error {
 }
 
 func (s *Service) PopulateDemographic(ctx context.Context) error {
-	data, err := file.ReadCsv(s.demographicsSrc, s.fromFiles)
+	return s.populateInTx(ctx, s.populateDemographic, DatasetDemographics)
+}
+
+func (s *Service) populateDemographic(ctx context.Context, repo Repo, stats *StepStats) error {
+	rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, DatasetDemographics))
 	if err != nil {
 		return fmt.Errorf("error reading csv file: %s", err)
 	}
+	defer rows.Close()
 
-	for i := 1; i < len(data); i++ {
-		line := data[i]
-		d, err := time.Parse("2006-01-02", line[1])
-		if err != nil {
-			return fmt.Errorf("invalid date: %s, at line %d", line[1], i)
-		}
-		cases, err := strconv.Atoi(line[3])
-		if err != nil {
-			return fmt.Errorf("bad cases number %s, line %d", line[3], i)
-		}
-		deaths, err := strconv.Atoi(line[4])
-		if err != nil {
-			return fmt.Errorf("bad deaths number %s, line %d", line[4], i)
-		}
-		intensive, err := strconv.Atoi(line[5])
-		if err != nil {
-			return fmt.Errorf("bad intensive number %s, line %d", line[5], i)
-		}
-		discharged, err := strconv.Atoi(line[6])
-		if err != nil {
-			return fmt.Errorf("bad discharged number %s, line %d", line[6], i)
-		}
-		hospitalized, err := strconv.Atoi(line[7])
-		if err != nil {
-			return fmt.Errorf("bad hospitalized number %s, line %d", line[7], i)
-		}
-		hospitalizedIcu, err := strconv.Atoi(line[8])
-		if err != nil {
-			return fmt.Errorf("bad hospitalized_icu number %s, line %d", line[8], i)
-		}
-		passedAway, err := strconv.Atoi(line[9])
-		if err != nil {
-			return fmt.Errorf("bad passed_away number %s, line %d", line[9], i)
-		}
-		recovered, err := strconv.Atoi(line[10])
-		if err != nil {
-			return fmt.Errorf("bad recovered number %s, line %d", line[10], i)
-		}
-		treatedAtHome, err := strconv.Atoi(line[11])
+	headers, err := readHeaders(rows)
+	if err != nil {
+		return err
+	}
+	cols, err := demographicsLayout.mapColumns(headers)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	var batch []DemographicInfo
+	for rows.Next() {
+		i, line := rows.Line()-1, rows.Row()
+		stats.RowsRead++
+		d, err := time.Parse("2006-01-02", cols.value(line, "date"))
 		if err != nil {
-			return fmt.Errorf("bad treated_at_home number %s, line %d", line[11], i)
+			return fmt.Errorf("invalid date: %s, at line %d", cols.value(line, "date"), i)
+		}
+		numbers := make(map[string]*int)
+		for _, name := range []string{"cases", "deaths", "intensive", "discharged", "hospitalized",
+			"hospitalized_in_icu", "passed_away", "recovered", "treated_at_home"} {
+			n, err := vartypes.ParseNullableInt(cols.value(line, name))
+			if err != nil {
+				return fmt.Errorf("bad %s number %s, line %d", name, cols.value(line, name), i)
+			}
+			numbers[name] = n
 		}
 
 		info := DemographicInfo{
 			Date:              d,
-			Category:          line[2],
-			Cases:             cases,
-			Deaths:            deaths,
-			Intensive:         intensive,
-			Discharged:        discharged,
-			Hospitalized:      hospitalized,
-			HospitalizedInIcu: hospitalizedIcu,
-			PassedAway:        passedAway,
-			Recovered:         recovered,
-			TreatedAtHome:     treatedAtHome,
-		}
-
-		if err := s.repo.AddDemographicInfo(ctx, info); err != nil {
-			return fmt.Errorf("cannot add demographic info: %s", err)
+			Category:          cols.value(line, "category"),
+			Cases:             numbers["cases"],
+			Deaths:            numbers["deaths"],
+			Intensive:         numbers["intensive"],
+			Discharged:        numbers["discharged"],
+			Hospitalized:      numbers["hospitalized"],
+			HospitalizedInIcu: numbers["hospitalized_in_icu"],
+			PassedAway:        numbers["passed_away"],
+			Recovered:         numbers["recovered"],
+			TreatedAtHome:     numbers["treated_at_home"],
+		}
+
+		batch = append(batch, info)
+		if len(batch) >= StageBatchSize {
+			if err := repo.StageDemographicInfo(ctx, batch); err != nil {
+				return fmt.Errorf("cannot add demographic info: %s", err)
+			}
+			batch = batch[:0]
 		}
+		count++
 	}
-
-	log.Printf("added %d demographic information entries", len(data)-1)
-
-	return nil
-}
-
-type WasteInfo struct {
-	Place      string
-	PlaceEn    string
-	Percentage float64
-}
-
-func (s *Service) GetWasteDates() (map[string]WasteInfo, error) {
-	data, err := file.ReadCsv(s.wasteSrc, s.fromFiles)
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %s", err)
+	}
+	if err := repo.StageDemographicInfo(ctx, batch); err != nil {
+		return fmt.Errorf("cannot add demographic info: %s", err)
+	}
+	res, err := repo.MergeDemographicInfo(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error reading csv file: %s", err)
+		return fmt.Errorf("cannot add demographic info: %s", err)
 	}
+	stats.merged(res)
 
-	calc := make(map[time.Time]map[string]WasteInfo)
+	log.Printf("added %d demographic information entries", count)
 
-	for i := 1; i < len(data); i++ {
-		yearWeek := data[i][0]
-
-		yearWeekParts := strings.Split(yearWeek, "-")
-		if len(yearWeekParts) != 2 {
-			return nil, fmt.Errorf("error at line %d. Bad week column", i)
-		}
-		year := vartypes.StringToInt(yearWeekParts[0])
-		week := vartypes.StringToInt(yearWeekParts[1])
-		dates := date.WeekToDateRange(year, week)
-
-		place := data[i][1]
-		placeEn := data[i][2]
-		percentageStr := strings.TrimRight(data[i][3], "%")
-		percentage := vartypes.StringToFloat(percentageStr)
-
-		for _, d := range dates {
-			_, ok := calc[d]
-			if !ok {
-				calc[d] = make(map[string]WasteInfo)
-			}
-			calc[d][place] = WasteInfo{Place: place, PlaceEn: placeEn, Percentage: percentage}
-		}
-	}
-
-	res := make(map[string]WasteInfo)
+	return nil
+}
 
-	for d, waste := range calc {
-		highestPercent := float64(-100000000)
-		var highestPlace, highestPlaceEn string
-		for _, wasteInfo := range waste {
-			if wasteInfo.Percentage > highestPercent {
-				highestPercent = wasteInfo.Percentage
-				highestPlace = wasteInfo.Place
-				highestPlaceEn = wasteInfo.PlaceEn
-			}
-		}
-		res[d.Format(simpleDateLayout)] = WasteInfo{
-			Place:      highestPlace,
-			Percentage: highestPercent,
-			PlaceEn:    highestPlaceEn,
+// readHeaders consumes the first record of a CSV, which is expected to hold the column headers
+func readHeaders(rows *file.CsvIterator) ([]string, error) {
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error reading csv file: %s", err)
 		}
+		return nil, fmt.Errorf("csv file %s is empty", rows)
 	}
-
-	return res, nil
+	return rows.Row(), nil
 }
 
 func csvHeaderToDate(s string) (time.Time, error) {
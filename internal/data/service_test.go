@@ -2,14 +2,21 @@ package data
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+
+	"covid19-greece-api/pkg/file"
+	"covid19-greece-api/pkg/vartypes"
 )
 
 type DataServiceSuite struct {
@@ -22,19 +29,19 @@ type DataServiceSuite struct {
 func (s *DataServiceSuite) SetupSuite() {
 	s.ctrl = gomock.NewController(s.T())
 	s.repoMock = NewRepoMock(s.ctrl)
+	s.repoMock.ExpectTx().AnyTimes()
 	path, err := os.Getwd()
 	if err != nil {
 		assert.Nil(s.T(), err)
 	}
-	srv, err := NewService(
-		s.repoMock,
-		filepath.Join(path, "test_csv/testing_cases.csv"),
-		filepath.Join(path, "test_csv/testing_timeline.csv"),
-		filepath.Join(path, "test_csv/testing_deaths.csv"),
-		filepath.Join(path, "test_csv/testing_demographics.csv"),
-		filepath.Join(path, "test_csv/testing_waste.csv"),
-		true,
-	)
+	srv, err := NewService(s.repoMock, Sources{
+		Cases:                 file.NewLocalSource(filepath.Join(path, "test_csv/testing_cases.csv")),
+		Timeline:              file.NewLocalSource(filepath.Join(path, "test_csv/testing_timeline.csv")),
+		DeathsPerMunicipality: file.NewLocalSource(filepath.Join(path, "test_csv/testing_deaths.csv")),
+		Demographics:          file.NewLocalSource(filepath.Join(path, "test_csv/testing_demographics.csv")),
+		Waste:                 file.NewLocalSource(filepath.Join(path, "test_csv/testing_waste.csv")),
+		Vaccinations:          file.NewLocalSource(filepath.Join(path, "test_csv/testing_vaccinations.csv")),
+	})
 	assert.Nil(s.T(), err)
 	s.srv = srv
 }
@@ -83,23 +90,27 @@ func (s *DataServiceSuite) TestPopulateRegionalUnits() {
 func (s *DataServiceSuite) TestPopulateCases() {
 	ctx := context.Background()
 
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), 1, "county_1")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), 2, "county_1")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), 3, "county_1")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), 4, "county_1")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), 5, "county_1")
+	s.repoMock.EXPECT().GetCadencePeriods(gomock.Any(), DatasetCases).Return(nil, nil)
+	s.repoMock.EXPECT().StageCases(gomock.Any(), []CaseRecord{
+		dailyCase("county_1", time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(1)),
+		dailyCase("county_1", time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(2)),
+		dailyCase("county_1", time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(3)),
+		dailyCase("county_1", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(4)),
+		dailyCase("county_1", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(5)),
 
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), 6, "county_2")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), 7, "county_2")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), 8, "county_2")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), 9, "county_2")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), 10, "county_2")
+		dailyCase("county_2", time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(6)),
+		dailyCase("county_2", time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(7)),
+		dailyCase("county_2", time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(8)),
+		dailyCase("county_2", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(9)),
+		dailyCase("county_2", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(10)),
 
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), 11, "county_3")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), 12, "county_3")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), 13, "county_3")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), 14, "county_3")
-	s.repoMock.EXPECT().AddCase(gomock.Any(), time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), 15, "county_3")
+		dailyCase("county_3", time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(11)),
+		dailyCase("county_3", time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(12)),
+		dailyCase("county_3", time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(13)),
+		dailyCase("county_3", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(14)),
+		dailyCase("county_3", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(15)),
+	})
+	s.repoMock.EXPECT().MergeCases(gomock.Any()).Return(MergeResult{Inserted: 15}, nil)
 
 	assert.Nil(s.T(), s.srv.PopulateCases(ctx))
 }
@@ -107,72 +118,82 @@ func (s *DataServiceSuite) TestPopulateCases() {
 func (s *DataServiceSuite) TestPopulateTimeline() {
 	ctx := context.Background()
 
-	s.repoMock.EXPECT().AddFullInfo(gomock.Any(), &FullInfo{
-		Date:                   time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC),
-		Cases:                  1,
-		TotalReinfections:      3,
-		Deaths:                 4,
-		DeathsCum:              5,
-		Recovered:              6,
-		HospitalAdmissions:     8,
-		HospitalDischarges:     9,
-		Intubated:              12,
-		IntubatedVac:           14,
-		IntubatedUnvac:         13,
-		IcuOccupancy:           15,
-		BedsOccupancy:          16,
-		EstimatedNewRtpcrTests: 18,
-		EstimatedNewRapidTests: 20,
-		EstimatedNewTotalTests: 21,
-		CasesCum:               22,
-		WasteHighestPlace:      "Κουκουβάουνες",
-		WasteHighestPlaceEn:    "koukouvaounes",
-		WasteHighestPercent:    0.69,
-	})
-	s.repoMock.EXPECT().AddFullInfo(gomock.Any(), &FullInfo{
-		Date:                   time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC),
-		Cases:                  1 + 22,
-		TotalReinfections:      3 + 22,
-		Deaths:                 4 + 22,
-		DeathsCum:              5 + 22,
-		Recovered:              6 + 22,
-		HospitalAdmissions:     8 + 22,
-		HospitalDischarges:     9 + 22,
-		Intubated:              12 + 22,
-		IntubatedVac:           14 + 22,
-		IntubatedUnvac:         13 + 22,
-		IcuOccupancy:           15 + 22,
-		BedsOccupancy:          16 + 22,
-		EstimatedNewRtpcrTests: 18 + 22,
-		EstimatedNewRapidTests: 20 + 22,
-		EstimatedNewTotalTests: 21 + 22,
-		CasesCum:               22 + 22,
-		WasteHighestPlace:      "Κουκουβάουνες",
-		WasteHighestPlaceEn:    "koukouvaounes",
-		WasteHighestPercent:    0.69,
-	})
-	s.repoMock.EXPECT().AddFullInfo(gomock.Any(), &FullInfo{
-		Date:                   time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC),
-		Cases:                  1 + 44,
-		TotalReinfections:      3 + 44,
-		Deaths:                 4 + 44,
-		DeathsCum:              5 + 44,
-		Recovered:              6 + 44,
-		HospitalAdmissions:     8 + 44,
-		HospitalDischarges:     9 + 44,
-		Intubated:              12 + 44,
-		IntubatedVac:           14 + 44,
-		IntubatedUnvac:         13 + 44,
-		IcuOccupancy:           15 + 44,
-		BedsOccupancy:          16 + 44,
-		EstimatedNewRtpcrTests: 18 + 44,
-		EstimatedNewRapidTests: 20 + 44,
-		EstimatedNewTotalTests: 21 + 44,
-		CasesCum:               22 + 44,
-		WasteHighestPlace:      "Κουκουβάουνες",
-		WasteHighestPlaceEn:    "koukouvaounes",
-		WasteHighestPercent:    0.69,
+	s.repoMock.EXPECT().GetQuarantinedValues(gomock.Any(), QuarantineFilter{Dataset: DatasetTimeline})
+	// the highest waste of every date comes from the stored measurements
+	s.repoMock.EXPECT().GetWaste(gomock.Any(), WasteFilter{}).Return([]WasteMeasurement{
+		{Site: "Θεσσαλονίκη", SiteEn: "thessalonikh", Year: 2020, Week: 9, Percentage: 0.02},
+		{Site: "Κουκουβάουνες", SiteEn: "koukouvaounes", Year: 2020, Week: 9, Percentage: 0.69},
+		{Site: "Πάτρα", SiteEn: "patra", Year: 2020, Week: 9, Percentage: -34},
+	}, nil)
+	s.repoMock.EXPECT().StageTimeline(gomock.Any(), []FullInfo{
+		{
+			Date:                   time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC),
+			Cases:                  vartypes.IntPtr(1),
+			TotalReinfections:      vartypes.IntPtr(3),
+			Deaths:                 vartypes.IntPtr(4),
+			DeathsCum:              vartypes.IntPtr(5),
+			Recovered:              vartypes.IntPtr(6),
+			HospitalAdmissions:     vartypes.IntPtr(8),
+			HospitalDischarges:     vartypes.IntPtr(9),
+			Intubated:              vartypes.IntPtr(12),
+			IntubatedVac:           vartypes.IntPtr(14),
+			IntubatedUnvac:         vartypes.IntPtr(13),
+			IcuOccupancy:           vartypes.FloatPtr(15),
+			BedsOccupancy:          vartypes.FloatPtr(16),
+			EstimatedNewRtpcrTests: vartypes.IntPtr(18),
+			EstimatedNewRapidTests: vartypes.IntPtr(20),
+			EstimatedNewTotalTests: vartypes.IntPtr(21),
+			CasesCum:               vartypes.IntPtr(22),
+			WasteHighestPlace:      vartypes.StringPtr("Κουκουβάουνες"),
+			WasteHighestPlaceEn:    vartypes.StringPtr("koukouvaounes"),
+			WasteHighestPercent:    vartypes.FloatPtr(0.69),
+		},
+		{
+			Date:                   time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC),
+			Cases:                  vartypes.IntPtr(1 + 22),
+			TotalReinfections:      vartypes.IntPtr(3 + 22),
+			Deaths:                 vartypes.IntPtr(4 + 22),
+			DeathsCum:              vartypes.IntPtr(5 + 22),
+			Recovered:              vartypes.IntPtr(6 + 22),
+			HospitalAdmissions:     vartypes.IntPtr(8 + 22),
+			HospitalDischarges:     vartypes.IntPtr(9 + 22),
+			Intubated:              vartypes.IntPtr(12 + 22),
+			IntubatedVac:           vartypes.IntPtr(14 + 22),
+			IntubatedUnvac:         vartypes.IntPtr(13 + 22),
+			IcuOccupancy:           vartypes.FloatPtr(15 + 22),
+			BedsOccupancy:          vartypes.FloatPtr(16 + 22),
+			EstimatedNewRtpcrTests: vartypes.IntPtr(18 + 22),
+			EstimatedNewRapidTests: vartypes.IntPtr(20 + 22),
+			EstimatedNewTotalTests: vartypes.IntPtr(21 + 22),
+			CasesCum:               vartypes.IntPtr(22 + 22),
+			WasteHighestPlace:      vartypes.StringPtr("Κουκουβάουνες"),
+			WasteHighestPlaceEn:    vartypes.StringPtr("koukouvaounes"),
+			WasteHighestPercent:    vartypes.FloatPtr(0.69),
+		},
+		{
+			Date:                   time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC),
+			Cases:                  vartypes.IntPtr(1 + 44),
+			TotalReinfections:      vartypes.IntPtr(3 + 44),
+			Deaths:                 vartypes.IntPtr(4 + 44),
+			DeathsCum:              vartypes.IntPtr(5 + 44),
+			Recovered:              vartypes.IntPtr(6 + 44),
+			HospitalAdmissions:     vartypes.IntPtr(8 + 44),
+			HospitalDischarges:     vartypes.IntPtr(9 + 44),
+			Intubated:              vartypes.IntPtr(12 + 44),
+			IntubatedVac:           vartypes.IntPtr(14 + 44),
+			IntubatedUnvac:         vartypes.IntPtr(13 + 44),
+			IcuOccupancy:           vartypes.FloatPtr(15 + 44),
+			BedsOccupancy:          vartypes.FloatPtr(16 + 44),
+			EstimatedNewRtpcrTests: vartypes.IntPtr(18 + 44),
+			EstimatedNewRapidTests: vartypes.IntPtr(20 + 44),
+			EstimatedNewTotalTests: vartypes.IntPtr(21 + 44),
+			CasesCum:               vartypes.IntPtr(22 + 44),
+			WasteHighestPlace:      vartypes.StringPtr("Κουκουβάουνες"),
+			WasteHighestPlaceEn:    vartypes.StringPtr("koukouvaounes"),
+			WasteHighestPercent:    vartypes.FloatPtr(0.69),
+		},
 	})
+	s.repoMock.EXPECT().MergeTimeline(gomock.Any()).Return(MergeResult{Inserted: 3}, nil)
 
 	assert.Nil(s.T(), s.srv.PopulateTimeline(ctx))
 }
@@ -181,12 +202,15 @@ func (s *DataServiceSuite) TestPopulateMunicipalities() {
 	ctx := context.Background()
 	s.repoMock.EXPECT().AddMunicipality(gomock.Any(), "Λιλιπούπολης").Return(50, nil)
 	s.repoMock.EXPECT().AddMunicipality(gomock.Any(), "Κουκουβάουνες").Return(60, nil)
-	s.repoMock.EXPECT().AddYearlyDeath(gomock.Any(), 50, 1, 2020)
-	s.repoMock.EXPECT().AddYearlyDeath(gomock.Any(), 50, 2, 2021)
-	s.repoMock.EXPECT().AddYearlyDeath(gomock.Any(), 50, 3, 2034)
-	s.repoMock.EXPECT().AddYearlyDeath(gomock.Any(), 60, 10, 2020)
-	s.repoMock.EXPECT().AddYearlyDeath(gomock.Any(), 60, 20, 2021)
-	s.repoMock.EXPECT().AddYearlyDeath(gomock.Any(), 60, 30, 2034)
+	s.repoMock.EXPECT().StageYearlyDeaths(gomock.Any(), []YearlyDeaths{
+		{MunId: 50, Deaths: vartypes.IntPtr(1), Year: 2020},
+		{MunId: 50, Deaths: vartypes.IntPtr(2), Year: 2021},
+		{MunId: 50, Deaths: vartypes.IntPtr(3), Year: 2034},
+		{MunId: 60, Deaths: vartypes.IntPtr(10), Year: 2020},
+		{MunId: 60, Deaths: vartypes.IntPtr(20), Year: 2021},
+		{MunId: 60, Deaths: vartypes.IntPtr(30), Year: 2034},
+	})
+	s.repoMock.EXPECT().MergeYearlyDeaths(gomock.Any()).Return(MergeResult{Inserted: 6}, nil)
 
 	assert.Nil(s.T(), s.srv.PopulateDeathsPerMunicipality(ctx))
 }
@@ -196,31 +220,737 @@ func (s *DataServiceSuite) TestPopulateDemographics() {
 	info1 := DemographicInfo{
 		Date:              time.Date(2020, 1, 25, 0, 0, 0, 0, time.UTC),
 		Category:          "0-17",
-		Cases:             1,
-		Deaths:            2,
-		Intensive:         3,
-		Discharged:        4,
-		Hospitalized:      5,
-		HospitalizedInIcu: 6,
-		PassedAway:        7,
-		Recovered:         8,
-		TreatedAtHome:     9,
+		Cases:             vartypes.IntPtr(1),
+		Deaths:            vartypes.IntPtr(2),
+		Intensive:         vartypes.IntPtr(3),
+		Discharged:        vartypes.IntPtr(4),
+		Hospitalized:      vartypes.IntPtr(5),
+		HospitalizedInIcu: vartypes.IntPtr(6),
+		PassedAway:        vartypes.IntPtr(7),
+		Recovered:         vartypes.IntPtr(8),
+		TreatedAtHome:     vartypes.IntPtr(9),
 	}
 	info2 := DemographicInfo{
 		Date:              time.Date(2020, 1, 26, 0, 0, 0, 0, time.UTC),
 		Category:          "18-39",
-		Cases:             10,
-		Deaths:            11,
-		Intensive:         12,
-		Discharged:        13,
-		Hospitalized:      14,
-		HospitalizedInIcu: 15,
-		PassedAway:        16,
-		Recovered:         17,
-		TreatedAtHome:     18,
+		Cases:             vartypes.IntPtr(10),
+		Deaths:            vartypes.IntPtr(11),
+		Intensive:         vartypes.IntPtr(12),
+		Discharged:        vartypes.IntPtr(13),
+		Hospitalized:      vartypes.IntPtr(14),
+		HospitalizedInIcu: vartypes.IntPtr(15),
+		PassedAway:        vartypes.IntPtr(16),
+		Recovered:         vartypes.IntPtr(17),
+		TreatedAtHome:     vartypes.IntPtr(18),
 	}
-	s.repoMock.EXPECT().AddDemographicInfo(gomock.Any(), info1)
-	s.repoMock.EXPECT().AddDemographicInfo(gomock.Any(), info2)
+	s.repoMock.EXPECT().StageDemographicInfo(gomock.Any(), []DemographicInfo{info1, info2})
+	s.repoMock.EXPECT().MergeDemographicInfo(gomock.Any()).Return(MergeResult{Inserted: 1, Updated: 1}, nil)
 
 	assert.Nil(s.T(), s.srv.PopulateDemographic(ctx))
 }
+
+// fingerprintOf returns the fingerprint of the contents of the source of a dataset
+func (s *DataServiceSuite) fingerprintOf(name string) file.Fingerprint {
+	tracked := file.Track(s.srv.source(name))
+	rc, err := tracked.Open(context.Background())
+	s.Require().Nil(err)
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	s.Require().Nil(err)
+	sum, err := tracked.Sha256()
+	s.Require().Nil(err)
+	return file.Fingerprint{Sha256: sum}
+}
+
+func (s *DataServiceSuite) TestPopulateEverythingSkipsUnchangedSources() {
+	ctx := context.Background()
+	for _, name := range []string{
+		DatasetCases,
+		DatasetTimeline,
+		DatasetDeathsPerMunicipality,
+		DatasetDemographics,
+		DatasetWaste,
+		DatasetVaccinations,
+	} {
+		fp := s.fingerprintOf(name)
+		s.repoMock.EXPECT().GetSourceState(gomock.Any(), name).Return(SourceState{Name: name, Fingerprint: fp}, nil)
+		s.repoMock.EXPECT().SaveSourceState(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, state SourceState) error {
+				assert.False(s.T(), state.SkippedAt.IsZero())
+				assert.True(s.T(), state.LoadedAt.IsZero())
+				return nil
+			})
+	}
+
+	s.repoMock.EXPECT().CreateIngestionRun(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, run *IngestionRun) error {
+			assert.Equal(s.T(), TriggerRefresh, run.Trigger)
+			run.Id = 7
+			return nil
+		})
+	s.repoMock.EXPECT().AddIngestionStep(gomock.Any(), gomock.Any()).Times(5).DoAndReturn(
+		func(_ context.Context, step *IngestionStep) error {
+			assert.Equal(s.T(), 7, step.RunId)
+			assert.Equal(s.T(), StatusSkipped, step.Status)
+			assert.NotEmpty(s.T(), step.SourceSha256)
+			return nil
+		})
+	s.repoMock.EXPECT().SyncHierarchy(gomock.Any()).Return(nil)
+	s.repoMock.EXPECT().FinishIngestionRun(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, run *IngestionRun) error {
+			assert.Equal(s.T(), StatusSucceeded, run.Status)
+			assert.NotNil(s.T(), run.FinishedAt)
+			return nil
+		})
+
+	s.srv.OnChange(func(datasets []string) {
+		s.T().Errorf("unexpected change of %v", datasets)
+	})
+
+	// no data is expected to be written, as nothing changed
+	res, err := s.srv.PopulateEverything(ctx, TriggerRefresh)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 7, res.RunId)
+	assert.Equal(s.T(), []string{DatasetCases, DatasetDeathsPerMunicipality, DatasetDemographics, DatasetTimeline,
+		DatasetVaccinations}, res.WithStatus(StatusSkipped))
+	assert.Empty(s.T(), res.Changed())
+}
+
+func (s *DataServiceSuite) TestPopulateEverythingIsolatesFailures() {
+	ctx := context.Background()
+	for _, name := range []string{DatasetCases, DatasetTimeline, DatasetWaste, DatasetVaccinations} {
+		fp := s.fingerprintOf(name)
+		s.repoMock.EXPECT().GetSourceState(gomock.Any(), name).Return(SourceState{Name: name, Fingerprint: fp}, nil)
+		s.repoMock.EXPECT().SaveSourceState(gomock.Any(), gomock.Any()).Return(nil)
+	}
+	for _, name := range []string{DatasetDeathsPerMunicipality, DatasetDemographics} {
+		s.repoMock.EXPECT().GetSourceState(gomock.Any(), name).Return(SourceState{}, fmt.Errorf("%s is down", name))
+	}
+
+	s.repoMock.EXPECT().CreateIngestionRun(gomock.Any(), gomock.Any()).Return(nil)
+	s.repoMock.EXPECT().AddIngestionStep(gomock.Any(), gomock.Any()).Times(5).Return(nil)
+	s.repoMock.EXPECT().SyncHierarchy(gomock.Any()).Return(nil)
+	s.repoMock.EXPECT().FinishIngestionRun(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, run *IngestionRun) error {
+			assert.Equal(s.T(), StatusFailed, run.Status)
+			assert.Contains(s.T(), run.Error, "demographics is down")
+			return nil
+		})
+
+	// the failed datasets do not keep the others from being checked
+	res, err := s.srv.PopulateEverything(ctx, TriggerSchedule)
+	assert.NotNil(s.T(), err)
+	assert.Equal(s.T(), []string{DatasetDeathsPerMunicipality, DatasetDemographics}, res.WithStatus(StatusFailed))
+	assert.Equal(s.T(), []string{DatasetCases, DatasetTimeline, DatasetVaccinations}, res.WithStatus(StatusSkipped))
+	assert.EqualError(s.T(), res.Err(), "2 of 5 datasets failed: deaths_per_municipality: deaths_per_municipality is down; "+
+		"demographics: demographics is down")
+}
+
+func (s *DataServiceSuite) TestPopulateIfChangedLoadsChangedSource() {
+	ctx := context.Background()
+	s.repoMock.EXPECT().GetSourceState(gomock.Any(), DatasetWaste).Return(SourceState{
+		Name:        DatasetWaste,
+		Fingerprint: file.Fingerprint{Sha256: "outdated"},
+	}, nil)
+	s.repoMock.EXPECT().SaveSourceState(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, state SourceState) error {
+			assert.Equal(s.T(), DatasetWaste, state.Name)
+			assert.Len(s.T(), state.Fingerprint.Sha256, 64)
+			assert.False(s.T(), state.LoadedAt.IsZero())
+			return nil
+		})
+
+	step := &IngestionStep{Dataset: DatasetWaste}
+	assert.Nil(s.T(), s.srv.populateIfChanged(ctx, step, func(ctx context.Context, repo Repo, stats *StepStats) error {
+		stats.RowsRead = 8
+		stats.merged(MergeResult{Inserted: 1})
+		return nil
+	}, DatasetWaste))
+	assert.Equal(s.T(), StatusSucceeded, step.Status)
+	assert.Equal(s.T(), 8, step.RowsRead)
+	assert.Equal(s.T(), 1, step.RowsInserted)
+	assert.Contains(s.T(), step.SourceUrl, "testing_waste.csv")
+}
+
+// changingSource serves a new version of a CSV file on every read, like a remote file updated between downloads
+type changingSource struct {
+	header, row string
+	reads       int
+}
+
+func (c *changingSource) Open(context.Context) (io.ReadCloser, error) {
+	c.reads++
+	return io.NopCloser(strings.NewReader(c.version(c.reads))), nil
+}
+
+func (c *changingSource) version(n int) string {
+	return c.header + "\n" + fmt.Sprintf(c.row, n) + "\n"
+}
+
+func (c *changingSource) String() string {
+	return "changing.csv"
+}
+
+func (s *DataServiceSuite) TestPopulateIfChangedFailsIfSourceChangesWhileLoaded() {
+	ctrl := gomock.NewController(s.T())
+	defer ctrl.Finish()
+	repo := NewRepoMock(ctrl)
+	src := &changingSource{header: "date,category,cases,deaths,intensive,DISCHARGED,HOSPITALIZED," +
+		"HOSPITALIZED_IN_ICU,PASSED_AWAY,RECOVERED,TREATED_AT_HOME", row: "2020-01-25,0-17,%d,2,3,4,5,6,7,8,9"}
+	mem := file.NewMemorySource("empty.csv", nil)
+	srv, err := NewService(repo, Sources{Cases: mem, Timeline: mem, DeathsPerMunicipality: mem, Demographics: src,
+		Waste: mem})
+	assert.Nil(s.T(), err)
+
+	repo.EXPECT().GetSourceState(gomock.Any(), DatasetDemographics).Return(SourceState{}, nil)
+	// the version loaded is not the one validated, so the transaction is rolled back and no fingerprint is stored
+	repo.ExpectTx()
+	repo.EXPECT().StageDemographicInfo(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, infos []DemographicInfo) error {
+			assert.Equal(s.T(), vartypes.IntPtr(2), infos[0].Cases)
+			return nil
+		})
+	repo.EXPECT().MergeDemographicInfo(gomock.Any()).Return(MergeResult{Inserted: 1}, nil)
+
+	step := &IngestionStep{Dataset: DatasetDemographics}
+	err = srv.populateIfChanged(context.Background(), step, srv.populateDemographic, DatasetDemographics)
+	assert.EqualError(s.T(), err, "changing.csv changed while it was read")
+	assert.Equal(s.T(), 2, src.reads)
+}
+
+func (s *DataServiceSuite) TestPopulateRollsBackOnError() {
+	ctrl := gomock.NewController(s.T())
+	defer ctrl.Finish()
+	repo := NewRepoMock(ctrl)
+	srv, err := NewService(repo, Sources{
+		Cases:                 file.NewMemorySource("cases", nil),
+		Timeline:              file.NewMemorySource("timeline", nil),
+		DeathsPerMunicipality: file.NewMemorySource("deaths", []byte("municipality,deaths_covid_2020\nΛιλιπούπολης,1\n")),
+		Demographics:          file.NewMemorySource("demographics", nil),
+		Waste:                 file.NewMemorySource("waste", nil),
+	})
+	assert.Nil(s.T(), err)
+
+	// the failure has to come back from the unit of work, so that the transaction is rolled back
+	var txErr error
+	repo.EXPECT().WithTx(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, fn func(repo Repo) error) error {
+			txErr = fn(repo)
+			return txErr
+		})
+	repo.EXPECT().AddMunicipality(gomock.Any(), "Λιλιπούπολης").Return(0, errors.New("boom"))
+
+	assert.NotNil(s.T(), srv.PopulateDeathsPerMunicipality(context.Background()))
+	assert.NotNil(s.T(), txErr)
+}
+
+// dailyCase is a record of cases reported daily
+func dailyCase(slug string, date time.Time, cases *int) CaseRecord {
+	return CaseRecord{
+		RegionalUnitSlug: slug,
+		Date:             date,
+		Cases:            cases,
+		PeriodStart:      date,
+		PeriodEnd:        date,
+		Cadence:          CadenceDaily,
+	}
+}
+
+// memoryService creates a service with its own mocked repository, reading the given CSV contents
+func (s *DataServiceSuite) memoryService(cases, timeline, deaths, demographics, waste string) (*Service, *RepoMock) {
+	ctrl := gomock.NewController(s.T())
+	s.T().Cleanup(ctrl.Finish)
+	repo := NewRepoMock(ctrl)
+	repo.ExpectTx().AnyTimes()
+	srv, err := NewService(repo, Sources{
+		Cases:                 file.NewMemorySource("cases", []byte(cases)),
+		Timeline:              file.NewMemorySource("timeline", []byte(timeline)),
+		DeathsPerMunicipality: file.NewMemorySource("deaths", []byte(deaths)),
+		Demographics:          file.NewMemorySource("demographics", []byte(demographics)),
+		Waste:                 file.NewMemorySource("waste", []byte(waste)),
+	})
+	assert.Nil(s.T(), err)
+	return srv, repo
+}
+
+const requiredTimelineRows = `deaths,1,2
+deaths_cum,1,2
+recovered,1,2
+hospital_admissions,1,2
+hospital_discharges,1,2
+intubated,1,2
+icu_occupancy,0.5,0.25
+beds_occupancy,1,2
+estimated_new_rtpcr_tests,1,2
+esitmated_new_rapid_tests,1,2
+estimated_new_total_tests,1,2
+`
+
+func (s *DataServiceSuite) TestPopulateTimelineMapsRowsByLabel() {
+	// rows are out of order, Status is not the first column and there is an extra row nobody knows about
+	timeline := "2/26/20,Status,2/27/20\n" +
+		"10,total cases,20\n" +
+		"3,brand_new_metric,4\n" +
+		"5,cases,6\n" +
+		"7,hospitalized,8\n" +
+		"1,deaths,2\n"
+	for _, r := range strings.Split(strings.TrimSpace(requiredTimelineRows), "\n")[1:] {
+		parts := strings.Split(r, ",")
+		timeline += parts[1] + "," + parts[0] + "," + parts[2] + "\n"
+	}
+	srv, repo := s.memoryService("", timeline, "", "", "week,place,place_en,percentage\n")
+
+	repo.EXPECT().GetQuarantinedValues(gomock.Any(), QuarantineFilter{Dataset: DatasetTimeline})
+	repo.EXPECT().GetWaste(gomock.Any(), WasteFilter{})
+	repo.EXPECT().StageTimeline(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, infos []FullInfo) error {
+			assert.Len(s.T(), infos, 2)
+			assert.Equal(s.T(), time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), infos[0].Date)
+			assert.Equal(s.T(), vartypes.IntPtr(5), infos[0].Cases)
+			assert.Equal(s.T(), vartypes.IntPtr(10), infos[0].CasesCum)
+			assert.Equal(s.T(), vartypes.IntPtr(1), infos[0].Deaths)
+			assert.Equal(s.T(), vartypes.FloatPtr(0.5), infos[0].IcuOccupancy)
+			assert.Equal(s.T(), vartypes.IntPtr(6), infos[1].Cases)
+			assert.Equal(s.T(), vartypes.IntPtr(20), infos[1].CasesCum)
+			assert.Equal(s.T(), vartypes.FloatPtr(0.25), infos[1].IcuOccupancy)
+			return nil
+		})
+	repo.EXPECT().MergeTimeline(gomock.Any()).Return(MergeResult{Inserted: 2}, nil)
+
+	assert.Nil(s.T(), srv.PopulateTimeline(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateTimelineQuarantinesSuspiciousValues() {
+	timeline := "Status,2/26/20,2/27/20\ncases,1,2\ntotal cases,10,20\n" +
+		strings.Replace(requiredTimelineRows, "icu_occupancy,0.5,0.25", "icu_occupancy,0.5,250", 1)
+	timeline = strings.Replace(timeline, "deaths_cum,1,2", "deaths_cum,5,4", 1)
+	srv, repo := s.memoryService("", timeline, "", "", "week,place,place_en,percentage\n")
+
+	feb27 := time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC)
+	// deaths_cum was already rejected, icu_occupancy is new
+	repo.EXPECT().GetQuarantinedValues(gomock.Any(), QuarantineFilter{Dataset: DatasetTimeline}).Return(
+		[]QuarantinedValue{{Id: 1, Dataset: DatasetTimeline, Date: feb27, Field: "deaths_cum", Value: 4,
+			Reason: "cumulative value decreased from 5", Status: QuarantineRejected}}, nil)
+	repo.EXPECT().GetWaste(gomock.Any(), WasteFilter{})
+	repo.EXPECT().GetFromTimeline(gomock.Any(), DatesFilter{}).Return([]FullInfo{
+		{Date: feb27, DeathsCum: vartypes.IntPtr(6), IcuOccupancy: vartypes.FloatPtr(0.3)},
+	}, nil)
+	repo.EXPECT().QuarantineValue(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, q *QuarantinedValue) error {
+			assert.Equal(s.T(), feb27, q.Date)
+			assert.Equal(s.T(), "icu_occupancy", q.Field)
+			assert.Equal(s.T(), float64(250), q.Value)
+			assert.Equal(s.T(), vartypes.FloatPtr(0.3), q.PublishedValue)
+			assert.Equal(s.T(), QuarantinePending, q.Status)
+			return nil
+		})
+	repo.EXPECT().StageTimeline(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, infos []FullInfo) error {
+			// the published values are kept
+			assert.Equal(s.T(), vartypes.IntPtr(6), infos[1].DeathsCum)
+			assert.Equal(s.T(), vartypes.FloatPtr(0.3), infos[1].IcuOccupancy)
+			assert.Equal(s.T(), vartypes.IntPtr(2), infos[1].Cases)
+			return nil
+		})
+	repo.EXPECT().MergeTimeline(gomock.Any()).Return(MergeResult{Updated: 1}, nil)
+
+	assert.Nil(s.T(), srv.PopulateTimeline(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateTimelineWithholdsSuspiciousValuesOfNewDates() {
+	timeline := "Status,2/26/20,2/27/20\ncases,1,2\ntotal cases,10,20\n" +
+		strings.Replace(requiredTimelineRows, "icu_occupancy,0.5,0.25", "icu_occupancy,0.5,250", 1)
+	timeline = strings.Replace(timeline, "deaths_cum,1,2", "deaths_cum,5,4", 1)
+	srv, repo := s.memoryService("", timeline, "", "", "week,place,place_en,percentage\n")
+
+	feb27 := time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC)
+	// deaths_cum was already rejected, icu_occupancy is new, and nothing is published for the new date yet
+	repo.EXPECT().GetQuarantinedValues(gomock.Any(), QuarantineFilter{Dataset: DatasetTimeline}).Return(
+		[]QuarantinedValue{{Id: 1, Dataset: DatasetTimeline, Date: feb27, Field: "deaths_cum", Value: 4,
+			Reason: "cumulative value decreased from 5", Status: QuarantineRejected}}, nil)
+	repo.EXPECT().GetWaste(gomock.Any(), WasteFilter{})
+	repo.EXPECT().GetFromTimeline(gomock.Any(), DatesFilter{}).Return([]FullInfo{
+		{Date: time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), DeathsCum: vartypes.IntPtr(5),
+			IcuOccupancy: vartypes.FloatPtr(0.5)},
+	}, nil)
+	repo.EXPECT().QuarantineValue(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, q *QuarantinedValue) error {
+			assert.Equal(s.T(), "icu_occupancy", q.Field)
+			assert.Nil(s.T(), q.PublishedValue)
+			assert.Equal(s.T(), QuarantinePending, q.Status)
+			return nil
+		})
+	repo.EXPECT().StageTimeline(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, infos []FullInfo) error {
+			// with nothing to fall back to, neither the new suspicious value nor the rejected one is served
+			assert.Nil(s.T(), infos[1].IcuOccupancy)
+			assert.Nil(s.T(), infos[1].DeathsCum)
+			assert.Equal(s.T(), vartypes.IntPtr(2), infos[1].Cases)
+			return nil
+		})
+	repo.EXPECT().MergeTimeline(gomock.Any()).Return(MergeResult{Inserted: 2}, nil)
+
+	assert.Nil(s.T(), srv.PopulateTimeline(context.Background()))
+}
+
+func (s *DataServiceSuite) TestResolveQuarantined() {
+	srv, repo := s.memoryService("", "", "", "", "")
+	feb27 := time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC)
+	pending := QuarantinedValue{Id: 3, Dataset: DatasetTimeline, Date: feb27, Field: "cases", Value: 5000,
+		PublishedValue: vartypes.FloatPtr(50), Status: QuarantinePending}
+
+	repo.EXPECT().GetQuarantinedValue(gomock.Any(), 3).Return(pending, nil)
+	repo.EXPECT().SetTimelineValue(gomock.Any(), feb27, "cases", vartypes.FloatPtr(5000))
+	repo.EXPECT().ResolveQuarantinedValue(gomock.Any(), 3, QuarantineApproved, gomock.Any())
+	q, err := srv.ResolveQuarantined(context.Background(), 3, true)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), QuarantineApproved, q.Status)
+	assert.NotNil(s.T(), q.ResolvedAt)
+
+	// rejecting does not touch the timeline
+	repo.EXPECT().GetQuarantinedValue(gomock.Any(), 3).Return(pending, nil)
+	repo.EXPECT().ResolveQuarantinedValue(gomock.Any(), 3, QuarantineRejected, gomock.Any())
+	q, err = srv.ResolveQuarantined(context.Background(), 3, false)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), QuarantineRejected, q.Status)
+
+	// a value with no published one is cleared
+	flagged := pending
+	flagged.PublishedValue = nil
+	repo.EXPECT().GetQuarantinedValue(gomock.Any(), 3).Return(flagged, nil)
+	repo.EXPECT().SetTimelineValue(gomock.Any(), feb27, "cases", nil)
+	repo.EXPECT().ResolveQuarantinedValue(gomock.Any(), 3, QuarantineRejected, gomock.Any())
+	_, err = srv.ResolveQuarantined(context.Background(), 3, false)
+	assert.Nil(s.T(), err)
+
+	pending.Status = QuarantineRejected
+	repo.EXPECT().GetQuarantinedValue(gomock.Any(), 3).Return(pending, nil)
+	_, err = srv.ResolveQuarantined(context.Background(), 3, true)
+	assert.ErrorIs(s.T(), err, ErrAlreadyResolved)
+}
+
+func (s *DataServiceSuite) TestPopulateTimelineFailsWithoutRequiredRow() {
+	timeline := "Status,2/26/20,2/27/20\ncases,1,2\n" + requiredTimelineRows
+	srv, _ := s.memoryService("", timeline, "", "", "week,place,place_en,percentage\n")
+
+	err := srv.PopulateTimeline(context.Background())
+	assert.NotNil(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "total cases")
+}
+
+func (s *DataServiceSuite) TestPopulateTimelineFailsWithoutStatusColumn() {
+	srv, _ := s.memoryService("", "Label,2/26/20\ncases,1\n", "", "", "")
+
+	err := srv.PopulateTimeline(context.Background())
+	assert.NotNil(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "Status")
+}
+
+func (s *DataServiceSuite) TestPopulateCasesMapsColumnsByHeader() {
+	cases := "county_normalized,2/26/20,pop_11,county,note,Περιφέρεια,Γεωγραφικό Διαμέρισμα,2/27/20\n" +
+		"County_1,1,10000,county_one,whatever,Prefecture_1,Department_1,2\n"
+	srv, repo := s.memoryService(cases, "", "", "", "")
+
+	repo.EXPECT().AddRegionalUnit(gomock.Any(), RegionalUnit{
+		Slug:                   "county_1",
+		Department:             "Department_1",
+		Prefecture:             "Prefecture_1",
+		RegionalUnitNormalized: "County_1",
+		RegionalUnit:           "county_one",
+		Pop11:                  10000,
+	})
+	repo.EXPECT().GetCadencePeriods(gomock.Any(), DatasetCases).Return(nil, nil)
+	repo.EXPECT().StageCases(gomock.Any(), []CaseRecord{
+		dailyCase("county_1", time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(1)),
+		dailyCase("county_1", time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(2)),
+	})
+	repo.EXPECT().MergeCases(gomock.Any()).Return(MergeResult{Inserted: 2}, nil)
+
+	assert.Nil(s.T(), srv.PopulateRegionalUnits(context.Background()))
+	assert.Nil(s.T(), srv.PopulateCases(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateCasesKeepsMissingValuesAsNil() {
+	cases := "Γεωγραφικό Διαμέρισμα,Περιφέρεια,county_normalized,county,pop_11,2/26/20,2/27/20,2/28/20\n" +
+		"Department_1,Prefecture_1,County_1,county_one,10000, ,0,3\n"
+	srv, repo := s.memoryService(cases, "", "", "", "")
+
+	repo.EXPECT().GetCadencePeriods(gomock.Any(), DatasetCases).Return(nil, nil)
+	repo.EXPECT().StageCases(gomock.Any(), []CaseRecord{
+		dailyCase("county_1", time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), nil),
+		dailyCase("county_1", time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(0)),
+		dailyCase("county_1", time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(3)),
+	})
+	repo.EXPECT().MergeCases(gomock.Any()).Return(MergeResult{Inserted: 3}, nil)
+
+	assert.Nil(s.T(), srv.PopulateCases(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateCasesFollowsCadences() {
+	cases := "Γεωγραφικό Διαμέρισμα,Περιφέρεια,county_normalized,county,pop_11,2/26/20,2/27/20,2/28/20,3/5/20\n" +
+		"Department_1,Prefecture_1,County_1,county_one,10000,1,20,0,30\n"
+	srv, repo := s.memoryService(cases, "", "", "", "")
+
+	repo.EXPECT().GetCadencePeriods(gomock.Any(), DatasetCases).Return([]CadencePeriod{
+		{Dataset: DatasetCases, Since: time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC), Cadence: CadenceWeekly},
+	}, nil)
+	// 2/28/20 is not a report date of the weekly cadence, so it is dropped
+	repo.EXPECT().StageCases(gomock.Any(), []CaseRecord{
+		dailyCase("county_1", time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC), vartypes.IntPtr(1)),
+		{
+			RegionalUnitSlug: "county_1",
+			Date:             time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC),
+			Cases:            vartypes.IntPtr(20),
+			PeriodStart:      time.Date(2020, 2, 21, 0, 0, 0, 0, time.UTC),
+			PeriodEnd:        time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC),
+			Cadence:          CadenceWeekly,
+		},
+		{
+			RegionalUnitSlug: "county_1",
+			Date:             time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC),
+			Cases:            vartypes.IntPtr(30),
+			PeriodStart:      time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC),
+			PeriodEnd:        time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC),
+			Cadence:          CadenceWeekly,
+		},
+	})
+	repo.EXPECT().MergeCases(gomock.Any()).Return(MergeResult{Inserted: 3}, nil)
+
+	assert.Nil(s.T(), srv.PopulateCases(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateCasesFailsWithoutRequiredColumn() {
+	cases := "Γεωγραφικό Διαμέρισμα,Περιφέρεια,county_normalized,county,2/26/20\n" +
+		"Department_1,Prefecture_1,County_1,county_one,1\n"
+	srv, _ := s.memoryService(cases, "", "", "", "")
+
+	err := srv.PopulateCases(context.Background())
+	assert.NotNil(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "pop_11")
+}
+
+func (s *DataServiceSuite) TestPopulateDemographicsMapsColumnsByHeader() {
+	demographics := "TREATED_AT_HOME,RECOVERED,PASSED_AWAY,HOSPITALIZED_IN_ICU,HOSPITALIZED,DISCHARGED,intensive," +
+		"deaths,cases,category,date\n" +
+		"9,8,7,6,5,4,3,2,1,0-17,2020-01-25\n"
+	srv, repo := s.memoryService("", "", "", demographics, "")
+
+	repo.EXPECT().StageDemographicInfo(gomock.Any(), []DemographicInfo{{
+		Date:              time.Date(2020, 1, 25, 0, 0, 0, 0, time.UTC),
+		Category:          "0-17",
+		Cases:             vartypes.IntPtr(1),
+		Deaths:            vartypes.IntPtr(2),
+		Intensive:         vartypes.IntPtr(3),
+		Discharged:        vartypes.IntPtr(4),
+		Hospitalized:      vartypes.IntPtr(5),
+		HospitalizedInIcu: vartypes.IntPtr(6),
+		PassedAway:        vartypes.IntPtr(7),
+		Recovered:         vartypes.IntPtr(8),
+		TreatedAtHome:     vartypes.IntPtr(9),
+	}})
+	repo.EXPECT().MergeDemographicInfo(gomock.Any()).Return(MergeResult{Inserted: 1}, nil)
+
+	assert.Nil(s.T(), srv.PopulateDemographic(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateWaste() {
+	waste := "week,area,area_en,pct_change_weekly_viral_load\n" +
+		"2022-3,Αθήνα,Athens,12%\n" +
+		"2022-3,Πάτρα,Patra,-4%\n" +
+		"2022-4,Αθήνα,Athens,3%\n"
+	srv, repo := s.memoryService("", "", "", "", waste)
+
+	repo.EXPECT().AddWasteSite(gomock.Any(), WasteSite{Name: "Αθήνα", NameEn: "Athens", Slug: "athena"}).
+		Return(true, nil)
+	repo.EXPECT().AddWasteSite(gomock.Any(), WasteSite{Name: "Πάτρα", NameEn: "Patra", Slug: "patra"}).
+		Return(true, nil)
+	// weeks are turned into dates of the local time zone
+	repo.EXPECT().StageWaste(gomock.Any(), []WasteMeasurement{{
+		Site: "Αθήνα", SiteEn: "Athens", Year: 2022, Week: 3, Percentage: 12,
+		WeekStart: time.Date(2022, 1, 17, 0, 0, 0, 0, time.Local),
+		WeekEnd:   time.Date(2022, 1, 23, 0, 0, 0, 0, time.Local),
+	}, {
+		Site: "Πάτρα", SiteEn: "Patra", Year: 2022, Week: 3, Percentage: -4,
+		WeekStart: time.Date(2022, 1, 17, 0, 0, 0, 0, time.Local),
+		WeekEnd:   time.Date(2022, 1, 23, 0, 0, 0, 0, time.Local),
+	}, {
+		Site: "Αθήνα", SiteEn: "Athens", Year: 2022, Week: 4, Percentage: 3,
+		WeekStart: time.Date(2022, 1, 24, 0, 0, 0, 0, time.Local),
+		WeekEnd:   time.Date(2022, 1, 30, 0, 0, 0, 0, time.Local),
+	}}).Return(nil)
+	repo.EXPECT().MergeWaste(gomock.Any()).Return(MergeResult{Inserted: 3}, nil)
+
+	assert.Nil(s.T(), srv.PopulateWaste(context.Background()))
+
+	// the timeline keeps the site with the highest change of every day, out of the stored measurements
+	repo.EXPECT().GetWaste(gomock.Any(), WasteFilter{}).Return([]WasteMeasurement{
+		{Site: "Αθήνα", SiteEn: "Athens", Year: 2022, Week: 3, Percentage: 12},
+		{Site: "Πάτρα", SiteEn: "Patra", Year: 2022, Week: 3, Percentage: -4},
+		{Site: "Αθήνα", SiteEn: "Athens", Year: 2022, Week: 4, Percentage: 3},
+	}, nil)
+	highest, err := getWasteDates(context.Background(), repo)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), highest, 14)
+	assert.Equal(s.T(), WasteInfo{Place: "Αθήνα", PlaceEn: "Athens", Percentage: 12}, highest["2022-01-17"])
+	assert.Equal(s.T(), WasteInfo{Place: "Αθήνα", PlaceEn: "Athens", Percentage: 3}, highest["2022-01-30"])
+}
+
+func (s *DataServiceSuite) TestPopulateVaccinations() {
+	day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+	// a row per regional unit, day and dose number, keeping missing doses as nil
+	s.repoMock.EXPECT().StageVaccinations(gomock.Any(), []VaccinationRecord{
+		{RegionalUnitSlug: "county_1", Date: day(1), Dose: 1, Doses: vartypes.IntPtr(10)},
+		{RegionalUnitSlug: "county_1", Date: day(1), Dose: 2, Doses: vartypes.IntPtr(0)},
+		{RegionalUnitSlug: "county_1", Date: day(1), Dose: 3, Doses: vartypes.IntPtr(0)},
+		{RegionalUnitSlug: "county_2", Date: day(1), Dose: 1, Doses: vartypes.IntPtr(20)},
+		{RegionalUnitSlug: "county_2", Date: day(1), Dose: 2, Doses: nil},
+		{RegionalUnitSlug: "county_2", Date: day(1), Dose: 3, Doses: vartypes.IntPtr(0)},
+		{RegionalUnitSlug: "county_1", Date: day(2), Dose: 1, Doses: vartypes.IntPtr(5)},
+		{RegionalUnitSlug: "county_1", Date: day(2), Dose: 2, Doses: vartypes.IntPtr(3)},
+		{RegionalUnitSlug: "county_1", Date: day(2), Dose: 3, Doses: vartypes.IntPtr(0)},
+		{RegionalUnitSlug: "county_2", Date: day(2), Dose: 1, Doses: vartypes.IntPtr(7)},
+		{RegionalUnitSlug: "county_2", Date: day(2), Dose: 2, Doses: vartypes.IntPtr(4)},
+		{RegionalUnitSlug: "county_2", Date: day(2), Dose: 3, Doses: vartypes.IntPtr(1)},
+	}).Return(nil)
+	s.repoMock.EXPECT().MergeVaccinations(gomock.Any()).Return(MergeResult{Inserted: 12}, nil)
+
+	assert.Nil(s.T(), s.srv.PopulateVaccinations(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateVaccinationsWithoutSource() {
+	// nothing is expected to be read or written
+	srv, _ := s.memoryService("", "", "", "", "")
+	assert.Nil(s.T(), srv.PopulateVaccinations(context.Background()))
+}
+
+func (s *DataServiceSuite) TestPopulateRegistryDatasets() {
+	defs, err := LoadRegistry("test_csv/testing_registry.yaml")
+	assert.Nil(s.T(), err)
+	srv, repo := s.memoryService("", "", "", "", "")
+	srv.RegisterDatasets(defs)
+
+	// every date column of a wide source makes a record
+	var records [][]interface{}
+	for i, county := range []string{"County_1", "County_2", "County_3"} {
+		for d := 0; d < 5; d++ {
+			date := time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC).AddDate(0, 0, d)
+			records = append(records, []interface{}{county, int64(10000 * (i + 1)), date, int64(5*i + d + 1)})
+		}
+	}
+	repo.EXPECT().EnsureDatasetTable(gomock.Any(), defs[0]).Return(nil)
+	repo.EXPECT().StageDatasetRows(gomock.Any(), defs[0], records).Return(nil)
+	repo.EXPECT().MergeDatasetRows(gomock.Any(), defs[0]).Return(MergeResult{Inserted: 15}, nil)
+	assert.Nil(s.T(), srv.PopulateDataset(context.Background(), "cases_per_county"))
+
+	// a row of a long source is a record, keeping empty optional values as nil
+	repo.EXPECT().EnsureDatasetTable(gomock.Any(), defs[1]).Return(nil)
+	repo.EXPECT().StageDatasetRows(gomock.Any(), defs[1], [][]interface{}{
+		{"County_1", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), int64(10), int64(0)},
+		{"County_2", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), int64(20), nil},
+		{"County_1", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), int64(5), int64(3)},
+		{"County_2", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), int64(7), int64(4)},
+	}).Return(nil)
+	repo.EXPECT().MergeDatasetRows(gomock.Any(), defs[1]).Return(MergeResult{Inserted: 4}, nil)
+	assert.Nil(s.T(), srv.PopulateDataset(context.Background(), "first_doses"))
+
+	assert.NotNil(s.T(), srv.PopulateDataset(context.Background(), "unknown"))
+}
+
+func (s *DataServiceSuite) TestPopulateRejectsSourceBreakingItsContract() {
+	// no repository call is expected, as the corrupted file must not reach the database
+	srv, _ := s.memoryService("", "", "municipality,deaths_covid_2020\nΛιλιπούπολης,lots\n", "", "")
+
+	err := srv.PopulateDeathsPerMunicipality(context.Background())
+	assert.NotNil(s.T(), err)
+	assert.Contains(s.T(), err.Error(), `row 2, column "deaths_covid_2020", value "lots": not an integer`)
+}
+
+func (s *DataServiceSuite) TestPopulateDoesNotStoreBadCellsAsZero() {
+	// the loaders do not count on the contract, e.g. when run without validating
+	srv, repo := s.memoryService("Γεωγραφικό Διαμέρισμα,Περιφέρεια,county_normalized,county,pop_11,2/26/20\n"+
+		"Department_1,Prefecture_1,County_1,county_one,many,1\n",
+		"", "municipality,deaths_covid_2020\nΛιλιπούπολης,lots\n", "", "")
+	repo.EXPECT().AddMunicipality(gomock.Any(), "Λιλιπούπολης").Return(50, nil)
+
+	err := srv.populateDeathsPerMunicipality(context.Background(), repo, &StepStats{})
+	assert.EqualError(s.T(), err, `bad deaths number at line 2, column deaths_covid_2020: "lots" is not a number`)
+	err = srv.populateRegionalUnits(context.Background(), repo, &StepStats{})
+	assert.ErrorContains(s.T(), err, "bad pop_11 at line 2")
+}
+
+func (s *DataServiceSuite) TestDryRunComparesSourcesWithDatabase() {
+	cases := "Γεωγραφικό Διαμέρισμα,Περιφέρεια,county_normalized,county,pop_11,2/26/20,2/27/20\n" +
+		"Department_1,Prefecture_1,County_1,county_one,10000,1,2\n" +
+		"Department_1,Prefecture_1,County_2,county_two,20000,3,4\n"
+	srv, repo := s.memoryService(cases, "", "", "", "")
+
+	// nothing but reads is expected, as a dry run must not write anything
+	repo.EXPECT().GetRegionalUnits(gomock.Any()).Return([]RegionalUnit{
+		{Id: 1, Slug: "county_1", RegionalUnitNormalized: "County_1"},
+	}, nil)
+	repo.EXPECT().GetCadencePeriods(gomock.Any(), DatasetCases).Return(nil, nil)
+	repo.EXPECT().GetCases(gomock.Any(), CasesFilter{}).Return([]Case{{
+		RegionalUnitId: 1,
+		Date:           time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC),
+		Cases:          vartypes.IntPtr(1),
+		PeriodStart:    time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:      time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC),
+		Cadence:        CadenceDaily,
+	}, {
+		RegionalUnitId: 1,
+		Date:           time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC),
+		Cases:          nil,
+		PeriodStart:    time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:      time.Date(2020, 2, 27, 0, 0, 0, 0, time.UTC),
+		Cadence:        CadenceDaily,
+	}}, nil)
+
+	report, err := srv.DryRun(context.Background(), Steps{RegionalUnits: true, Cases: true,
+		Registry: []string{"measles"}})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), []*TableDiff{
+		{Table: "regional_units", Existing: 1, New: 1, Unchanged: 1},
+		{Table: "cases_per_regional_unit", Existing: 2, New: 2, Changed: 1, Unchanged: 1, Samples: []ValueChange{
+			{Key: "county_1 2020-02-27", Column: "cases", Old: "null", New: "2"},
+		}},
+	}, report.Tables)
+	assert.Equal(s.T(), float64(50), report.Tables[1].ChangedPercent())
+	assert.Equal(s.T(), []string{"cases_per_regional_unit"}, report.Exceeds(10))
+	assert.Empty(s.T(), report.Exceeds(50))
+	// registry datasets are not compared, which the report tells
+	assert.Equal(s.T(), []string{"measles"}, report.Skipped)
+	assert.Contains(s.T(), report.String(), "skipped, as dry runs do not compare registry datasets: measles")
+}
+
+func (s *DataServiceSuite) TestDryRunComparesTimelineWithMergedWaste() {
+	timeline := "Status,2/24/20\ncases,1\ntotal cases,10\n" + strings.ReplaceAll(requiredTimelineRows, ",2\n", "\n")
+	timeline = strings.Replace(timeline, "icu_occupancy,0.5,0.25", "icu_occupancy,0.5", 1)
+	waste := "week,area,area_en,pct_change_weekly_viral_load\n2020-9,Πάτρα,patra,5%\n"
+	srv, repo := s.memoryService("", timeline, "", "", waste)
+
+	repo.EXPECT().GetWasteSites(gomock.Any()).Return([]WasteSite{{Id: 1, Name: "Πάτρα"}, {Id: 2, Name: "Χανιά"}}, nil)
+	repo.EXPECT().GetWaste(gomock.Any(), WasteFilter{}).Return([]WasteMeasurement{
+		{SiteId: 1, Site: "Πάτρα", SiteEn: "patra", Year: 2020, Week: 9, Percentage: 1},
+		{SiteId: 2, Site: "Χανιά", SiteEn: "xania", Year: 2020, Week: 9, Percentage: 3},
+	}, nil)
+	repo.EXPECT().GetQuarantinedValues(gomock.Any(), QuarantineFilter{Dataset: DatasetTimeline})
+	one := vartypes.IntPtr(1)
+	repo.EXPECT().GetFromTimeline(gomock.Any(), DatesFilter{}).Return([]FullInfo{{
+		Date: time.Date(2020, 2, 24, 0, 0, 0, 0, time.UTC), Cases: one, CasesCum: vartypes.IntPtr(10), Deaths: one,
+		DeathsCum: one, Recovered: one, HospitalAdmissions: one, HospitalDischarges: one, Intubated: one,
+		IcuOccupancy: vartypes.FloatPtr(0.5), BedsOccupancy: vartypes.FloatPtr(1), EstimatedNewRtpcrTests: one,
+		EstimatedNewRapidTests: one, EstimatedNewTotalTests: one, WasteHighestPlace: vartypes.StringPtr("Χανιά"),
+		WasteHighestPlaceEn: vartypes.StringPtr("xania"), WasteHighestPercent: vartypes.FloatPtr(3),
+	}}, nil).AnyTimes()
+
+	report, err := srv.DryRun(context.Background(), Steps{Waste: true, Timeline: true})
+	assert.Nil(s.T(), err)
+	// the timeline gets the highest measurement as it would be after merging the waste, not the stored one
+	assert.Equal(s.T(), "greece_timeline", report.Tables[2].Table)
+	assert.Equal(s.T(), 1, report.Tables[2].Changed)
+	assert.Equal(s.T(), []ValueChange{
+		{Key: "2020-02-24", Column: "waste_highest_place", Old: "Χανιά", New: "Πάτρα"},
+		{Key: "2020-02-24", Column: "waste_highest_percentage", Old: "3", New: "5"},
+		{Key: "2020-02-24", Column: "waste_highest_place_en", Old: "xania", New: "patra"},
+	}, report.Tables[2].Samples)
+}
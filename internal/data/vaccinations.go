@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gosimple/slug"
+
+	"covid19-greece-api/pkg/file"
+	"covid19-greece-api/pkg/vartypes"
+)
+
+// Vaccinations are the doses given every day per regional unit, by dose number, in the format of data.gov.gr:
+// a row per regional unit and day, with a column of daily doses per dose number. National doses are the sum of the
+// regional units, so only the latter are stored.
+
+// vaccinationDoses are the dose numbers the source may report
+const vaccinationDoses = 4
+
+// VaccinationRecord is a row of vaccinations, as read from the source. Regional units are identified by slug.
+type VaccinationRecord struct {
+	RegionalUnitSlug string
+	Date             time.Time
+	Dose             int
+	Doses            *int
+}
+
+// Vaccination are the doses of a dose number given at a date. RegionalUnitId is nil for national doses, and Doses
+// is nil when no regional unit reported them.
+type Vaccination struct {
+	RegionalUnitId *int      `json:"regional_unit_id"`
+	Date           time.Time `json:"date"`
+	Dose           int       `json:"dose"`
+	Doses          *int      `json:"doses"`
+}
+
+type VaccinationsFilter struct {
+	DatesFilter
+	RegionalUnitId int
+	// National sums the doses of all regional units per date and dose number
+	National bool
+}
+
+func (s *Service) PopulateVaccinations(ctx context.Context) error {
+	if s.vaccinationsSrc == nil {
+		log.Printf("skipping %s, no source is configured", DatasetVaccinations)
+		return nil
+	}
+	return s.populateInTx(ctx, s.populateVaccinations, DatasetVaccinations)
+}
+
+// populateVaccinations stages a row per regional unit, day and dose number of the source. Dose numbers the source
+// has no columns for are left out.
+func (s *Service) populateVaccinations(ctx context.Context, repo Repo, stats *StepStats) error {
+	rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, DatasetVaccinations))
+	if err != nil {
+		return fmt.Errorf("error reading csv file: %s", err)
+	}
+	defer rows.Close()
+
+	headers, err := readHeaders(rows)
+	if err != nil {
+		return err
+	}
+	cols, err := vaccinationsLayout.mapColumns(headers)
+	if err != nil {
+		return err
+	}
+
+	var batch []VaccinationRecord
+	for rows.Next() {
+		row := rows.Row()
+		stats.RowsRead++
+		d, err := time.Parse(simpleDateLayout, cols.value(row, "date"))
+		if err != nil {
+			return fmt.Errorf("bad date at line %d: %s", rows.Line(), err)
+		}
+		sl := slug.Make(cols.value(row, "area"))
+		for dose := 1; dose <= vaccinationDoses; dose++ {
+			name := "dose" + strconv.Itoa(dose)
+			if _, ok := cols.index[name]; !ok {
+				continue
+			}
+			amount, err := vartypes.ParseNullableInt(cols.value(row, name))
+			if err != nil {
+				return fmt.Errorf("bad doses number at line %d, column %s: %s", rows.Line(), name, err)
+			}
+			batch = append(batch, VaccinationRecord{RegionalUnitSlug: sl, Date: d, Dose: dose, Doses: amount})
+		}
+		if len(batch) >= StageBatchSize {
+			if err := repo.StageVaccinations(ctx, batch); err != nil {
+				return fmt.Errorf("error adding vaccinations: %s", err)
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %s", err)
+	}
+	if err := repo.StageVaccinations(ctx, batch); err != nil {
+		return fmt.Errorf("error adding vaccinations: %s", err)
+	}
+	res, err := repo.MergeVaccinations(ctx)
+	if err != nil {
+		return fmt.Errorf("error adding vaccinations: %s", err)
+	}
+	stats.merged(res)
+
+	log.Printf("added vaccinations of %d rows", stats.RowsRead)
+
+	return nil
+}
+
+func (r *PgRepo) StageVaccinations(ctx context.Context, records []VaccinationRecord) error {
+	return r.stage(ctx, "staging_vaccinations", []string{"regional_unit_slug", "date", "dose", "doses"},
+		len(records), func(i int) []interface{} {
+			v := records[i]
+			return []interface{}{v.RegionalUnitSlug, v.Date, v.Dose, v.Doses}
+		})
+}
+
+// MergeVaccinations merges the staged vaccinations. Rows of unknown regional units are dropped.
+func (r *PgRepo) MergeVaccinations(ctx context.Context) (MergeResult, error) {
+	selectSql := `SELECT DISTINCT ON (ru.id, s.date, s.dose) ru.id AS regional_unit_id, s.date, s.dose, s.doses
+	              FROM staging_vaccinations s JOIN regional_units ru ON ru.slug = s.regional_unit_slug
+	              ORDER BY ru.id, s.date, s.dose, s.id DESC`
+	return r.merge(ctx, "staging_vaccinations", mergeSql(DatasetVaccinations, "vaccinations",
+		[]string{"regional_unit_id", "date", "dose"}, []string{"doses"}, selectSql))
+}
+
+// GetVaccinations returns the doses by date, regional unit and dose number. National doses are nil only if no
+// regional unit reported them.
+func (r *PgRepo) GetVaccinations(ctx context.Context, filter VaccinationsFilter) ([]Vaccination, error) {
+	sql := `SELECT regional_unit_id,date,dose,doses FROM vaccinations WHERE 1=1 `
+	if filter.National {
+		sql = `SELECT NULL::integer,date,dose,SUM(doses)::integer FROM vaccinations WHERE 1=1 `
+	}
+	counter := 1
+	var args []interface{}
+
+	if filter.RegionalUnitId > 0 {
+		sql += fmt.Sprintf(" AND regional_unit_id=$%d ", counter)
+		counter++
+		args = append(args, filter.RegionalUnitId)
+	}
+
+	if !filter.StartDate.IsZero() {
+		sql += fmt.Sprintf(" AND date >= $%d ", counter)
+		counter++
+		args = append(args, filter.StartDate)
+	}
+
+	if !filter.EndDate.IsZero() {
+		sql += fmt.Sprintf(" AND date <= $%d ", counter)
+		counter++
+		args = append(args, filter.EndDate)
+	}
+
+	sql += asOfSql(filter.AsOf, &counter, &args)
+	if filter.National {
+		sql += " GROUP BY date, dose ORDER BY date, dose "
+	} else {
+		sql += " ORDER BY date, regional_unit_id, dose "
+	}
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get vaccinations: %s", err)
+	}
+	defer rows.Close()
+
+	var res []Vaccination
+	for rows.Next() {
+		var v Vaccination
+		if err := rows.Scan(&v.RegionalUnitId, &v.Date, &v.Dose, &v.Doses); err != nil {
+			return nil, fmt.Errorf("cannot scan vaccination: %s", err)
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
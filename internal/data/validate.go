@@ -0,0 +1,297 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"covid19-greece-api/pkg/file"
+)
+
+// maxViolations is the number of violations kept in a validation report. The rest are only counted.
+const maxViolations = 1000
+
+// valueKind is the type of the values of a column
+type valueKind int
+
+const (
+	kindText valueKind = iota
+	kindInt
+	kindFloat
+	kindPercent  // a number, optionally followed by %
+	kindDate     // a date in the format of the rule
+	kindYearWeek // an ISO week, like 2021-7
+)
+
+// cellRule is the contract of the values of a column. The zero rule accepts any non-empty text.
+type cellRule struct {
+	kind     valueKind
+	optional bool     // empty values are allowed
+	min, max *float64 // allowed range of numbers
+	format   string   // layout of dates
+}
+
+// bound is a shorthand for range limits of cell rules
+func bound(v float64) *float64 {
+	return &v
+}
+
+// check returns why value breaks the rule, or an empty string if it does not
+func (r cellRule) check(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		if r.optional {
+			return ""
+		}
+		return "value is required"
+	}
+
+	var n float64
+	var err error
+	switch r.kind {
+	case kindText:
+		return ""
+	case kindInt:
+		n, err = strconv.ParseFloat(value, 64)
+		if err != nil || n != math.Trunc(n) {
+			return "not an integer"
+		}
+	case kindFloat:
+		if n, err = strconv.ParseFloat(value, 64); err != nil {
+			return "not a number"
+		}
+	case kindPercent:
+		if n, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err != nil {
+			return "not a percentage"
+		}
+	case kindDate:
+		if _, err := time.Parse(r.format, value); err != nil {
+			return fmt.Sprintf("not a date formatted as %s", r.format)
+		}
+		return ""
+	case kindYearWeek:
+		if _, err := ParseYearWeek(value); err != nil {
+			return "not a year-week"
+		}
+		return ""
+	}
+
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return "not a finite number"
+	}
+	if r.min != nil && n < *r.min {
+		return fmt.Sprintf("less than %v", *r.min)
+	}
+	if r.max != nil && n > *r.max {
+		return fmt.Sprintf("greater than %v", *r.max)
+	}
+	return ""
+}
+
+// Violation is a breach of the contract of a source. Row is the 1-based record of the file, counting the header,
+// or 0 for violations of the file as a whole.
+type Violation struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	s := fmt.Sprintf("row %d", v.Row)
+	if len(v.Column) > 0 {
+		s += fmt.Sprintf(", column %q", v.Column)
+	}
+	if len(v.Value) > 0 {
+		s += fmt.Sprintf(", value %q", v.Value)
+	}
+	return s + ": " + v.Message
+}
+
+// ValidationReport lists how a source breaks its contract. Warnings, like unknown columns, do not make it invalid.
+type ValidationReport struct {
+	Dataset string `json:"dataset"`
+	Source  string `json:"source"`
+	Rows    int    `json:"rows"`
+	// ViolationCount may be larger than len(Violations), as only the first ones are kept
+	ViolationCount int         `json:"violation_count"`
+	Violations     []Violation `json:"violations"`
+	Warnings       []Violation `json:"warnings"`
+}
+
+// Valid reports whether the source satisfies its contract
+func (r *ValidationReport) Valid() bool {
+	return r.ViolationCount == 0
+}
+
+func (r *ValidationReport) violation(row int, column, value, message string) {
+	r.ViolationCount++
+	if len(r.Violations) < maxViolations {
+		r.Violations = append(r.Violations, Violation{Row: row, Column: column, Value: value, Message: message})
+	}
+}
+
+func (r *ValidationReport) warning(row int, column, value, message string) {
+	if len(r.Warnings) < maxViolations {
+		r.Warnings = append(r.Warnings, Violation{Row: row, Column: column, Value: value, Message: message})
+	}
+}
+
+// Err summarizes the report as an error, or returns nil if the source is valid
+func (r *ValidationReport) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return fmt.Errorf("%s source %s breaks its contract with %d violations, first: %s",
+		r.Dataset, r.Source, r.ViolationCount, r.Violations[0])
+}
+
+func (r *ValidationReport) String() string {
+	var b strings.Builder
+	status := "valid"
+	if !r.Valid() {
+		status = fmt.Sprintf("INVALID, %d violations", r.ViolationCount)
+	}
+	fmt.Fprintf(&b, "%s (%s): %d rows, %s\n", r.Dataset, r.Source, r.Rows, status)
+	for _, v := range r.Violations {
+		fmt.Fprintf(&b, "  ERROR   %s\n", v)
+	}
+	if r.ViolationCount > len(r.Violations) {
+		fmt.Fprintf(&b, "  ... and %d more violations\n", r.ViolationCount-len(r.Violations))
+	}
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&b, "  WARNING %s\n", w)
+	}
+	return b.String()
+}
+
+// ValidateSource checks the contents of a dataset's source against the contract of the dataset. Errors are returned
+// only if the source cannot be read at all; anything wrong with its contents ends up in the report.
+func ValidateSource(ctx context.Context, dataset string, src file.Source) (*ValidationReport, error) {
+	layout, ok := layouts[dataset]
+	if !ok {
+		return nil, fmt.Errorf("unknown dataset %s", dataset)
+	}
+	return validateSource(ctx, layout, src)
+}
+
+// validateSource checks the contents of a source against a layout
+func validateSource(ctx context.Context, layout csvLayout, src file.Source) (*ValidationReport, error) {
+	report := &ValidationReport{Dataset: layout.name, Source: src.String()}
+
+	rows, err := file.OpenCsv(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			report.violation(1, "", "", err.Error())
+		} else {
+			report.violation(1, "", "", "file is empty")
+		}
+		return report, nil
+	}
+	headers := rows.Row()
+	cols := layout.locate(headers)
+	for _, h := range cols.missing {
+		report.violation(1, h, "", "required column is missing")
+	}
+	for _, h := range cols.duplicates {
+		report.violation(1, h, "", "column appears more than once")
+	}
+	for _, h := range cols.unknown {
+		report.warning(1, h, "", "unknown column, it is ignored")
+	}
+	if layout.series != nil && len(cols.dates) == 0 {
+		report.violation(1, "", "", "there are no date or year columns")
+	}
+
+	byStatus := layout.byStatus && len(cols.missing) == 0
+	byLabel := timelineRowsByLabel()
+	seen := make(map[*timelineRow]bool)
+	for rows.Next() {
+		row := rows.Row()
+		line := rows.Line()
+		report.Rows++
+
+		for _, c := range layout.columns {
+			i, ok := cols.index[c.name]
+			if !ok {
+				continue
+			}
+			if msg := c.rule.check(row[i]); len(msg) > 0 {
+				report.violation(line, headers[i], row[i], msg)
+			}
+		}
+
+		seriesRule := layout.seriesRule
+		if byStatus {
+			status := headers[cols.index["status"]]
+			label := normalizeLabel(cols.value(row, "status"))
+			tr, ok := byLabel[label]
+			switch {
+			case ok && seen[tr]:
+				report.violation(line, status, label, "row appears more than once")
+			case ok:
+				seen[tr] = true
+				seriesRule = tr.rule
+			case !isIgnoredTimelineLabel(label):
+				report.warning(line, status, label, "unknown row, it is ignored")
+			}
+		}
+		for _, dc := range cols.dates {
+			if msg := seriesRule.check(row[dc.index]); len(msg) > 0 {
+				report.violation(line, dc.header, row[dc.index], msg)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		report.violation(rows.Line()+1, "", "", err.Error())
+	}
+	if byStatus {
+		for _, label := range missingTimelineRows(seen) {
+			report.violation(0, "", label, "required row is missing")
+		}
+	}
+
+	return report, nil
+}
+
+// ValidateSources validates the sources of all datasets, including those of a registry. Optional sources that are
+// not set are skipped.
+func ValidateSources(ctx context.Context, sources Sources, registry []DatasetDefinition) ([]*ValidationReport, error) {
+	var reports []*ValidationReport
+	for _, ds := range []struct {
+		name string
+		src  file.Source
+	}{
+		{DatasetCases, sources.Cases},
+		{DatasetTimeline, sources.Timeline},
+		{DatasetDeathsPerMunicipality, sources.DeathsPerMunicipality},
+		{DatasetDemographics, sources.Demographics},
+		{DatasetWaste, sources.Waste},
+		{DatasetVaccinations, sources.Vaccinations},
+	} {
+		if ds.src == nil {
+			continue
+		}
+		report, err := ValidateSource(ctx, ds.name, ds.src)
+		if err != nil {
+			return reports, fmt.Errorf("cannot validate %s: %s", ds.name, err)
+		}
+		reports = append(reports, report)
+	}
+	for _, def := range registry {
+		report, err := validateSource(ctx, def.layout(), def.src)
+		if err != nil {
+			return reports, fmt.Errorf("cannot validate %s: %s", def.Name, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
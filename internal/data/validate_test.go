@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"covid19-greece-api/pkg/file"
+)
+
+func TestCellRuleCheck(t *testing.T) {
+	tests := []struct {
+		rule  cellRule
+		value string
+		ok    bool
+	}{
+		{cellRule{}, "anything", true},
+		{cellRule{}, "", false},
+		{cellRule{optional: true}, " ", true},
+		{cellRule{kind: kindInt}, "12", true},
+		{cellRule{kind: kindInt}, "12.0", true},
+		{cellRule{kind: kindInt}, "12.5", false},
+		{cellRule{kind: kindInt}, "twelve", false},
+		{cellRule{kind: kindInt, min: bound(0)}, "-1", false},
+		{cellRule{kind: kindFloat, max: bound(100)}, "100.5", false},
+		{cellRule{kind: kindFloat}, "NaN", false},
+		{cellRule{kind: kindPercent}, "-34%", true},
+		{cellRule{kind: kindPercent}, "0.69", true},
+		{cellRule{kind: kindPercent}, "%", false},
+		{cellRule{kind: kindDate, format: simpleDateLayout}, "2020-01-25", true},
+		{cellRule{kind: kindDate, format: simpleDateLayout}, "25/01/2020", false},
+		{cellRule{kind: kindYearWeek}, "2020-9", true},
+		{cellRule{kind: kindYearWeek}, "2020-54", false},
+		{cellRule{kind: kindYearWeek}, "2020", false},
+	}
+	for _, tt := range tests {
+		msg := tt.rule.check(tt.value)
+		assert.Equal(t, tt.ok, len(msg) == 0, "value %q: %s", tt.value, msg)
+	}
+}
+
+func TestValidateTestFiles(t *testing.T) {
+	reports, err := ValidateSources(context.Background(), Sources{
+		Cases:                 file.NewLocalSource("test_csv/testing_cases.csv"),
+		Timeline:              file.NewLocalSource("test_csv/testing_timeline.csv"),
+		DeathsPerMunicipality: file.NewLocalSource("test_csv/testing_deaths.csv"),
+		Demographics:          file.NewLocalSource("test_csv/testing_demographics.csv"),
+		Waste:                 file.NewLocalSource("test_csv/testing_waste.csv"),
+	}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, reports, 5)
+	for _, r := range reports {
+		assert.True(t, r.Valid(), r.String())
+		assert.Empty(t, r.Warnings, r.String())
+	}
+}
+
+func TestValidateSourceReportsRowAndColumn(t *testing.T) {
+	csv := "municipality,deaths_covid_2020,deaths_covid_2021,notes\n" +
+		"Λιλιπούπολης,1,oops,\n" +
+		",2,-3,\n"
+	report, err := ValidateSource(context.Background(), DatasetDeathsPerMunicipality,
+		file.NewMemorySource("deaths", []byte(csv)))
+	assert.Nil(t, err)
+	assert.False(t, report.Valid())
+	assert.Equal(t, 2, report.Rows)
+	assert.Equal(t, []Violation{
+		{Row: 2, Column: "deaths_covid_2021", Value: "oops", Message: "not an integer"},
+		{Row: 3, Column: "municipality", Value: "", Message: "value is required"},
+		{Row: 3, Column: "deaths_covid_2021", Value: "-3", Message: "less than 0"},
+	}, report.Violations)
+	assert.Equal(t, []Violation{
+		{Row: 1, Column: "notes", Message: "unknown column, it is ignored"},
+	}, report.Warnings)
+	assert.NotNil(t, report.Err())
+}
+
+func TestValidateSourceReportsMalformedCsv(t *testing.T) {
+	csv := "week,area,area_en,pct_change_weekly_viral_load\n2020-9,Πάτρα,patra,-34%\n2020-9,Πάτρα\n"
+	report, err := ValidateSource(context.Background(), DatasetWaste, file.NewMemorySource("waste", []byte(csv)))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.ViolationCount)
+	assert.Equal(t, 3, report.Violations[0].Row)
+}
+
+func TestValidateSourceCapsViolations(t *testing.T) {
+	csv := "municipality,deaths_covid_2020\n"
+	for i := 0; i < maxViolations+10; i++ {
+		csv += "Λιλιπούπολης,bad\n"
+	}
+	report, err := ValidateSource(context.Background(), DatasetDeathsPerMunicipality,
+		file.NewMemorySource("deaths", []byte(csv)))
+	assert.Nil(t, err)
+	assert.Equal(t, maxViolations+10, report.ViolationCount)
+	assert.Len(t, report.Violations, maxViolations)
+}
@@ -0,0 +1,288 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+
+	"covid19-greece-api/pkg/date"
+	"covid19-greece-api/pkg/file"
+	"covid19-greece-api/pkg/vartypes"
+)
+
+// Wastewater is measured weekly at a number of sites. Every measurement is the change of the viral load of a site
+// during an ISO week, compared with the week before it.
+
+// WasteSite is a place whose wastewater is measured.
+type WasteSite struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	NameEn string `json:"name_en"`
+	Slug   string `json:"slug"`
+}
+
+// WasteMeasurement is the weekly change of the viral load at a site, as a percentage. When staged, the site is
+// identified by its name alone.
+type WasteMeasurement struct {
+	SiteId     int       `json:"site_id"`
+	Site       string    `json:"site"`
+	SiteEn     string    `json:"site_en"`
+	Year       int       `json:"year"`
+	Week       int       `json:"week"`
+	WeekStart  time.Time `json:"week_start"`
+	WeekEnd    time.Time `json:"week_end"`
+	Percentage float64   `json:"percentage"`
+}
+
+// YearWeek is an ISO week of a year.
+type YearWeek struct {
+	Year int
+	Week int
+}
+
+func (yw YearWeek) IsZero() bool {
+	return yw.Year == 0 && yw.Week == 0
+}
+
+// ParseYearWeek parses an ISO week like 2021-7.
+func ParseYearWeek(s string) (YearWeek, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return YearWeek{}, fmt.Errorf("%q is not a year-week", s)
+	}
+	year, yErr := strconv.Atoi(parts[0])
+	week, wErr := strconv.Atoi(parts[1])
+	if yErr != nil || wErr != nil || year < 2000 || week < 1 || week > 53 {
+		return YearWeek{}, fmt.Errorf("%q is not a year-week", s)
+	}
+	return YearWeek{Year: year, Week: week}, nil
+}
+
+type WasteFilter struct {
+	DatesFilter
+	SiteId int
+	// Site is the slug of a site
+	Site      string
+	StartWeek YearWeek
+	EndWeek   YearWeek
+}
+
+// WasteInfo is the site with the highest change of the viral load at a date.
+type WasteInfo struct {
+	Place      string
+	PlaceEn    string
+	Percentage float64
+}
+
+// getWasteDates returns the site with the highest change of the viral load at every date of the measured weeks,
+// by date, out of the stored measurements.
+func getWasteDates(ctx context.Context, repo Repo) (map[string]WasteInfo, error) {
+	measurements, err := repo.GetWaste(ctx, WasteFilter{})
+	if err != nil {
+		return nil, err
+	}
+	return highestWaste(measurements), nil
+}
+
+// highestWaste finds the site with the highest change at every date of the weeks measured. Of sites with the same
+// change, the first one is kept, which is the first by name for stored measurements.
+func highestWaste(measurements []WasteMeasurement) map[string]WasteInfo {
+	res := make(map[string]WasteInfo)
+	for _, m := range measurements {
+		for _, d := range date.WeekToDateRange(m.Year, m.Week) {
+			key := d.Format(simpleDateLayout)
+			if highest, ok := res[key]; ok && highest.Percentage >= m.Percentage {
+				continue
+			}
+			res[key] = WasteInfo{Place: m.Site, PlaceEn: m.SiteEn, Percentage: m.Percentage}
+		}
+	}
+	return res
+}
+
+// readWaste reads all measurements of the waste source, in the order of the file
+func (s *Service) readWaste(ctx context.Context) ([]WasteMeasurement, error) {
+	rows, err := file.OpenCsv(ctx, s.sourceOf(ctx, DatasetWaste))
+	if err != nil {
+		return nil, fmt.Errorf("error reading csv file: %s", err)
+	}
+	defer rows.Close()
+
+	headers, err := readHeaders(rows)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := wasteLayout.mapColumns(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []WasteMeasurement
+	for rows.Next() {
+		i, line := rows.Line()-1, rows.Row()
+		yw, err := ParseYearWeek(cols.value(line, "week"))
+		if err != nil {
+			return nil, fmt.Errorf("error at line %d. Bad week column: %s", i, err)
+		}
+		dates := date.WeekToDateRange(yw.Year, yw.Week)
+		res = append(res, WasteMeasurement{
+			Site:       cols.value(line, "place"),
+			SiteEn:     cols.value(line, "place_en"),
+			Year:       yw.Year,
+			Week:       yw.Week,
+			WeekStart:  dates[0],
+			WeekEnd:    dates[len(dates)-1],
+			Percentage: vartypes.StringToFloat(strings.TrimRight(cols.value(line, "percentage"), "%")),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading csv file: %s", err)
+	}
+	return res, nil
+}
+
+func (s *Service) PopulateWaste(ctx context.Context) error {
+	return s.populateInTx(ctx, s.populateWaste, DatasetWaste)
+}
+
+func (s *Service) populateWaste(ctx context.Context, repo Repo, stats *StepStats) error {
+	measurements, err := s.readWaste(ctx)
+	if err != nil {
+		return err
+	}
+	stats.RowsRead += len(measurements)
+
+	sites := make(map[string]bool)
+	for _, m := range measurements {
+		if sites[m.Site] {
+			continue
+		}
+		sites[m.Site] = true
+		if _, err := repo.AddWasteSite(ctx, WasteSite{Name: m.Site, NameEn: m.SiteEn, Slug: slug.Make(m.Site)}); err != nil {
+			return fmt.Errorf("cannot add waste site: %s", err)
+		}
+	}
+
+	// the waste file is small, so it is staged in one go
+	if err := repo.StageWaste(ctx, measurements); err != nil {
+		return fmt.Errorf("cannot add waste measurements: %s", err)
+	}
+	res, err := repo.MergeWaste(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot add waste measurements: %s", err)
+	}
+	stats.merged(res)
+
+	log.Printf("added %d waste measurements of %d sites", len(measurements), len(sites))
+
+	return nil
+}
+
+// AddWasteSite adds a site, unless a site with the same name exists.
+func (r *PgRepo) AddWasteSite(ctx context.Context, site WasteSite) (bool, error) {
+	sql := `INSERT INTO waste_sites (name, name_en, slug) VALUES ($1, $2, $3) ON CONFLICT (name) DO NOTHING`
+	tag, err := r.conn.Exec(ctx, sql, site.Name, site.NameEn, site.Slug)
+	if err != nil {
+		return false, fmt.Errorf("could not insert waste_sites row: %s", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgRepo) GetWasteSites(ctx context.Context) ([]WasteSite, error) {
+	rows, err := r.conn.Query(ctx, `SELECT id,name,name_en,slug FROM waste_sites ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get waste sites: %s", err)
+	}
+	defer rows.Close()
+
+	var res []WasteSite
+	for rows.Next() {
+		var site WasteSite
+		if err := rows.Scan(&site.Id, &site.Name, &site.NameEn, &site.Slug); err != nil {
+			return nil, fmt.Errorf("cannot scan waste site: %s", err)
+		}
+		res = append(res, site)
+	}
+	return res, rows.Err()
+}
+
+func (r *PgRepo) StageWaste(ctx context.Context, measurements []WasteMeasurement) error {
+	return r.stage(ctx, "staging_waste_measurements",
+		[]string{"site_name", "year", "week", "week_start", "week_end", "percentage"},
+		len(measurements), func(i int) []interface{} {
+			m := measurements[i]
+			return []interface{}{m.Site, m.Year, m.Week, m.WeekStart, m.WeekEnd, m.Percentage}
+		})
+}
+
+// MergeWaste merges the staged measurements. Measurements of unknown sites are dropped.
+func (r *PgRepo) MergeWaste(ctx context.Context) (MergeResult, error) {
+	selectSql := `SELECT DISTINCT ON (ws.id, s.year, s.week) ws.id AS site_id, s.year, s.week, s.week_start,
+	              s.week_end, s.percentage
+	              FROM staging_waste_measurements s JOIN waste_sites ws ON ws.name = s.site_name
+	              ORDER BY ws.id, s.year, s.week, s.id DESC`
+	return r.merge(ctx, "staging_waste_measurements", mergeSql(DatasetWaste, "waste_measurements",
+		[]string{"site_id", "year", "week"}, []string{"week_start", "week_end", "percentage"}, selectSql))
+}
+
+// GetWaste returns the measurements, by week and site. Dates keep the weeks that overlap with them.
+func (r *PgRepo) GetWaste(ctx context.Context, filter WasteFilter) ([]WasteMeasurement, error) {
+	sql := `SELECT m.site_id,ws.name,ws.name_en,m.year,m.week,m.week_start,m.week_end,m.percentage
+            FROM waste_measurements m JOIN waste_sites ws ON ws.id = m.site_id WHERE 1=1 `
+	counter := 1
+	var args []interface{}
+	if filter.SiteId > 0 {
+		sql += fmt.Sprintf(" AND m.site_id=$%d ", counter)
+		counter++
+		args = append(args, filter.SiteId)
+	}
+	if len(filter.Site) > 0 {
+		sql += fmt.Sprintf(" AND ws.slug=$%d ", counter)
+		counter++
+		args = append(args, filter.Site)
+	}
+	if !filter.StartWeek.IsZero() {
+		sql += fmt.Sprintf(" AND (m.year, m.week) >= ($%d, $%d) ", counter, counter+1)
+		counter += 2
+		args = append(args, filter.StartWeek.Year, filter.StartWeek.Week)
+	}
+	if !filter.EndWeek.IsZero() {
+		sql += fmt.Sprintf(" AND (m.year, m.week) <= ($%d, $%d) ", counter, counter+1)
+		counter += 2
+		args = append(args, filter.EndWeek.Year, filter.EndWeek.Week)
+	}
+	if !filter.StartDate.IsZero() {
+		sql += fmt.Sprintf(" AND m.week_end >= $%d ", counter)
+		counter++
+		args = append(args, filter.StartDate)
+	}
+	if !filter.EndDate.IsZero() {
+		sql += fmt.Sprintf(" AND m.week_start <= $%d ", counter)
+		counter++
+		args = append(args, filter.EndDate)
+	}
+	sql += asOfSql(filter.AsOf, &counter, &args)
+	sql += " ORDER BY m.year, m.week, ws.name "
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get waste measurements: %s", err)
+	}
+	defer rows.Close()
+
+	var res []WasteMeasurement
+	for rows.Next() {
+		var m WasteMeasurement
+		if err := rows.Scan(&m.SiteId, &m.Site, &m.SiteEn, &m.Year, &m.Week, &m.WeekStart, &m.WeekEnd,
+			&m.Percentage); err != nil {
+			return nil, fmt.Errorf("cannot scan waste measurement: %s", err)
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS source_states;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS source_states
+(
+    name          VARCHAR(100) PRIMARY KEY,
+    etag          VARCHAR(255),
+    last_modified VARCHAR(255),
+    sha256        VARCHAR(64),
+    loaded_at     TIMESTAMP,
+    skipped_at    TIMESTAMP
+);
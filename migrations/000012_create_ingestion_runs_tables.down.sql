@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ingestion_steps;
+DROP TABLE IF EXISTS ingestion_runs;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS ingestion_runs
+(
+    id          SERIAL PRIMARY KEY,
+    trigger     VARCHAR(50) NOT NULL,
+    started_at  TIMESTAMP   NOT NULL,
+    finished_at TIMESTAMP,
+    status      VARCHAR(20) NOT NULL,
+    error       TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS ingestion_steps
+(
+    id            SERIAL PRIMARY KEY,
+    run_id        INTEGER      NOT NULL,
+    dataset       VARCHAR(100) NOT NULL,
+    started_at    TIMESTAMP    NOT NULL,
+    finished_at   TIMESTAMP    NOT NULL,
+    status        VARCHAR(20)  NOT NULL,
+    rows_read     INTEGER      NOT NULL DEFAULT 0,
+    rows_inserted INTEGER      NOT NULL DEFAULT 0,
+    rows_updated  INTEGER      NOT NULL DEFAULT 0,
+    rows_rejected INTEGER      NOT NULL DEFAULT 0,
+    source_url    TEXT         NOT NULL DEFAULT '',
+    source_sha256 TEXT         NOT NULL DEFAULT '',
+    error         TEXT         NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_steps_run_id ON ingestion_steps (run_id);
+
+ALTER TABLE ingestion_steps
+    ADD CONSTRAINT fk_run_id FOREIGN KEY (run_id) REFERENCES ingestion_runs (id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS staging_cases_per_regional_unit;
+DROP TABLE IF EXISTS staging_greece_timeline;
+DROP TABLE IF EXISTS staging_deaths_per_municipality_cum;
+DROP TABLE IF EXISTS staging_demography_per_age;
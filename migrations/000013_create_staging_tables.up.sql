@@ -0,0 +1,59 @@
+-- Staging tables for bulk loading. Data are copied here with COPY and then merged into the
+-- published tables in a single statement. They are unlogged, as their contents never outlive a transaction.
+-- id keeps the order rows were copied in, so the last of duplicate rows wins when merging.
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_cases_per_regional_unit
+(
+    id                 BIGSERIAL,
+    regional_unit_slug VARCHAR(255),
+    date               DATE,
+    cases              INTEGER
+);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_greece_timeline
+(
+    id                        BIGSERIAL,
+    date                      DATE,
+    cases                     INTEGER,
+    total_reinfections        INTEGER,
+    deaths                    INTEGER,
+    deaths_cum                INTEGER,
+    recovered                 INTEGER,
+    beds_occupancy            FLOAT,
+    icu_occupancy             FLOAT,
+    intubated                 INTEGER,
+    intubated_vac             INTEGER,
+    intubated_unvac           INTEGER,
+    hospital_admissions       INTEGER,
+    hospital_discharges       INTEGER,
+    estimated_new_rtpcr_tests INTEGER,
+    estimated_new_rapid_tests INTEGER,
+    estimated_new_total_tests INTEGER,
+    cases_cum                 INTEGER,
+    waste_highest_place       VARCHAR(100),
+    waste_highest_percentage  FLOAT,
+    waste_highest_place_en    VARCHAR(100)
+);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_deaths_per_municipality_cum
+(
+    id              BIGSERIAL,
+    year            INTEGER,
+    municipality_id INTEGER,
+    deaths_cum      INTEGER
+);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_demography_per_age
+(
+    id                  BIGSERIAL,
+    date                DATE,
+    category            VARCHAR(5),
+    cases               INTEGER,
+    deaths              INTEGER,
+    intensive           INTEGER,
+    discharged          INTEGER,
+    hospitalized        INTEGER,
+    hospitalized_in_icu INTEGER,
+    passed_away         INTEGER,
+    recovered           INTEGER,
+    treated_at_home     INTEGER
+);
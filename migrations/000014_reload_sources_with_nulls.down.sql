@@ -0,0 +1,2 @@
+-- Nothing to undo, the sources are loaded again anyway.
+SELECT 1;
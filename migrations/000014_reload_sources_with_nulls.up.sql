@@ -0,0 +1,3 @@
+-- Values missing from the sources used to be stored as 0. Forgetting the fingerprints of the sources makes the next
+-- ingestion load them again, which replaces these zeros with NULL.
+UPDATE source_states SET etag = NULL, last_modified = NULL, sha256 = NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE ingestion_steps
+    DROP COLUMN IF EXISTS values_quarantined;
+DROP TABLE IF EXISTS quarantined_values;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS quarantined_values
+(
+    id              SERIAL PRIMARY KEY,
+    dataset         VARCHAR(100)     NOT NULL,
+    date            DATE             NOT NULL,
+    field           VARCHAR(100)     NOT NULL,
+    value           DOUBLE PRECISION NOT NULL,
+    published_value DOUBLE PRECISION,
+    reason          TEXT             NOT NULL,
+    status          VARCHAR(20)      NOT NULL,
+    detected_at     TIMESTAMP        NOT NULL,
+    resolved_at     TIMESTAMP,
+    UNIQUE (dataset, date, field)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantined_values_status ON quarantined_values (status);
+
+ALTER TABLE ingestion_steps
+    ADD COLUMN IF NOT EXISTS values_quarantined INTEGER NOT NULL DEFAULT 0;
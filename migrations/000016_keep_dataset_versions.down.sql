@@ -0,0 +1,34 @@
+-- only the current versions are kept
+DELETE FROM greece_timeline WHERE valid_to IS NOT NULL;
+DROP INDEX IF EXISTS idx_greece_timeline_current;
+DROP INDEX IF EXISTS idx_greece_timeline_date_valid_from;
+ALTER TABLE greece_timeline
+    DROP COLUMN IF EXISTS valid_from,
+    DROP COLUMN IF EXISTS valid_to,
+    DROP COLUMN IF EXISTS ingestion_run_id,
+    ADD CONSTRAINT greece_timeline_pkey PRIMARY KEY (date),
+    ADD CONSTRAINT greece_timeline_date_key UNIQUE (date);
+
+DELETE FROM cases_per_regional_unit WHERE valid_to IS NOT NULL;
+DROP INDEX IF EXISTS idx_cases_per_regional_unit_current;
+ALTER TABLE cases_per_regional_unit
+    DROP COLUMN IF EXISTS valid_from,
+    DROP COLUMN IF EXISTS valid_to,
+    DROP COLUMN IF EXISTS ingestion_run_id,
+    ADD CONSTRAINT cases_per_county_county_id_date_key UNIQUE (regional_unit_id, date);
+
+DELETE FROM deaths_per_municipality_cum WHERE valid_to IS NOT NULL;
+DROP INDEX IF EXISTS idx_deaths_per_municipality_cum_current;
+ALTER TABLE deaths_per_municipality_cum
+    DROP COLUMN IF EXISTS valid_from,
+    DROP COLUMN IF EXISTS valid_to,
+    DROP COLUMN IF EXISTS ingestion_run_id,
+    ADD CONSTRAINT deaths_per_municipality_cum_year_municipality_id_key UNIQUE (year, municipality_id);
+
+DELETE FROM demography_per_age WHERE valid_to IS NOT NULL;
+DROP INDEX IF EXISTS idx_demography_per_age_current;
+ALTER TABLE demography_per_age
+    DROP COLUMN IF EXISTS valid_from,
+    DROP COLUMN IF EXISTS valid_to,
+    DROP COLUMN IF EXISTS ingestion_run_id,
+    ADD CONSTRAINT demography_per_age_date_category_key UNIQUE (date, category);
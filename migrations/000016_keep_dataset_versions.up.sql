@@ -0,0 +1,44 @@
+-- Values of the datasets are versioned instead of overwritten. A version is what the API knew from valid_from until
+-- valid_to, and the current version of a row has no valid_to. ingestion_run_id is the run that recorded it, if any.
+-- Values loaded before versioning are considered known since forever.
+-- Keys are unique only among current versions.
+ALTER TABLE greece_timeline
+    ADD COLUMN IF NOT EXISTS valid_from       TIMESTAMP NOT NULL DEFAULT '-infinity',
+    ADD COLUMN IF NOT EXISTS valid_to         TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL,
+    ALTER COLUMN valid_from DROP DEFAULT,
+    DROP CONSTRAINT IF EXISTS greece_timeline_pkey,
+    DROP CONSTRAINT IF EXISTS greece_timeline_date_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_greece_timeline_current ON greece_timeline (date) WHERE valid_to IS NULL;
+CREATE INDEX IF NOT EXISTS idx_greece_timeline_date_valid_from ON greece_timeline (date, valid_from);
+
+ALTER TABLE cases_per_regional_unit
+    ADD COLUMN IF NOT EXISTS valid_from       TIMESTAMP NOT NULL DEFAULT '-infinity',
+    ADD COLUMN IF NOT EXISTS valid_to         TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL,
+    ALTER COLUMN valid_from DROP DEFAULT,
+    DROP CONSTRAINT IF EXISTS cases_per_county_county_id_date_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cases_per_regional_unit_current
+    ON cases_per_regional_unit (regional_unit_id, date) WHERE valid_to IS NULL;
+
+ALTER TABLE deaths_per_municipality_cum
+    ADD COLUMN IF NOT EXISTS valid_from       TIMESTAMP NOT NULL DEFAULT '-infinity',
+    ADD COLUMN IF NOT EXISTS valid_to         TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL,
+    ALTER COLUMN valid_from DROP DEFAULT,
+    DROP CONSTRAINT IF EXISTS deaths_per_municipality_cum_year_municipality_id_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deaths_per_municipality_cum_current
+    ON deaths_per_municipality_cum (year, municipality_id) WHERE valid_to IS NULL;
+
+ALTER TABLE demography_per_age
+    ADD COLUMN IF NOT EXISTS valid_from       TIMESTAMP NOT NULL DEFAULT '-infinity',
+    ADD COLUMN IF NOT EXISTS valid_to         TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL,
+    ALTER COLUMN valid_from DROP DEFAULT,
+    DROP CONSTRAINT IF EXISTS demography_per_age_date_category_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_demography_per_age_current
+    ON demography_per_age (date, category) WHERE valid_to IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE ingestion_steps
+    DROP COLUMN IF EXISTS values_revised;
+DROP TABLE IF EXISTS revisions;
@@ -0,0 +1,18 @@
+-- Values that loads changed. key identifies the row of the dataset, and values are stored as text.
+CREATE TABLE IF NOT EXISTS revisions
+(
+    id               SERIAL PRIMARY KEY,
+    dataset          VARCHAR(100) NOT NULL,
+    key              JSONB        NOT NULL,
+    field            VARCHAR(100) NOT NULL,
+    old_value        TEXT,
+    new_value        TEXT,
+    ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL,
+    recorded_at      TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_revisions_recorded_at ON revisions (recorded_at);
+CREATE INDEX IF NOT EXISTS idx_revisions_dataset ON revisions (dataset);
+
+ALTER TABLE ingestion_steps
+    ADD COLUMN IF NOT EXISTS values_revised INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS staging_waste_measurements;
+DROP TABLE IF EXISTS waste_measurements;
+DROP TABLE IF EXISTS waste_sites;
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS waste_sites
+(
+    id      SERIAL PRIMARY KEY,
+    name    VARCHAR(100) NOT NULL,
+    name_en VARCHAR(100) NOT NULL DEFAULT '',
+    slug    VARCHAR(100) NOT NULL,
+    UNIQUE (name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_waste_sites_slug ON waste_sites (slug);
+
+-- Weekly change of the viral load at a site during an ISO week. Measurements are versioned like the rest of
+-- the datasets, see 000016_keep_dataset_versions.
+CREATE TABLE IF NOT EXISTS waste_measurements
+(
+    site_id          INTEGER   NOT NULL REFERENCES waste_sites (id),
+    year             INTEGER   NOT NULL,
+    week             INTEGER   NOT NULL,
+    week_start       DATE      NOT NULL,
+    week_end         DATE      NOT NULL,
+    percentage       FLOAT,
+    valid_from       TIMESTAMP NOT NULL,
+    valid_to         TIMESTAMP,
+    ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waste_measurements_current
+    ON waste_measurements (site_id, year, week) WHERE valid_to IS NULL;
+CREATE INDEX IF NOT EXISTS idx_waste_measurements_week_start ON waste_measurements (week_start);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_waste_measurements
+(
+    id         BIGSERIAL,
+    site_name  VARCHAR(100),
+    year       INTEGER,
+    week       INTEGER,
+    week_start DATE,
+    week_end   DATE,
+    percentage FLOAT
+);
@@ -0,0 +1,11 @@
+ALTER TABLE staging_cases_per_regional_unit
+    DROP COLUMN IF EXISTS period_start,
+    DROP COLUMN IF EXISTS period_end,
+    DROP COLUMN IF EXISTS cadence;
+
+ALTER TABLE cases_per_regional_unit
+    DROP COLUMN IF EXISTS period_start,
+    DROP COLUMN IF EXISTS period_end,
+    DROP COLUMN IF EXISTS cadence;
+
+DROP TABLE IF EXISTS reporting_cadences;
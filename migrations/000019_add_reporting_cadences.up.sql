@@ -0,0 +1,41 @@
+-- The cadence at which the sources report a dataset, from a date on until the next cadence of the same dataset.
+-- Dates before the first cadence of a dataset are reported daily. A weekly value covers the 7 days ending at the
+-- date it is reported, and is reported every 7 days from since.
+CREATE TABLE IF NOT EXISTS reporting_cadences
+(
+    dataset VARCHAR(50) NOT NULL,
+    since   DATE        NOT NULL,
+    cadence VARCHAR(10) NOT NULL CHECK (cadence IN ('daily', 'weekly')),
+    PRIMARY KEY (dataset, since)
+);
+
+-- from 12/7/2022 on, EODY reports cases weekly instead of daily
+INSERT INTO reporting_cadences (dataset, since, cadence)
+VALUES ('cases', '2022-07-12', 'weekly')
+ON CONFLICT DO NOTHING;
+
+-- every observation of cases carries the period it covers and its cadence
+ALTER TABLE cases_per_regional_unit
+    ADD COLUMN IF NOT EXISTS period_start DATE,
+    ADD COLUMN IF NOT EXISTS period_end   DATE,
+    ADD COLUMN IF NOT EXISTS cadence      VARCHAR(10) NOT NULL DEFAULT 'daily';
+
+UPDATE cases_per_regional_unit
+SET period_start = date,
+    period_end   = date;
+
+UPDATE cases_per_regional_unit
+SET period_start = date - 6,
+    cadence      = 'weekly'
+WHERE date >= '2022-07-12'
+  AND (date - DATE '2022-07-12') % 7 = 0;
+
+ALTER TABLE cases_per_regional_unit
+    ALTER COLUMN period_start SET NOT NULL,
+    ALTER COLUMN period_end SET NOT NULL,
+    ALTER COLUMN cadence DROP DEFAULT;
+
+ALTER TABLE staging_cases_per_regional_unit
+    ADD COLUMN IF NOT EXISTS period_start DATE,
+    ADD COLUMN IF NOT EXISTS period_end   DATE,
+    ADD COLUMN IF NOT EXISTS cadence      VARCHAR(10);
@@ -0,0 +1,9 @@
+ALTER TABLE municipalities
+    DROP COLUMN IF EXISTS regional_unit_id;
+
+ALTER TABLE regional_units
+    DROP COLUMN IF EXISTS department_id,
+    DROP COLUMN IF EXISTS prefecture_id;
+
+DROP TABLE IF EXISTS prefectures;
+DROP TABLE IF EXISTS departments;
@@ -0,0 +1,26 @@
+-- The administrative hierarchy: municipality -> regional unit -> prefecture -> department. Departments and
+-- prefectures are taken from the regional units, while municipalities are linked to their regional units by the
+-- YPES registry (see municipalities_ypes.csv). Links are synced after every population.
+CREATE TABLE IF NOT EXISTS departments
+(
+    id   SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    slug VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS prefectures
+(
+    id   SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    slug VARCHAR(255) NOT NULL
+);
+
+-- a prefecture may span more than one department, so both are kept on the regional unit
+ALTER TABLE regional_units
+    ADD COLUMN IF NOT EXISTS department_id INTEGER REFERENCES departments (id),
+    ADD COLUMN IF NOT EXISTS prefecture_id INTEGER REFERENCES prefectures (id);
+
+ALTER TABLE municipalities
+    ADD COLUMN IF NOT EXISTS regional_unit_id INTEGER REFERENCES regional_units (id);
+
+CREATE INDEX IF NOT EXISTS idx_municipalities_regional_unit_id ON municipalities (regional_unit_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS staging_vaccinations;
+DROP TABLE IF EXISTS vaccinations;
@@ -0,0 +1,25 @@
+-- Daily doses per regional unit and dose number. National doses are summed when read, so that every row has a
+-- regional unit to be versioned by, see 000016_keep_dataset_versions.
+CREATE TABLE IF NOT EXISTS vaccinations
+(
+    regional_unit_id INTEGER   NOT NULL REFERENCES regional_units (id),
+    date             DATE      NOT NULL,
+    dose             INTEGER   NOT NULL,
+    doses            INTEGER,
+    valid_from       TIMESTAMP NOT NULL,
+    valid_to         TIMESTAMP,
+    ingestion_run_id INTEGER REFERENCES ingestion_runs (id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vaccinations_current
+    ON vaccinations (regional_unit_id, date, dose) WHERE valid_to IS NULL;
+CREATE INDEX IF NOT EXISTS idx_vaccinations_date ON vaccinations (date);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS staging_vaccinations
+(
+    id                 BIGSERIAL,
+    regional_unit_slug VARCHAR(255),
+    date               DATE,
+    dose               INTEGER,
+    doses              INTEGER
+);
@@ -0,0 +1,59 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "*/15 1-5 1,15 jan-jun mon-fri", "5/10 * * * 7", "@hourly", "@Weekly"} {
+		_, err := Parse(expr)
+		assert.Nil(t, err, expr)
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *",
+		"*/0 * * * *", "* * * foo *", "@often"} {
+		_, err := Parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	from := time.Date(2022, 3, 15, 10, 30, 45, 0, time.UTC) // a Tuesday
+	for expr, expected := range map[string]time.Time{
+		"* * * * *":       time.Date(2022, 3, 15, 10, 31, 0, 0, time.UTC),
+		"@hourly":         time.Date(2022, 3, 15, 11, 0, 0, 0, time.UTC),
+		"*/20 * * * *":    time.Date(2022, 3, 15, 10, 40, 0, 0, time.UTC),
+		"0 4 * * *":       time.Date(2022, 3, 16, 4, 0, 0, 0, time.UTC),
+		"30 10 * * *":     time.Date(2022, 3, 16, 10, 30, 0, 0, time.UTC),
+		"0 6 * * sun":     time.Date(2022, 3, 20, 6, 0, 0, 0, time.UTC),
+		"0 6 * * 7":       time.Date(2022, 3, 20, 6, 0, 0, 0, time.UTC),
+		"0 0 1 * *":       time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":      time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 20 * mon":    time.Date(2022, 3, 20, 0, 0, 0, 0, time.UTC), // the 20th comes before Monday
+		"15 9-17/4 * * *": time.Date(2022, 3, 15, 13, 15, 0, 0, time.UTC),
+	} {
+		s, err := Parse(expr)
+		assert.Nil(t, err, expr)
+		assert.Equal(t, expected, s.Next(from), expr)
+	}
+
+	s, _ := Parse("0 0 30 2 *")
+	assert.True(t, s.Next(from).IsZero())
+}
+
+func TestNextInTimezone(t *testing.T) {
+	athens, err := time.LoadLocation("Europe/Athens")
+	assert.Nil(t, err)
+	s, _ := Parse("0 4 * * *")
+
+	// 04:00 in Athens is 02:00 UTC in winter and 01:00 UTC in summer
+	next := s.Next(time.Date(2022, 3, 26, 12, 0, 0, 0, time.UTC).In(athens))
+	assert.Equal(t, time.Date(2022, 3, 27, 1, 0, 0, 0, time.UTC), next.UTC())
+	next = s.Next(next)
+	assert.Equal(t, time.Date(2022, 3, 28, 1, 0, 0, 0, time.UTC), next.UTC())
+	next = s.Next(time.Date(2022, 12, 1, 12, 0, 0, 0, athens))
+	assert.Equal(t, time.Date(2022, 12, 2, 2, 0, 0, 0, time.UTC), next.UTC())
+}
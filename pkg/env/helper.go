@@ -32,3 +32,16 @@ func BoolEnvOrDefault(key string, def bool) bool {
 	}
 	return false
 }
+
+// WithPrefix returns the variables whose names start with prefix, keyed by the rest of their names in lower case,
+// e.g. SCHEDULE_CASES is returned as cases for the prefix SCHEDULE_.
+func WithPrefix(prefix string) map[string]string {
+	res := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) && value != "" {
+			res[strings.ToLower(strings.TrimPrefix(key, prefix))] = value
+		}
+	}
+	return res
+}
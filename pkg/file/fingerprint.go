@@ -0,0 +1,148 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// ErrNotModified is returned by conditional sources when the contents have not changed.
+var ErrNotModified = errors.New("source not modified")
+
+// Fingerprint identifies a specific version of a source's contents.
+type Fingerprint struct {
+	ETag         string
+	LastModified string
+	Sha256       string
+}
+
+// ConditionalSource is implemented by sources that can tell whether their contents changed
+// without transferring them, e.g. through HTTP conditional requests.
+type ConditionalSource interface {
+	Source
+	// OpenIfModified is like Open, but returns ErrNotModified when the contents are the same as in prev.
+	// The returned fingerprint carries the validators (ETag, Last-Modified) of the new contents.
+	OpenIfModified(ctx context.Context, prev Fingerprint) (io.ReadCloser, Fingerprint, error)
+}
+
+// Fetch opens a source for loading, unless it has not changed since prev. Conditional sources are asked first, so
+// unchanged remote files are not downloaded at all; nil is returned then, along with prev. Otherwise the source is
+// returned tracked, and its first read is the one already opened, whose validators (ETag, Last-Modified) are returned.
+// The hash of the contents is known once they were read, see TrackedSource.Sha256. The caller must close the source.
+func Fetch(ctx context.Context, src Source, prev Fingerprint) (*TrackedSource, Fingerprint, error) {
+	rc, fp, err := openIfModified(ctx, src, prev)
+	if errors.Is(err, ErrNotModified) {
+		return nil, prev, nil
+	}
+	if err != nil {
+		return nil, Fingerprint{}, err
+	}
+	t := Track(src)
+	t.opened = rc
+	return t, fp, nil
+}
+
+// TrackedSource hashes the contents of a source while they are read, so that whatever is loaded out of it can be
+// fingerprinted without holding the contents in memory. Every complete read has to see the same contents.
+type TrackedSource struct {
+	src Source
+
+	mu sync.Mutex
+	// opened is the reader the next Open returns, instead of opening the source again
+	opened io.ReadCloser
+	sum    string
+	err    error
+}
+
+// Track returns src tracked.
+func Track(src Source) *TrackedSource {
+	return &TrackedSource{src: src}
+}
+
+func (t *TrackedSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	t.mu.Lock()
+	rc := t.opened
+	t.opened = nil
+	t.mu.Unlock()
+	if rc == nil {
+		var err error
+		if rc, err = t.src.Open(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return &hashingReader{ReadCloser: rc, hash: sha256.New(), done: t.read}, nil
+}
+
+// read records the hash of contents that were read completely
+func (t *TrackedSource) read(sum string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case len(t.sum) == 0:
+		t.sum = sum
+	case t.sum != sum && t.err == nil:
+		t.err = fmt.Errorf("%s changed while it was read", t.src)
+	}
+}
+
+// Sha256 returns the hash of the contents that were read. It fails unless the contents were read completely at least
+// once, and the same every time.
+func (t *TrackedSource) Sha256() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return "", t.err
+	}
+	if len(t.sum) == 0 {
+		return "", fmt.Errorf("%s was not read completely", t.src)
+	}
+	return t.sum, nil
+}
+
+// Close closes the reader opened by Fetch, if it was never read.
+func (t *TrackedSource) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.opened == nil {
+		return nil
+	}
+	err := t.opened.Close()
+	t.opened = nil
+	return err
+}
+
+// String describes the tracked source.
+func (t *TrackedSource) String() string {
+	return t.src.String()
+}
+
+// hashingReader hashes what is read through it, and reports the hash once the contents are over
+type hashingReader struct {
+	io.ReadCloser
+	hash hash.Hash
+	done func(sum string)
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && r.done != nil {
+		r.done(hex.EncodeToString(r.hash.Sum(nil)))
+		r.done = nil
+	}
+	return n, err
+}
+
+// openIfModified opens the source conditionally if it supports it, or unconditionally otherwise.
+func openIfModified(ctx context.Context, src Source, prev Fingerprint) (io.ReadCloser, Fingerprint, error) {
+	if cs, ok := src.(ConditionalSource); ok {
+		return cs.OpenIfModified(ctx, prev)
+	}
+	rc, err := src.Open(ctx)
+	return rc, Fingerprint{}, err
+}
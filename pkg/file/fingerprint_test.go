@@ -0,0 +1,93 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConditionalHttpSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = io.WriteString(w, testCsv)
+	}))
+	defer srv.Close()
+
+	src := NewHttpSource(srv.URL + "/data.csv")
+	tracked, fp, err := Fetch(context.Background(), src, Fingerprint{})
+	assert.Nil(t, err)
+	assert.Equal(t, `"v1"`, fp.ETag)
+	assert.Equal(t, src.String(), tracked.String())
+	assert.Nil(t, tracked.Close())
+
+	tracked, again, err := Fetch(context.Background(), src, fp)
+	assert.Nil(t, err)
+	assert.Equal(t, fp, again)
+	assert.Nil(t, tracked)
+}
+
+// readAll reads a source completely
+func readAll(t *testing.T, src Source) string {
+	rc, err := src.Open(context.Background())
+	assert.Nil(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestTrackedSourceHashesContentsWhileRead(t *testing.T) {
+	tracked := Track(NewMemorySource("test", []byte(testCsv)))
+	_, err := tracked.Sha256()
+	assert.ErrorContains(t, err, "was not read completely")
+
+	assert.Equal(t, testCsv, readAll(t, tracked))
+	assert.Equal(t, testCsv, readAll(t, tracked))
+	sum, err := tracked.Sha256()
+	assert.Nil(t, err)
+	expected := sha256.Sum256([]byte(testCsv))
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+}
+
+func TestTrackedSourceFailsIfReadsDiffer(t *testing.T) {
+	// the source changes after every read, like a remote file updated between downloads
+	version := 0
+	src := sourceFunc(func() string {
+		version++
+		return fmt.Sprintf("a,b\n%d,%d\n", version, version)
+	})
+	tracked, _, err := Fetch(context.Background(), src, Fingerprint{})
+	assert.Nil(t, err)
+
+	// the first read is the one opened by Fetch
+	assert.Equal(t, "a,b\n1,1\n", readAll(t, tracked))
+	_, err = tracked.Sha256()
+	assert.Nil(t, err)
+
+	assert.Equal(t, "a,b\n2,2\n", readAll(t, tracked))
+	_, err = tracked.Sha256()
+	assert.ErrorContains(t, err, "changed while it was read")
+}
+
+// sourceFunc serves the contents returned by calling it, once per read
+type sourceFunc func() string
+
+func (f sourceFunc) Open(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(f())), nil
+}
+
+func (f sourceFunc) String() string {
+	return "func"
+}
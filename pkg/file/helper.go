@@ -1,57 +1,93 @@
 package file
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"net/http"
-	"os"
-	"strings"
 )
 
-func ReadCsv(url string, sourceIsFile bool) ([][]string, error) {
-	var err error
-	filepath := url
-	if !sourceIsFile {
-		filepath, err = DownloadFile(url)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return ReadCsvFile(filepath)
+// CsvIterator streams the records of a CSV source one at a time, so that callers never have to hold
+// the whole file in memory.
+type CsvIterator struct {
+	src    Source
+	rc     io.ReadCloser
+	reader *csv.Reader
+	row    []string
+	line   int
+	err    error
 }
 
-func ReadCsvFile(filePath string) ([][]string, error) {
-	f, err := os.Open(filePath)
+// OpenCsv opens the source and returns an iterator over its records. The caller must close it.
+func OpenCsv(ctx context.Context, src Source) (*CsvIterator, error) {
+	rc, err := src.Open(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read input file %s: %s", filePath, err)
+		return nil, err
 	}
-	defer f.Close()
+	return &CsvIterator{
+		src:    src,
+		rc:     rc,
+		reader: csv.NewReader(rc),
+	}, nil
+}
 
-	csvReader := csv.NewReader(f)
-	records, err := csvReader.ReadAll()
+// Next advances to the next record. It returns false when there are no more records or an error occurred.
+func (it *CsvIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	row, err := it.reader.Read()
+	if err == io.EOF {
+		return false
+	}
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse file %s as CSV: %s", filePath, err)
+		it.err = fmt.Errorf("unable to parse %s as CSV: %s", it.src, err)
+		return false
 	}
+	it.row = row
+	it.line++
+	return true
+}
 
-	return records, nil
+// Row returns the current record.
+func (it *CsvIterator) Row() []string {
+	return it.row
 }
 
-func DownloadFile(url string) (string, error) {
-	filepath := strings.Split(url, "/")[len(strings.Split(url, "/"))-1]
-	out, err := os.Create(filepath)
-	if err != nil {
-		return "", fmt.Errorf("cannot create file: %s", err)
-	}
-	defer out.Close()
-	resp, err := http.Get(url)
+// Line returns the 1-based index of the current record.
+func (it *CsvIterator) Line() int {
+	return it.line
+}
+
+// Err returns the first error encountered while iterating.
+func (it *CsvIterator) Err() error {
+	return it.err
+}
+
+func (it *CsvIterator) String() string {
+	return it.src.String()
+}
+
+func (it *CsvIterator) Close() error {
+	return it.rc.Close()
+}
+
+// ReadCsv reads all records of a source at once. Prefer OpenCsv for anything but small files.
+func ReadCsv(ctx context.Context, src Source) ([][]string, error) {
+	it, err := OpenCsv(ctx, src)
 	if err != nil {
-		return "", fmt.Errorf("cannot download file %s: %s", url, err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		return "", fmt.Errorf("io.Copy error: %s", err)
+	defer it.Close()
+
+	var records [][]string
+	for it.Next() {
+		records = append(records, it.Row())
 	}
 
-	return filepath, nil
+	return records, it.Err()
+}
+
+func ReadCsvFile(filePath string) ([][]string, error) {
+	return ReadCsv(context.Background(), NewLocalSource(filePath))
 }
@@ -0,0 +1,35 @@
+package file
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCsvIterator(t *testing.T) {
+	rows, err := OpenCsv(context.Background(), NewMemorySource("test", []byte("a,b\n1,2\n3,4\n")))
+	assert.Nil(t, err)
+	defer rows.Close()
+
+	var got [][]string
+	var lines []int
+	for rows.Next() {
+		got = append(got, rows.Row())
+		lines = append(lines, rows.Line())
+	}
+	assert.Nil(t, rows.Err())
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}, {"3", "4"}}, got)
+	assert.Equal(t, []int{1, 2, 3}, lines)
+}
+
+func TestCsvIteratorMalformed(t *testing.T) {
+	rows, err := OpenCsv(context.Background(), NewMemorySource("test", []byte("a,b\n1,2,3\n")))
+	assert.Nil(t, err)
+	defer rows.Close()
+
+	assert.True(t, rows.Next())
+	assert.False(t, rows.Next())
+	assert.NotNil(t, rows.Err())
+	assert.False(t, rows.Next())
+}
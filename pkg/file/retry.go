@@ -0,0 +1,79 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Retry is how often and how patiently a failed download is attempted again. The n-th retry waits BaseDelay * 2^n,
+// at most MaxDelay, of which a random half is taken off so that retries of many sources do not hit a server at once.
+type Retry struct {
+	// Attempts is the total number of attempts, including the first one. Anything below 1 means 1.
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetry is the retry policy of sources created by NewHttpSource.
+var DefaultRetry = Retry{Attempts: 4, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+// NoRetry attempts everything once.
+var NoRetry = Retry{Attempts: 1}
+
+// permanentError is an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks err as not worth retrying
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Do runs fn until it succeeds, returns a permanent error, runs out of attempts or ctx is done. The error of the last
+// attempt is returned.
+func (r Retry) Do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if err == nil || attempt+1 >= r.Attempts || ctx.Err() != nil {
+			return err
+		}
+		t := time.NewTimer(r.delay(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// delay is the wait before the retry following the given attempt, counting from 0
+func (r Retry) delay(attempt int) time.Duration {
+	d := r.BaseDelay
+	for i := 0; i < attempt && (r.MaxDelay <= 0 || d < r.MaxDelay); i++ {
+		d *= 2
+	}
+	if r.MaxDelay > 0 && d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
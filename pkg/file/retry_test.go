@@ -0,0 +1,77 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var quickRetry = Retry{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestHttpSourceRetriesServerErrors(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, testCsv)
+	}))
+	defer srv.Close()
+
+	records, err := ReadCsv(context.Background(), NewHttpSource(srv.URL+"/data.csv").WithRetry(quickRetry))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, records)
+	assert.Equal(t, 3, requests)
+}
+
+func TestHttpSourceGivesUp(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := ReadCsv(context.Background(), NewHttpSource(srv.URL+"/data.csv").WithRetry(quickRetry))
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests)
+
+	// client errors are not retried
+	requests = 0
+	_, err = ReadCsv(context.Background(), NewHttpSource(srv.URL+"/missing.csv").WithRetry(quickRetry))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := Retry{Attempts: 5, BaseDelay: time.Hour}.Do(ctx, func() error {
+		attempts++
+		cancel()
+		return errors.New("unavailable")
+	})
+	assert.EqualError(t, err, "unavailable")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := Retry{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		10 * time.Second, 10 * time.Second} {
+		d := r.delay(attempt)
+		assert.True(t, d >= max/2 && d <= max, "delay %s of attempt %d is not within %s", d, attempt, max)
+	}
+}
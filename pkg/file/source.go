@@ -0,0 +1,280 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Source is anything we can read a CSV dataset from.
+type Source interface {
+	// Open returns a reader for the contents of the source. The caller must close it.
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// String describes the source, mainly for logging.
+	String() string
+}
+
+// ParseSource creates a Source out of a URI. Supported forms are http(s)://..., file://... and plain
+// file paths. Paths ending in .gz are decompressed on the fly, while paths ending in .zip are read as
+// archives; a specific archive member can be selected with a fragment, e.g. data.zip#cases.csv.
+func ParseSource(uri string) (Source, error) {
+	if len(uri) == 0 {
+		return nil, fmt.Errorf("empty source uri")
+	}
+
+	location, member := uri, ""
+	if i := strings.LastIndex(uri, "#"); i >= 0 && strings.HasSuffix(strings.ToLower(uri[:i]), ".zip") {
+		location, member = uri[:i], uri[i+1:]
+	}
+
+	var src Source
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		src = NewHttpSource(location)
+	case strings.HasPrefix(location, "file://"):
+		src = NewLocalSource(strings.TrimPrefix(location, "file://"))
+	case strings.Contains(location, "://"):
+		return nil, fmt.Errorf("unsupported source scheme: %s", uri)
+	default:
+		src = NewLocalSource(location)
+	}
+
+	switch strings.ToLower(path.Ext(location)) {
+	case ".gz":
+		src = NewGzipSource(src)
+	case ".zip":
+		src = NewZipSource(src, member)
+	}
+
+	return src, nil
+}
+
+// LocalSource reads from a file on the local filesystem.
+type LocalSource struct {
+	path string
+}
+
+func NewLocalSource(path string) *LocalSource {
+	return &LocalSource{path: path}
+}
+
+func (s *LocalSource) Open(_ context.Context) (io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read input file %s: %s", s.path, err)
+	}
+	return f, nil
+}
+
+func (s *LocalSource) String() string {
+	return "file://" + s.path
+}
+
+// HttpSource reads the body of an HTTP GET response. Requests failing with network errors, 5xx or 429 responses are
+// retried according to its retry policy; a body that breaks off while being read is not.
+type HttpSource struct {
+	url    string
+	client *http.Client
+	retry  Retry
+}
+
+func NewHttpSource(url string) *HttpSource {
+	return &HttpSource{url: url, client: http.DefaultClient, retry: DefaultRetry}
+}
+
+// WithRetry sets the retry policy of the source.
+func (s *HttpSource) WithRetry(r Retry) *HttpSource {
+	s.retry = r
+	return s
+}
+
+func (s *HttpSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	rc, _, err := s.OpenIfModified(ctx, Fingerprint{})
+	return rc, err
+}
+
+// OpenIfModified sends a conditional request using the validators of prev.
+func (s *HttpSource) OpenIfModified(ctx context.Context, prev Fingerprint) (io.ReadCloser, Fingerprint, error) {
+	var resp *http.Response
+	err := s.retry.Do(ctx, func() error {
+		var err error
+		resp, err = s.get(ctx, prev)
+		return err
+	})
+	if err != nil {
+		return nil, Fingerprint{}, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, prev, ErrNotModified
+	}
+	return resp.Body, Fingerprint{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// get sends a single request, returning the response only if it is 200 or 304. Errors are permanent unless a retry
+// may fix them.
+func (s *HttpSource) get(ctx context.Context, prev Fingerprint) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("cannot create request for %s: %s", s.url, err))
+	}
+	if len(prev.ETag) > 0 {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if len(prev.LastModified) > 0 {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download file %s: %s", s.url, err)
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	resp.Body.Close()
+	err = fmt.Errorf("cannot download file %s: unexpected status %s", s.url, resp.Status)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, err
+	}
+	return nil, permanent(err)
+}
+
+func (s *HttpSource) String() string {
+	return s.url
+}
+
+// MemorySource serves its contents from memory. Mostly useful for tests.
+type MemorySource struct {
+	name string
+	data []byte
+}
+
+func NewMemorySource(name string, data []byte) *MemorySource {
+	return &MemorySource{name: name, data: data}
+}
+
+func (s *MemorySource) Open(_ context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.data)), nil
+}
+
+func (s *MemorySource) String() string {
+	return "memory://" + s.name
+}
+
+// GzipSource decompresses a gzipped source.
+type GzipSource struct {
+	src Source
+}
+
+func NewGzipSource(src Source) *GzipSource {
+	return &GzipSource{src: src}
+}
+
+func (s *GzipSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	rc, err := s.src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.decompress(rc)
+}
+
+func (s *GzipSource) OpenIfModified(ctx context.Context, prev Fingerprint) (io.ReadCloser, Fingerprint, error) {
+	rc, fp, err := openIfModified(ctx, s.src, prev)
+	if err != nil {
+		return nil, fp, err
+	}
+	gz, err := s.decompress(rc)
+	return gz, fp, err
+}
+
+func (s *GzipSource) decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("cannot decompress %s: %s", s.src, err)
+	}
+	return &gzipReadCloser{Reader: gz, underlying: rc}, nil
+}
+
+func (s *GzipSource) String() string {
+	return s.src.String()
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	underlying io.Closer
+}
+
+func (g *gzipReadCloser) Close() error {
+	err := g.Reader.Close()
+	if uErr := g.underlying.Close(); err == nil {
+		err = uErr
+	}
+	return err
+}
+
+// ZipSource reads a single member of a zip archive. If no member is given, the first CSV file
+// of the archive is used.
+type ZipSource struct {
+	src    Source
+	member string
+}
+
+func NewZipSource(src Source, member string) *ZipSource {
+	return &ZipSource{src: src, member: member}
+}
+
+func (s *ZipSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	rc, err := s.src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.extract(rc)
+}
+
+func (s *ZipSource) OpenIfModified(ctx context.Context, prev Fingerprint) (io.ReadCloser, Fingerprint, error) {
+	rc, fp, err := openIfModified(ctx, s.src, prev)
+	if err != nil {
+		return nil, fp, err
+	}
+	member, err := s.extract(rc)
+	return member, fp, err
+}
+
+func (s *ZipSource) extract(rc io.ReadCloser) (io.ReadCloser, error) {
+	defer rc.Close()
+
+	// zip needs random access, so the archive has to be buffered
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive %s: %s", s.src, err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive %s: %s", s.src, err)
+	}
+	for _, f := range zr.File {
+		if s.member == f.Name || (len(s.member) == 0 && strings.EqualFold(path.Ext(f.Name), ".csv")) {
+			return f.Open()
+		}
+	}
+
+	return nil, fmt.Errorf("member %q not found in archive %s", s.member, s.src)
+}
+
+func (s *ZipSource) String() string {
+	if len(s.member) > 0 {
+		return s.src.String() + "#" + s.member
+	}
+	return s.src.String()
+}
@@ -0,0 +1,95 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCsv = "a,b\n1,2\n"
+
+func TestParseSource(t *testing.T) {
+	src, err := ParseSource("https://example.com/data.csv")
+	assert.Nil(t, err)
+	assert.IsType(t, &HttpSource{}, src)
+
+	src, err = ParseSource("file:///tmp/data.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "file:///tmp/data.csv", src.String())
+
+	src, err = ParseSource("/tmp/data.csv.gz")
+	assert.Nil(t, err)
+	assert.IsType(t, &GzipSource{}, src)
+
+	src, err = ParseSource("https://example.com/data.zip#cases.csv")
+	assert.Nil(t, err)
+	assert.IsType(t, &ZipSource{}, src)
+	assert.Equal(t, "https://example.com/data.zip#cases.csv", src.String())
+
+	_, err = ParseSource("ftp://example.com/data.csv")
+	assert.NotNil(t, err)
+
+	_, err = ParseSource("")
+	assert.NotNil(t, err)
+}
+
+func TestReadCsvFromMemory(t *testing.T) {
+	records, err := ReadCsv(context.Background(), NewMemorySource("test", []byte(testCsv)))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, records)
+}
+
+func TestReadCsvFromGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(testCsv))
+	assert.Nil(t, gz.Close())
+
+	records, err := ReadCsv(context.Background(), NewGzipSource(NewMemorySource("test.gz", buf.Bytes())))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, records)
+}
+
+func TestReadCsvFromZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("README.txt")
+	_, _ = w.Write([]byte("not a csv"))
+	w, _ = zw.Create("cases.csv")
+	_, _ = w.Write([]byte(testCsv))
+	assert.Nil(t, zw.Close())
+
+	archive := NewMemorySource("test.zip", buf.Bytes())
+
+	records, err := ReadCsv(context.Background(), NewZipSource(archive, ""))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, records)
+
+	_, err = ReadCsv(context.Background(), NewZipSource(archive, "missing.csv"))
+	assert.NotNil(t, err)
+}
+
+func TestHttpSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, testCsv)
+	}))
+	defer srv.Close()
+
+	records, err := ReadCsv(context.Background(), NewHttpSource(srv.URL+"/data.csv"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, records)
+
+	_, err = ReadCsv(context.Background(), NewHttpSource(srv.URL+"/missing.csv"))
+	assert.NotNil(t, err)
+}
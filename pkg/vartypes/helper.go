@@ -1,7 +1,10 @@
 package vartypes
 
 import (
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
 )
 
 func StringToFloat(s string) float64 {
@@ -15,3 +18,41 @@ func StringToFloat(s string) float64 {
 func StringToInt(s string) int {
 	return int(StringToFloat(s))
 }
+
+// ParseNullableFloat parses s as a number. Empty strings are missing values, returned as nil.
+func ParseNullableFloat(s string) (*float64, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a number", s)
+	}
+	return &f, nil
+}
+
+// ParseNullableInt parses s as an integer, also accepting integral numbers like "12.0". Empty strings are missing
+// values, returned as nil.
+func ParseNullableInt(s string) (*int, error) {
+	f, err := ParseNullableFloat(s)
+	if f == nil || err != nil {
+		return nil, err
+	}
+	if *f != math.Trunc(*f) {
+		return nil, fmt.Errorf("%q is not an integer", s)
+	}
+	return IntPtr(int(*f)), nil
+}
+
+func IntPtr(i int) *int {
+	return &i
+}
+
+func FloatPtr(f float64) *float64 {
+	return &f
+}
+
+func StringPtr(s string) *string {
+	return &s
+}